@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/brighamskarda/applechess.git/zobrist"
+	"github.com/brighamskarda/chess"
+)
+
+// SampleMove picks one of moves whose score is within margin of the best, with probability proportional to
+// exp((score-best)/temperature). Scores must be from the perspective of the side choosing the move.
+func SampleMove(moves []chess.Move, scores []float64, margin float64, temperature float64, rng *rand.Rand) (chess.Move, float64) {
+	if len(moves) == 0 {
+		return chess.Move{}, 0
+	}
+	best := scores[0]
+	for _, score := range scores {
+		if score > best {
+			best = score
+		}
+	}
+
+	weights := make([]float64, len(moves))
+	total := 0.0
+	for i, score := range scores {
+		if best-score <= margin {
+			weights[i] = math.Exp((score - best) / temperature)
+			total += weights[i]
+		}
+	}
+
+	r := rng.Float64() * total
+	for i, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		r -= weight
+		if r <= 0 {
+			return moves[i], scores[i]
+		}
+	}
+	for i := len(moves) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return moves[i], scores[i]
+		}
+	}
+	return moves[0], scores[0]
+}
+
+// NewRand returns a random number generator seeded from seed.
+func NewRand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+}
+
+// MoveRand returns the random number generator for an agent with seed to choose its move from p with. A seed of 0 seeds
+// it randomly. Any other seed is mixed with the hash and move number of p, so that a seeded agent replays the same game
+// but does not choose the same way every time a position repeats.
+func MoveRand(seed uint64, p *chess.Position) *rand.Rand {
+	if seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return NewRand(seed ^ zobrist.Hash(p) ^ uint64(p.FullMove)*0x9e3779b97f4a7c15)
+}
+
+// CheckMove panics, reporting the position and move, if m is not one of the legal moves from p. Agents with StrictMoves
+// set call it on the move they are about to return.
+func CheckMove(p *chess.Position, m chess.Move) {
+	if !slices.Contains(LegalMoves(p), m) {
+		panic(fmt.Sprintf("agent chose move %s, which is not legal in position %s", m, chess.GenerateFen(p)))
+	}
+}
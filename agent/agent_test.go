@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+// strictStub plays its move, checking it first as an agent with StrictMoves does.
+type strictStub struct{ move chess.Move }
+
+func (s strictStub) GetMove(p chess.Position) chess.Move {
+	CheckMove(&p, s.move)
+	return s.move
+}
+
+// panicMessage returns what f panics with, or "" if it returns normally.
+func panicMessage(f func()) (message string) {
+	defer func() {
+		if r := recover(); r != nil {
+			message = fmt.Sprint(r)
+		}
+	}()
+	f()
+	return ""
+}
+
+func TestCheckMoveCatchesMoveOutsideGeneration(t *testing.T) {
+	// The pawn must promote, so e7e8 without a piece is not one of the generated moves.
+	p := mustParseFen(t, "k7/4P3/8/8/8/8/8/4K3 w - - 0 1")
+	unpromoted := chess.Move{
+		FromSquare: chess.Square{File: chess.FileE, Rank: chess.Rank7},
+		ToSquare:   chess.Square{File: chess.FileE, Rank: chess.Rank8},
+	}
+	message := panicMessage(func() { strictStub{unpromoted}.GetMove(p) })
+	if !strings.Contains(message, unpromoted.String()) || !strings.Contains(message, chess.GenerateFen(&p)) {
+		t.Errorf("strict check of %s panicked with %q, want the move and position", unpromoted, message)
+	}
+
+	promoted := unpromoted
+	promoted.Promotion = chess.Queen
+	if message := panicMessage(func() { strictStub{promoted}.GetMove(p) }); message != "" {
+		t.Errorf("strict check of the legal %s panicked with %q", promoted, message)
+	}
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/brighamskarda/chess"
+)
+
+// ErrorKind says why an agent could not choose a move.
+type ErrorKind int
+
+const (
+	Internal ErrorKind = iota
+	NoLegalMoves
+	InvalidPosition
+	Cancelled
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case Internal:
+		return "internal error"
+	case NoLegalMoves:
+		return "no legal moves"
+	case InvalidPosition:
+		return "invalid position"
+	case Cancelled:
+		return "cancelled"
+	}
+	return "unknown error"
+}
+
+var ErrNoLegalMoves = errors.New("side to move has no legal moves")
+
+// AgentError reports why an agent could not return a move. Err is the underlying cause, such as one of the
+// ValidatePosition errors for an InvalidPosition.
+type AgentError struct {
+	Kind  ErrorKind
+	Agent string // The kind of agent, such as "alphabeta"
+	Fen   string // The position the agent was asked to move in
+	Err   error
+}
+
+func (e *AgentError) Error() string {
+	return fmt.Sprintf("%s: %s in %s: %v", e.Agent, e.Kind, e.Fen, e.Err)
+}
+
+func (e *AgentError) Unwrap() error {
+	return e.Err
+}
+
+// RunSearch calls search, returning an Internal *AgentError for the agent called agentName if it panics, so that a bug
+// in a search fails the move from p rather than the whole program.
+func RunSearch(agentName string, p *chess.Position, search func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cause := fmt.Errorf("search panicked: %v", r)
+			err = &AgentError{Kind: Internal, Agent: agentName, Fen: chess.GenerateFen(p), Err: cause}
+		}
+	}()
+	search()
+	return nil
+}
+
+// CheckPosition returns an *AgentError if the agent called agentName cannot move in p, either because p is invalid or
+// because the side to move has no legal moves.
+func CheckPosition(agentName string, p *chess.Position) error {
+	if err := ValidatePosition(p); err != nil {
+		return &AgentError{Kind: InvalidPosition, Agent: agentName, Fen: chess.GenerateFen(p), Err: err}
+	}
+	if len(LegalMoves(p)) == 0 {
+		return &AgentError{Kind: NoLegalMoves, Agent: agentName, Fen: chess.GenerateFen(p), Err: ErrNoLegalMoves}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestCheckPositionCategorisesFailures(t *testing.T) {
+	noTurn := mustParseFen(t, chess.DefaultFen)
+	noTurn.Turn = chess.NoColor
+	for _, tc := range []struct {
+		name  string
+		p     chess.Position
+		kind  ErrorKind
+		cause error
+	}{
+		{"checkmate", mustParseFen(t, "R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1"), NoLegalMoves, ErrNoLegalMoves},
+		{"stalemate", mustParseFen(t, "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1"), NoLegalMoves, ErrNoLegalMoves},
+		{"invalid turn", noTurn, InvalidPosition, ErrInvalidTurn},
+		{"missing king", mustParseFen(t, "4k3/8/8/8/8/8/8/8 w - - 0 1"), InvalidPosition, ErrKingCount},
+	} {
+		err := CheckPosition("test", &tc.p)
+		var agentErr *AgentError
+		if !errors.As(err, &agentErr) {
+			t.Errorf("%s: CheckPosition returned %v, want an *AgentError", tc.name, err)
+			continue
+		}
+		if agentErr.Kind != tc.kind || !errors.Is(err, tc.cause) {
+			t.Errorf("%s: got a %s error caused by %v, want a %s error caused by %v", tc.name, agentErr.Kind,
+				agentErr.Err, tc.kind, tc.cause)
+		}
+		if fen := chess.GenerateFen(&tc.p); agentErr.Agent != "test" || agentErr.Fen != fen {
+			t.Errorf("%s: error is for agent %q in %s, want %q in %s", tc.name, agentErr.Agent, agentErr.Fen, "test",
+				fen)
+		}
+	}
+	start := mustParseFen(t, chess.DefaultFen)
+	if err := CheckPosition("test", &start); err != nil {
+		t.Errorf("CheckPosition of the starting position returned %v", err)
+	}
+}
+
+func TestAgentErrorMessage(t *testing.T) {
+	err := &AgentError{Kind: Cancelled, Agent: "alphabeta", Fen: chess.DefaultFen, Err: errors.New("deadline")}
+	for _, part := range []string{"alphabeta", "cancelled", chess.DefaultFen, "deadline"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("error %q does not mention %q", err.Error(), part)
+		}
+	}
+}
+
+func TestRunSearchReportsPanicAsInternal(t *testing.T) {
+	p := mustParseFen(t, chess.DefaultFen)
+	err := RunSearch("test", &p, func() { panic("search bug") })
+	var agentErr *AgentError
+	if !errors.As(err, &agentErr) || agentErr.Kind != Internal || !strings.Contains(err.Error(), "search bug") {
+		t.Errorf("RunSearch of a panicking search returned %v, want an internal error mentioning the panic", err)
+	}
+	if err := RunSearch("test", &p, func() {}); err != nil {
+		t.Errorf("RunSearch of a search that returned normally gave %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"slices"
+
+	"github.com/brighamskarda/chess"
+)
+
+// LegalMoves returns the legal moves from p. It is chess.GenerateLegalMoves without the castling moves that pass over
+// an attacked square, which the chess library lets through.
+func LegalMoves(p *chess.Position) []chess.Move {
+	return slices.DeleteFunc(chess.GenerateLegalMoves(p), func(move chess.Move) bool {
+		return CastlesThroughCheck(p, move)
+	})
+}
+
+// CastlesThroughCheck reports whether move castles from p out of check or over a square the opponent attacks. The
+// square the king lands on is left to the usual test of whether a move leaves the mover in check.
+func CastlesThroughCheck(p *chess.Position, move chess.Move) bool {
+	from, to := move.FromSquare, move.ToSquare
+	if p.PieceAt(from).Type != chess.King || absDiff(int(from.File), int(to.File)) != 2 {
+		return false
+	}
+	if chess.IsCheck(p) {
+		return true
+	}
+	stepped := *p
+	stepped.Move(chess.Move{FromSquare: from, ToSquare: chess.Square{File: (from.File + to.File) / 2, Rank: from.Rank}})
+	stepped.Turn = p.Turn
+	return chess.IsCheck(&stepped)
+}
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestLegalMovesDropsCastlingThroughCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fen  string
+		move string
+		want bool
+	}{
+		{"transit attacked", "r3k2r/8/8/8/8/8/8/4KR2 b kq - 0 1", "e8g8", false},
+		{"other side free", "r3k2r/8/8/8/8/8/8/4KR2 b kq - 0 1", "e8c8", true},
+		{"queenside attacked", "r3k2r/8/8/8/8/8/8/3RK3 b kq - 0 1", "e8c8", false},
+		{"out of check", "r3k2r/8/8/8/8/8/8/4RK2 b kq - 0 1", "e8g8", false},
+		{"rook attacked", "r3k2r/8/8/8/8/8/8/4K2R b kq - 0 1", "e8g8", true},
+		{"white transit attacked", "3rk3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1c1", false},
+	} {
+		p := mustParseFen(t, tc.fen)
+		move, err := chess.ParseUCIMove(tc.move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := slices.Contains(LegalMoves(&p), move); got != tc.want {
+			t.Errorf("%s: LegalMoves(%s) contains %v = %v, want %v", tc.name, tc.fen, tc.move, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/brighamskarda/chess"
+)
+
+// Ponderer is an agent that can think on its opponent's time, keeping what it finds for its next search.
+type Ponderer interface {
+	// Predict returns the move its last search expects to be played from p, or the zero move if it has none.
+	Predict(p chess.Position) chess.Move
+	// Ponder searches p, the position the agent expects to move from next, until ctx is done. If p then comes up, the
+	// search of it carries on from that work.
+	Ponder(ctx context.Context, p chess.Position)
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// MoveSource says how an agent came up with a move.
+type MoveSource int
+
+const (
+	Search MoveSource = iota
+	Book
+	Tablebase
+)
+
+func (s MoveSource) String() string {
+	switch s {
+	case Search:
+		return "search"
+	case Book:
+		return "book"
+	case Tablebase:
+		return "tablebase"
+	}
+	return "unknown"
+}
+
+// SourcedAgent is an agent that can report where each of its moves came from.
+type SourcedAgent interface {
+	GetMoveSource(p chess.Position) (chess.Move, MoveSource)
+}
+
+// Mover is any agent.
+type Mover interface {
+	GetMove(p chess.Position) chess.Move
+}
+
+// GetMoveSource gets a move from a, along with its source if a is a SourcedAgent. Moves from other agents are taken to
+// come from Search.
+func GetMoveSource(a Mover, p chess.Position) (chess.Move, MoveSource) {
+	if sourced, ok := a.(SourcedAgent); ok {
+		return sourced.GetMoveSource(p)
+	}
+	return a.GetMove(p), Search
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+// openingBook is a SourcedAgent that plays its book move where it has one, and otherwise the first legal move as its
+// search.
+type openingBook map[string]chess.Move
+
+func (b openingBook) GetMove(p chess.Position) chess.Move {
+	move, _ := b.GetMoveSource(p)
+	return move
+}
+
+func (b openingBook) GetMoveSource(p chess.Position) (chess.Move, MoveSource) {
+	if move, ok := b[chess.GenerateFen(&p)]; ok {
+		return move, Book
+	}
+	return chess.GenerateLegalMoves(&p)[0], Search
+}
+
+// firstMove is an agent that does not report its sources.
+type firstMove struct{}
+
+func (firstMove) GetMove(p chess.Position) chess.Move {
+	return chess.GenerateLegalMoves(&p)[0]
+}
+
+func TestGetMoveSourceReportsBookAndSearch(t *testing.T) {
+	e4, err := chess.ParseUCIMove("e2e4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := openingBook{chess.DefaultFen: e4}
+	start := mustParseFen(t, chess.DefaultFen)
+	if move, source := GetMoveSource(book, start); move != e4 || source != Book {
+		t.Errorf("in book played %s from %s, want %s from book", move, source, e4)
+	}
+	offBook := mustParseFen(t, "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1")
+	if _, source := GetMoveSource(book, offBook); source != Search {
+		t.Errorf("off book the move came from %s, want search", source)
+	}
+	if _, source := GetMoveSource(firstMove{}, start); source != Search {
+		t.Errorf("an agent that does not report sources gave %s, want search", source)
+	}
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// TablebaseProber looks positions up in an endgame tablebase, such as the built-in tablebase.Mates or a Syzygy prober.
+type TablebaseProber interface {
+	// Probe returns the outcome of p for its side to move, with ok false if p is not in the tablebase. As in Syzygy
+	// tables, wdl is 2 for a win, 0 for a draw and -2 for a loss, with 1 and -1 for a win or loss the fifty-move rule
+	// turns into a draw. dtz is the number of half-moves to the next capture, pawn move or mate, negated when losing.
+	Probe(p chess.Position) (wdl int, dtz int, ok bool)
+}
+
+// TablebaseMove returns the move prober rates best from p, with true, if it has p and every position a move leads to.
+// A win is converted by the move that shortens dtz the most, and a loss drawn out by the move that lengthens it the
+// most. A nil prober has no positions.
+func TablebaseMove(prober TablebaseProber, p chess.Position) (chess.Move, bool) {
+	if prober == nil {
+		return chess.Move{}, false
+	}
+	if _, _, ok := prober.Probe(p); !ok {
+		return chess.Move{}, false
+	}
+
+	var best chess.Move
+	bestWdl, bestDtz := 0, 0
+	for i, move := range LegalMoves(&p) {
+		newPos := p
+		newPos.Move(move)
+		if chess.IsCheckMate(&newPos) {
+			return move, true
+		}
+		wdl, dtz, ok := prober.Probe(newPos)
+		if !ok {
+			return chess.Move{}, false
+		}
+		// The position after move is scored for the opponent, so the best move leaves the lowest wdl, and then the
+		// highest dtz: the nearest mate when the opponent loses, the furthest when it wins.
+		if i == 0 || wdl < bestWdl || (wdl == bestWdl && wdl != 0 && dtz > bestDtz) {
+			best, bestWdl, bestDtz = move, wdl, dtz
+		}
+	}
+	return best, best != (chess.Move{})
+}
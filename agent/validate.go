@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/brighamskarda/chess"
+)
+
+var (
+	ErrInvalidTurn     = errors.New("side to move is not white or black")
+	ErrKingCount       = errors.New("each side must have exactly one king")
+	ErrPawnCount       = errors.New("a side has more than 8 pawns")
+	ErrPieceCount      = errors.New("a side has more than 16 pieces")
+	ErrPawnRank        = errors.New("pawn on the first or last rank")
+	ErrAdjacentKings   = errors.New("kings are adjacent")
+	ErrOpponentInCheck = errors.New("side not to move is in check")
+)
+
+// ValidatePosition checks the basic invariants a position must satisfy before it can be searched. The returned error
+// wraps one of the Err values above.
+func ValidatePosition(p *chess.Position) error {
+	if p.Turn != chess.White && p.Turn != chess.Black {
+		return ErrInvalidTurn
+	}
+
+	kings := map[chess.Color]int{}
+	pawns := map[chess.Color]int{}
+	pieces := map[chess.Color]int{}
+	kingSquares := map[chess.Color]chess.Square{}
+	for _, square := range chess.AllSquares {
+		piece := p.PieceAt(square)
+		if piece.Type == chess.NoPieceType {
+			continue
+		}
+		pieces[piece.Color]++
+		switch piece.Type {
+		case chess.King:
+			kings[piece.Color]++
+			kingSquares[piece.Color] = square
+		case chess.Pawn:
+			pawns[piece.Color]++
+			if square.Rank == chess.Rank1 || square.Rank == chess.Rank8 {
+				return fmt.Errorf("%w: %s", ErrPawnRank, square)
+			}
+		}
+	}
+
+	for _, c := range []chess.Color{chess.White, chess.Black} {
+		if kings[c] != 1 {
+			return fmt.Errorf("%w: %s has %d", ErrKingCount, c, kings[c])
+		}
+		if pawns[c] > 8 {
+			return fmt.Errorf("%w: %s has %d", ErrPawnCount, c, pawns[c])
+		}
+		if pieces[c] > 16 {
+			return fmt.Errorf("%w: %s has %d", ErrPieceCount, c, pieces[c])
+		}
+	}
+
+	whiteKing, blackKing := kingSquares[chess.White], kingSquares[chess.Black]
+	if absDiff(int(whiteKing.File), int(blackKing.File)) <= 1 && absDiff(int(whiteKing.Rank), int(blackKing.Rank)) <= 1 {
+		return fmt.Errorf("%w: %s and %s", ErrAdjacentKings, whiteKing, blackKing)
+	}
+
+	opponentToMove := *p
+	if p.Turn == chess.White {
+		opponentToMove.Turn = chess.Black
+	} else {
+		opponentToMove.Turn = chess.White
+	}
+	if chess.IsCheck(&opponentToMove) {
+		return ErrOpponentInCheck
+	}
+	return nil
+}
+
+func absDiff(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+func TestValidatePosition(t *testing.T) {
+	for _, tc := range []struct {
+		fen  string
+		want error
+	}{
+		{chess.DefaultFen, nil},
+		{"4k3/8/8/8/8/8/8/8 w - - 0 1", ErrKingCount},
+		{"4k3/8/8/8/8/8/8/3KK3 w - - 0 1", ErrKingCount},
+		{"4k3/8/8/8/8/8/PPPPPPPP/P3K3 w - - 0 1", ErrPawnRank},
+		{"4k3/8/8/8/8/P7/PPPPPPPP/4K3 w - - 0 1", ErrPawnCount},
+		{"8/8/8/8/8/8/3k4/4K3 w - - 0 1", ErrAdjacentKings},
+		{"4k3/8/8/8/8/8/8/4KR2 w - - 0 1", nil},
+		{"4k3/8/8/8/8/8/8/4R1K1 w - - 0 1", ErrOpponentInCheck},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if err := ValidatePosition(&p); !errors.Is(err, tc.want) {
+			t.Errorf("ValidatePosition(%s) = %v, want %v", tc.fen, err, tc.want)
+		}
+	}
+}
+
+func TestCheckPositionWrapsValidateError(t *testing.T) {
+	p := mustParseFen(t, "8/8/8/8/8/8/3k4/4K3 w - - 0 1")
+	err := CheckPosition("test", &p)
+	var agentErr *AgentError
+	if !errors.As(err, &agentErr) || agentErr.Kind != InvalidPosition || !errors.Is(err, ErrAdjacentKings) {
+		t.Errorf("CheckPosition returned %v, want an InvalidPosition AgentError wrapping ErrAdjacentKings", err)
+	}
+}
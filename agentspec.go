@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/applechess.git/mcts"
+	"github.com/brighamskarda/applechess.git/minmax"
+	"github.com/brighamskarda/applechess.git/tablebase"
+)
+
+// stdinHuman is shared by both players so that neither reads ahead of the other's moves on stdin.
+var stdinHuman = NewHuman(os.Stdin)
+
+// parseAgentSpec builds an agent from a spec of the form name[:key=value,...], for example "ab:depth=4" or
+// "mcts:time=3,confidence=0.8". option is the depth for depth based agents and the time in seconds for time based
+// agents when the spec does not set one. An ab spec that sets a time, such as "ab:time=5", but no depth deepens until
+// the time is up.
+func parseAgentSpec(spec string, option int) (ChessAgent, error) {
+	name, optionList, _ := strings.Cut(spec, ":")
+	options, err := parseOptions(optionList)
+	if err != nil {
+		return nil, err
+	}
+
+	var agent ChessAgent
+	switch strings.ToLower(name) {
+	case "human":
+		human := stdinHuman
+		err = options.apply(map[string]func(string) error{
+			"hint": func(value string) error {
+				hint, err := strconv.ParseBool(value)
+				if hint {
+					human.hint = alphabeta.AlphaBeta{Table: &alphabeta.Table{}}
+				}
+				return err
+			},
+		})
+		agent = human
+	case "mcts":
+		m := mcts.Mcts{Duration: option}
+		err = options.apply(map[string]func(string) error{
+			"time":       intOption(&m.Duration),
+			"confidence": floatOption(&m.ConfidenceStop),
+			"sequential": boolOption(&m.Sequential),
+			"workers":    intOption(&m.Workers),
+			"threads":    intOption(&m.Workers),
+			"tablebase":  tablebaseOption(&m.Tablebase),
+			"strict":     boolOption(&m.StrictMoves),
+			"minvisits":  int64Option(&m.MinVisits),
+			"iterations": int64Option(&m.Iterations),
+			"seed":       uint64Option(&m.Seed),
+			"weights":    weightsOption(&m.Weights),
+			"reuse": func(value string) error {
+				reuse, err := strconv.ParseBool(value)
+				if reuse {
+					m.Tree = &mcts.Tree{}
+				}
+				return err
+			},
+			"rollouttemp": func(value string) error {
+				temperature, err := strconv.ParseFloat(value, 64)
+				m.Rollout = mcts.SoftmaxRollout{Temperature: temperature}
+				return err
+			},
+		})
+		if softmax, ok := m.Rollout.(mcts.SoftmaxRollout); ok {
+			softmax.Weights = m.Weights
+			m.Rollout = softmax
+		}
+		agent = m
+	case "minmax":
+		m := minmax.Minmax{Depth: option}
+		err = options.apply(map[string]func(string) error{
+			"depth":       intOption(&m.Depth),
+			"temperature": floatOption(&m.Temperature),
+			"margin":      floatOption(&m.SelectionMargin),
+			"seed":        uint64Option(&m.Seed),
+			"dither":      boolOption(&m.Dither),
+			"strict":      boolOption(&m.StrictMoves),
+			"weights":     weightsOption(&m.Weights),
+			"tablebase":   tablebaseOption(&m.Tablebase),
+		})
+		agent = m
+	case "ab":
+		ab := alphabeta.AlphaBeta{Depth: option}
+		err = options.apply(map[string]func(string) error{
+			"depth":       intOption(&ab.Depth),
+			"temperature": floatOption(&ab.Temperature),
+			"margin":      floatOption(&ab.SelectionMargin),
+			"seed":        uint64Option(&ab.Seed),
+			"dither":      boolOption(&ab.Dither),
+			"pseudolegal": boolOption(&ab.PseudoLegal),
+			"strict":      boolOption(&ab.StrictMoves),
+			"nodes":       uint64Option(&ab.MaxNodes),
+			"time":        secondsOption(&ab.MaxTime),
+			"fortress":    floatOption(&ab.FortressCap),
+			"contempt":    floatOption(&ab.Contempt),
+			"adaptive":    boolOption(&ab.AdaptiveContempt),
+			"stalemate":   floatOption(&ab.StalematePenalty),
+			"perpetual":   floatOption(&ab.RepetitionPenalty),
+			"weights":     weightsOption(&ab.Weights),
+			"nullmove":    boolOption(&ab.UseNullMove),
+			"tablebase":   tablebaseOption(&ab.Tablebase),
+			"reuse": func(value string) error {
+				reuse, err := strconv.ParseBool(value)
+				if reuse {
+					ab.Table = &alphabeta.Table{}
+				}
+				return err
+			},
+		})
+		if _, ok := options["depth"]; !ok && ab.MaxTime > 0 {
+			ab.Depth = 0 // Deepen until the time is up
+		}
+		agent = ab
+	default:
+		return nil, fmt.Errorf("unknown agent %q", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: %w", name, err)
+	}
+	return agent, nil
+}
+
+type agentOptions map[string]string
+
+func parseOptions(optionList string) (agentOptions, error) {
+	options := agentOptions{}
+	if optionList == "" {
+		return options, nil
+	}
+	for _, option := range strings.Split(optionList, ",") {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("option %q is not of the form key=value", option)
+		}
+		options[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return options, nil
+}
+
+// apply passes each option to its setter, and fails on options the agent does not have.
+func (options agentOptions) apply(setters map[string]func(string) error) error {
+	for key, value := range options {
+		set, ok := setters[key]
+		if !ok {
+			return fmt.Errorf("unknown option %q", key)
+		}
+		if err := set(value); err != nil {
+			return fmt.Errorf("option %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func intOption(field *int) func(string) error {
+	return func(value string) (err error) {
+		*field, err = strconv.Atoi(value)
+		return err
+	}
+}
+
+func int64Option(field *int64) func(string) error {
+	return func(value string) (err error) {
+		*field, err = strconv.ParseInt(value, 10, 64)
+		return err
+	}
+}
+
+func uint64Option(field *uint64) func(string) error {
+	return func(value string) (err error) {
+		*field, err = strconv.ParseUint(value, 10, 64)
+		return err
+	}
+}
+
+// secondsOption reads a duration given in seconds, which may be fractional.
+func secondsOption(field *time.Duration) func(string) error {
+	return func(value string) error {
+		seconds, err := strconv.ParseFloat(value, 64)
+		*field = time.Duration(seconds * float64(time.Second))
+		return err
+	}
+}
+
+func floatOption(field *float64) func(string) error {
+	return func(value string) (err error) {
+		*field, err = strconv.ParseFloat(value, 64)
+		return err
+	}
+}
+
+// weightsOption reads evaluation weights from the JSON file named by the value. Weights the file leaves out keep their
+// default values.
+func weightsOption(field **eval.Weights) func(string) error {
+	return func(value string) error {
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return err
+		}
+		w := eval.DefaultWeights
+		if err := json.Unmarshal(data, &w); err != nil {
+			return fmt.Errorf("could not parse weights %s: %w", value, err)
+		}
+		*field = &w
+		return nil
+	}
+}
+
+// tablebaseOption sets field to the built-in tablebase.Mates if the value is true.
+func tablebaseOption(field *agent.TablebaseProber) func(string) error {
+	return func(value string) error {
+		use, err := strconv.ParseBool(value)
+		if use {
+			*field = tablebase.Mates{}
+		}
+		return err
+	}
+}
+
+func boolOption(field *bool) func(string) error {
+	return func(value string) (err error) {
+		*field, err = strconv.ParseBool(value)
+		return err
+	}
+}
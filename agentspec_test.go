@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/applechess.git/mcts"
+	"github.com/brighamskarda/applechess.git/minmax"
+)
+
+func TestParseAgentSpec(t *testing.T) {
+	player, err := parseAgentSpec("ab:depth=4,temperature=0.5,nullmove=true", 2)
+	if ab, ok := player.(alphabeta.AlphaBeta); err != nil || !ok || ab.Depth != 4 || ab.Temperature != 0.5 ||
+		!ab.UseNullMove {
+		t.Errorf("ab:depth=4,temperature=0.5,nullmove=true parsed to %#v, %v", player, err)
+	}
+	player, err = parseAgentSpec("ab:time=5", 2)
+	if ab, ok := player.(alphabeta.AlphaBeta); err != nil || !ok || ab.Depth != 0 || ab.MaxTime != 5*time.Second {
+		t.Errorf("ab:time=5 parsed to %#v, %v, want no depth and 5s", player, err)
+	}
+	player, err = parseAgentSpec("mcts:time=3,workers=2", 1)
+	if m, ok := player.(mcts.Mcts); err != nil || !ok || m.Duration != 3 || m.Workers != 2 {
+		t.Errorf("mcts:time=3,workers=2 parsed to %#v, %v", player, err)
+	}
+	player, err = parseAgentSpec("mcts:time=3,threads=2", 1)
+	if m, ok := player.(mcts.Mcts); err != nil || !ok || m.Duration != 3 || m.Workers != 2 {
+		t.Errorf("mcts:time=3,threads=2 parsed to %#v, %v", player, err)
+	}
+	player, err = parseAgentSpec("MiniMax", 3)
+	if err == nil {
+		t.Errorf("MiniMax parsed to %#v, want an unknown agent error", player)
+	}
+	player, err = parseAgentSpec("Minmax", 3)
+	if m, ok := player.(minmax.Minmax); err != nil || !ok || m.Depth != 3 {
+		t.Errorf("Minmax parsed to %#v, %v, want the default depth 3", player, err)
+	}
+	if player, err = parseAgentSpec("human", 2); err != nil || player != stdinHuman {
+		t.Errorf("human parsed to %#v, %v", player, err)
+	}
+	player, err = parseAgentSpec("human:hint=true", 2)
+	if human, ok := player.(Human); err != nil || !ok || human.hint == nil || human.scanner != stdinHuman.scanner {
+		t.Errorf("human:hint=true parsed to %#v, %v, want a human reading stdin with a hint search", player, err)
+	}
+}
+
+func TestParseAgentSpecRejectsBadOptions(t *testing.T) {
+	for _, spec := range []string{"ab:depth", "ab:depth=x", "ab:speed=1", "mcts:depth=3", "ab:=4", "human:speed=1"} {
+		if player, err := parseAgentSpec(spec, 2); err == nil {
+			t.Errorf("%s parsed to %#v, want an error", spec, player)
+		}
+	}
+}
@@ -1,199 +1,957 @@
 package alphabeta
 
 import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
 	"math"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/applechess.git/metrics"
+	"github.com/brighamskarda/applechess.git/zobrist"
 	"github.com/brighamskarda/chess"
 )
 
 // AlphaBeta code inspired by code here https://en.wikipedia.org/wiki/Alpha%E2%80%93beta_pruning#Pseudocode
 type AlphaBeta struct {
-	Depth int
+	Depth   int
+	Weights *eval.Weights // nil uses eval.DefaultWeights
+	Metrics metrics.Sink  // Optional, receives statistics after each search
+
+	Temperature     float64 // Softmax temperature for sampling among root moves. 0 always plays the best move.
+	SelectionMargin float64 // When sampling, only moves within this many pawns of the best are considered
+	Seed            uint64  // Seeds the random choices of sampling and dithering, which are random if 0
+	Dither          bool    // Choose among root moves tied for best at random rather than always the first
+
+	PseudoLegal bool // Generate pseudo-legal moves and reject illegal ones after playing them
+	StrictMoves bool // Panic if the chosen move is not legal, to catch move encoding bugs
+
+	// MaxNodes stops the search after this many nodes, and the best move of the deepest iteration completed is played.
+	// With MaxNodes set, a Depth of 0 deepens without limit. 0 disables. It is ignored when sampling with Temperature or
+	// Dither.
+	MaxNodes uint64
+
+	// MaxTime stops the search once it has run this long, and the best move of the deepest iteration completed is
+	// played. No iteration is started once half of it has passed, since that one would rarely finish in the rest. With
+	// MaxTime set, a Depth of 0 deepens without limit. 0 disables. When sampling, which searches only to Depth, it
+	// limits the root moves scored to those finished in time, and the first legal move is played if none were.
+	MaxTime time.Duration
+
+	FortressCap float64 // Cap the reported advantage in positions the search cannot make progress in. 0 disables.
+
+	Contempt         float64 // Pawns the side to move gives up by accepting a draw, to steer away from drawn lines
+	AdaptiveContempt bool    // Scale Contempt down with the material left, so simplified equal positions accept draws
+
+	// StalematePenalty lowers the score of a stalemate by this many pawns, for the side to move at the root, when it
+	// starts the search more than winningAdvantage ahead, so it only stalemates if every other line is worse still.
+	// Mates always outscore it. 0 disables.
+	StalematePenalty float64
+
+	// RepetitionPenalty lowers the score of a repetition by this many pawns, for the side to move at the root, when the
+	// move repeating it gives check and that side starts the search more than winningAdvantage ahead in material, so
+	// a won position isn't given away to a perpetual check. 0 disables.
+	RepetitionPenalty float64
+
+	// History holds the positions of the game before the one searched, oldest first. A position repeating one of them,
+	// or one earlier in the line searched, scores as a draw, as do positions drawn under the fifty-move rule.
+	History []chess.Position
+
+	// Tablebase, if not nil, is probed before each search, and a position it has is played from its tables instead, so
+	// that the endgames it covers are won in as few moves as possible whatever the Depth.
+	Tablebase agent.TablebaseProber
+
+	NoTransposition bool // Search without the transposition table, which is otherwise kept for the length of a search
+	NoQuiescence    bool // Evaluate the horizon as it stands rather than first searching the captures from it
+	NoOrdering      bool // Try moves in generation order, to measure what move ordering gains with Stats.CutoffStats
+
+	// Table, if not nil, keeps the transposition table from one search to the next, so that each can reuse the work of
+	// those before it, pondering included. Give each player of a game its own Table. SaveTable and LoadTable keep it from
+	// one session to the next.
+	Table *Table
+
+	// UseNullMove prunes positions where passing the move would still fail high, searched at a reduced depth.
+	UseNullMove bool
 }
 
+// attackerTieBreak scales victim values when ordering captures, so that the attacker's value only orders captures of
+// equal victims.
+const attackerTieBreak = 100
+
+// winningAdvantage is the static evaluation, or material for RepetitionPenalty, in pawns, above which the side to move
+// counts as winning for StalematePenalty.
+const winningAdvantage = 3
+
+// maxDepth bounds iterative deepening when it has no Depth to stop at.
+const maxDepth = 64
+
+// fiftyMoveLimit is the number of half-moves without a capture or pawn move after which a position scores as a draw.
+const fiftyMoveLimit = 100
+
 func (ab AlphaBeta) GetMove(p chess.Position) chess.Move {
-	move, _ := search(p, ab.Depth, -math.MaxFloat64, math.MaxFloat64)
+	move, _ := ab.GetMoveStats(p)
 	return move
 }
 
-func search(p chess.Position, depth int, alpha float64, beta float64) (chess.Move, float64) {
-	if p.Turn == chess.White {
-		return max(&p, depth, alpha, beta)
+// Score searches p to Depth and returns its score from white's perspective.
+func (ab AlphaBeta) Score(p chess.Position) float64 {
+	if chess.IsCheckMate(&p) {
+		if p.Turn == chess.White {
+			return -eval.MateScore
+		}
+		return eval.MateScore
+	}
+	if chess.IsStaleMate(&p) {
+		return 0
+	}
+	_, stats := ab.GetMoveStats(p)
+	return stats.Score
+}
+
+// ScoreMove plays m from p and searches the result as GetMoveStats would search p to depth, returning the score from
+// white's perspective. It returns an error if p is invalid or m is not legal in it.
+func (ab AlphaBeta) ScoreMove(p chess.Position, m chess.Move, depth int) (float64, error) {
+	if err := agent.CheckPosition("alphabeta", &p); err != nil {
+		return 0, err
+	}
+	if !slices.Contains(agent.LegalMoves(&p), m) {
+		return 0, fmt.Errorf("%s is not a legal move in %s", m, chess.GenerateFen(&p))
+	}
+	s := newSearcher(ab, &p)
+	s.MaxNodes = 0
+	return s.scoreMove(p, m, depth, 0), nil
+}
+
+// Instability returns how far, in pawns, the static evaluation of p is from its score searched to depth. Large values
+// point at knowledge the evaluation is missing, such as a hanging piece. A mate found by the search makes it enormous.
+func (ab AlphaBeta) Instability(p chess.Position, depth int) float64 {
+	static := eval.Evaluate(&p, ab.Weights)
+	ab.Depth = depth
+	return math.Abs(ab.Score(p) - static)
+}
+
+// Stats describes the outcome of a search.
+type Stats struct {
+	Score  float64 // From white's perspective
+	MateIn int     // Moves until mate, positive if the side to move mates and negative if it gets mated. 0 if none found.
+	Nodes  uint64
+	Depth  int // Deepest search completed
+
+	Cutoffs          uint64 // Nodes where a move failed outside the window, ending the search of the node early
+	FirstMoveCutoffs uint64 // Cutoffs caused by the first move tried
+	CutoffIndexSum   uint64 // Sum over cutoffs of the index of the move that caused it in generation order
+	TableHits        uint64 // Positions whose score was taken from the transposition table
+	TableProbes      uint64 // Positions looked up in the transposition table
+	HashFull         int    // Thousandths of the transposition table in use at the end of the search
+	NullMoveCutoffs  uint64 // Positions pruned because passing the move still failed high
+
+	PV []chess.Move // The line the search expects, starting with the move chosen
+
+	Source agent.MoveSource // agent.Tablebase if the move was played from Tablebase, which leaves the counts at 0
+}
+
+// CutoffStats measures move ordering by the share of cutoffs caused by the first move tried, and the average index of
+// the move causing a cutoff. Better ordering raises the first and lowers the second. Both are 0 without cutoffs.
+func (st Stats) CutoffStats() (firstMoveCutoffRate float64, avgCutoffIndex float64) {
+	if st.Cutoffs == 0 {
+		return 0, 0
+	}
+	return float64(st.FirstMoveCutoffs) / float64(st.Cutoffs), float64(st.CutoffIndexSum) / float64(st.Cutoffs)
+}
+
+// TTHitRate returns the share of transposition table lookups that settled their position, or 0 without lookups.
+func (st Stats) TTHitRate() float64 {
+	if st.TableProbes == 0 {
+		return 0
+	}
+	return float64(st.TableHits) / float64(st.TableProbes)
+}
+
+// Analyze searches p as GetMove does and returns the best move, its score from white's perspective and the principal
+// variation, the line the search expects starting with the best move.
+func (ab AlphaBeta) Analyze(p chess.Position) (chess.Move, float64, []chess.Move) {
+	move, stats := ab.GetMoveStats(p)
+	return move, stats.Score, stats.PV
+}
+
+// GetMoveStats is GetMove, but also reports the score and other statistics of the search.
+func (ab AlphaBeta) GetMoveStats(p chess.Position) (chess.Move, Stats) {
+	move, stats, err := ab.getMoveStats(context.Background(), p)
+	if err != nil {
+		slog.Error("agent could not move", "err", err)
+	}
+	return move, stats
+}
+
+// GetMoveStatsContext is GetMoveStats, but stops searching once ctx is done as GetMoveContext does, returning its error.
+func (ab AlphaBeta) GetMoveStatsContext(ctx context.Context, p chess.Position) (chess.Move, Stats, error) {
+	return ab.getMoveStats(ctx, p)
+}
+
+// GetMoveContext is GetMove, but stops searching once ctx is done and returns the best move of the deepest iteration
+// completed, or of the root moves searched in full if not even the first iteration completed. It returns an
+// *agent.AgentError if p is invalid, the search fails, or it was cancelled before any move was searched in full, except
+// when sampling with Temperature or Dither, which then plays the first legal move.
+func (ab AlphaBeta) GetMoveContext(ctx context.Context, p chess.Position) (chess.Move, error) {
+	move, _, err := ab.getMoveStats(ctx, p)
+	return move, err
+}
+
+func (ab AlphaBeta) getMoveStats(ctx context.Context, p chess.Position) (chess.Move, Stats, error) {
+	if err := agent.CheckPosition("alphabeta", &p); err != nil {
+		return chess.Move{}, Stats{}, err
+	}
+	if move, ok := agent.TablebaseMove(ab.Tablebase, p); ok {
+		return move, tablebaseStats(ab.Tablebase, p, move), nil
+	}
+	s := newSearcher(ab, &p)
+	s.ctx = ctx
+	startTime := time.Now()
+	var move chess.Move
+	var score float64
+	if ab.MaxTime > 0 {
+		var cancel context.CancelFunc
+		s.ctx, cancel = context.WithTimeout(ctx, ab.MaxTime)
+		defer cancel()
+		s.softDeadline = startTime.Add(ab.MaxTime / 2)
+	}
+	err := agent.RunSearch("alphabeta", &p, func() {
+		if ab.Temperature > 0 || ab.Dither {
+			s.MaxNodes = 0
+			move, score = s.sampleRootMove(p)
+		} else {
+			move, score = s.deepen(p)
+		}
+	})
+	if err != nil {
+		return chess.Move{}, Stats{}, err
+	}
+	s.ctx = ctx
+	if move == (chess.Move{}) && ctx.Err() != nil {
+		return move, Stats{}, &agent.AgentError{Kind: agent.Cancelled, Agent: "alphabeta", Fen: chess.GenerateFen(&p), Err: ctx.Err()}
+	}
+	if ab.FortressCap > 0 && ab.Temperature == 0 && !ab.Dither && ctx.Err() == nil {
+		score = s.capFortress(p, score)
+	}
+	s.report(time.Since(startTime))
+	if ab.StrictMoves {
+		agent.CheckMove(&p, move)
+	}
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		logRefutation(AlphaBeta{Depth: s.Depth, Weights: ab.Weights, PseudoLegal: ab.PseudoLegal}, p, move)
+	}
+
+	mateIn := eval.MateIn(score)
+	if p.Turn == chess.Black {
+		mateIn = -mateIn
+	}
+	stats := Stats{
+		Score:            score,
+		MateIn:           mateIn,
+		Nodes:            s.nodes,
+		Depth:            s.Depth,
+		Cutoffs:          s.cutoffs,
+		FirstMoveCutoffs: s.firstMoveCutoffs,
+		CutoffIndexSum:   s.cutoffIndexSum,
+		TableHits:        s.tableHits,
+		TableProbes:      s.tableProbes,
+		HashFull:         s.table.HashFull(),
+		NullMoveCutoffs:  s.nullMoveCutoffs,
+		PV:               s.principalVariation(p, move),
+	}
+	slog.Info("alphabeta search finished", "move", move, "depth", stats.Depth, "nodes", stats.Nodes,
+		"tt_hit_rate", stats.TTHitRate())
+	return move, stats, nil
+}
+
+// tablebaseStats describes move, chosen from p by prober, scoring p as a mate in its dtz half-moves when prober has it
+// won or lost. That is exact for endgames like those of tablebase.Mates, where nothing is captured on the way to mate.
+func tablebaseStats(prober agent.TablebaseProber, p chess.Position, move chess.Move) Stats {
+	var score float64
+	switch wdl, dtz, _ := prober.Probe(p); wdl {
+	case 2:
+		score = eval.MateScore - float64(dtz)
+	case -2:
+		score = -eval.MateScore - float64(dtz)
+	}
+	mateIn := eval.MateIn(score)
+	if p.Turn == chess.Black {
+		score = -score
+	}
+	return Stats{Score: score, MateIn: mateIn, PV: []chess.Move{move}, Source: agent.Tablebase}
+}
+
+type searcher struct {
+	AlphaBeta
+	nodes           uint64
+	aborted         bool // Set once MaxNodes is exceeded or ctx is done, after which search results are incomplete
+	ctx             context.Context
+	rootMove        chess.Move // Tried first at the root, from the previous iteration of deepen
+	table           *Table     // Table, or one of its own without it
+	generation      uint8      // Of the Table searched with, to age what is stored
+	tableHits       uint64
+	tableProbes     uint64
+	inNullMove      bool // Set while the reply to a null move is searched
+	nullMoveCutoffs uint64
+	stalemateScore  float64     // Score of a stalemate from white's perspective, set from Contempt and StalematePenalty
+	drawScore       float64     // Score of a repetition or fifty-move draw from white's perspective, set from Contempt
+	perpetualScore  float64     // drawScore less RepetitionPenalty, for repetitions the root side gives check into
+	rootTurn        chess.Color // Side to move at the root
+	path            []uint64    // Hashes of History and of the positions from the root to the one being searched
+	softDeadline    time.Time   // Once passed, deepen starts no further iteration. Zero for none.
+
+	// rootBiases adds eval.RepeatedMinorMove to the scores of the root moves it applies to, from white's perspective.
+	rootBiases map[chess.Move]float64
+
+	cutoffs, firstMoveCutoffs, cutoffIndexSum uint64
+}
+
+// newSearcher prepares a search of root with ab.
+func newSearcher(ab AlphaBeta, root *chess.Position) searcher {
+	if ab.Weights == nil {
+		ab.Weights = &eval.DefaultWeights
+	}
+	contempt := ab.Contempt
+	if ab.AdaptiveContempt {
+		contempt *= eval.MaterialPhase(root)
+	}
+	penalty := 0.0
+	if advantage := eval.Evaluate(root, ab.Weights); math.Abs(advantage) > winningAdvantage &&
+		(advantage > 0) == (root.Turn == chess.White) {
+		penalty = ab.StalematePenalty
+	}
+	perpetual := -contempt
+	if material := eval.Material(root, ab.Weights); math.Abs(material) > winningAdvantage &&
+		(material > 0) == (root.Turn == chess.White) {
+		perpetual -= ab.RepetitionPenalty
+	}
+	draw, stalemate := -contempt, -contempt-penalty
+	if root.Turn == chess.Black {
+		draw, stalemate, perpetual = -draw, -stalemate, -perpetual
+	}
+	path := make([]uint64, 0, len(ab.History)+1)
+	for i := range ab.History {
+		path = append(path, zobrist.Hash(&ab.History[i]))
+	}
+	path = append(path, zobrist.Hash(root))
+	var biases map[chess.Move]float64
+	if ab.Weights.RepeatedMinorMove != 0 {
+		biases = map[chess.Move]float64{}
+		for _, move := range agent.LegalMoves(root) {
+			if bias := eval.RepeatedMinorMove(ab.History, root, move, ab.Weights); bias != 0 {
+				biases[move] = bias
+			}
+		}
+	}
+	table := ab.Table
+	if table == nil {
+		table = &Table{}
+	}
+	generation := table.newGeneration()
+	return searcher{
+		AlphaBeta:      ab,
+		stalemateScore: stalemate,
+		drawScore:      draw,
+		perpetualScore: perpetual,
+		rootTurn:       root.Turn,
+		rootBiases:     biases,
+		path:           path,
+		ctx:            context.Background(),
+		table:          table,
+		generation:     generation,
+	}
+}
+
+func (s *searcher) report(elapsed time.Duration) {
+	if s.Metrics == nil {
+		return
+	}
+	s.Metrics.Add(metrics.Nodes, float64(s.nodes))
+	s.Metrics.Set(metrics.Depth, float64(s.Depth))
+	if s.tableProbes > 0 {
+		s.Metrics.Set(metrics.TTHitRate, float64(s.tableHits)/float64(s.tableProbes))
+	}
+	if elapsed > 0 {
+		s.Metrics.Set(metrics.NPS, float64(s.nodes)/elapsed.Seconds())
+	}
+}
+
+// logRefutation logs the line the search expects after the best root move other than best.
+func logRefutation(ab AlphaBeta, p chess.Position, best chess.Move) {
+	s := newSearcher(ab, &p)
+	alternative := chess.Move{}
+	alternativeScore := 0.0
+	for _, move := range agent.LegalMoves(&p) {
+		if move == best {
+			continue
+		}
+		score := s.scoreMove(p, move, ab.Depth, 0)
+		if alternative == (chess.Move{}) || (p.Turn == chess.White && score > alternativeScore) ||
+			(p.Turn == chess.Black && score < alternativeScore) {
+			alternative = move
+			alternativeScore = score
+		}
+	}
+	if alternative == (chess.Move{}) {
+		return
+	}
+
+	newPos := p
+	newPos.Move(alternative)
+	var refutation []string
+	if ab.Depth > 0 {
+		for _, move := range s.line(newPos, ab.Depth-1, 1) {
+			refutation = append(refutation, move.String())
+		}
+	}
+	slog.Debug("alphabeta rejected move", "move", alternative, "score", alternativeScore,
+		"refutation", strings.Join(refutation, " "))
+}
+
+// deepen searches p one ply deeper at a time until Depth is reached, the search is stopped or softDeadline has passed,
+// trying the best move of each iteration first in the next. It returns the result of the deepest completed iteration,
+// or the best move found so far if not even the first one completed. Deepening stops early once a mate is found. Depth
+// is updated to the depth completed.
+func (s *searcher) deepen(p chess.Position) (chess.Move, float64) {
+	limit := s.Depth
+	if limit <= 0 && (s.MaxNodes > 0 || s.MaxTime > 0) {
+		limit = maxDepth
+	}
+	s.Depth = 0
+	var move chess.Move
+	var score float64
+	for depth := 0; depth <= limit; depth++ {
+		iterationMove, iterationScore := s.search(p, depth, 0, -math.MaxFloat64, math.MaxFloat64)
+		if s.aborted {
+			if depth == 0 {
+				move, score = iterationMove, iterationScore
+			}
+			break
+		}
+		move, score = iterationMove, iterationScore
+		s.Depth = depth
+		s.rootMove = move
+		if !s.NoTransposition {
+			// Only positions below the root are stored as they are searched. This keeps the best move of p so far,
+			// for Predict to give while p is still being searched.
+			s.store(zobrist.Hash(&p), depth, 0, -math.MaxFloat64, math.MaxFloat64, move, score)
+		}
+		if eval.IsMateScore(score) || (!s.softDeadline.IsZero() && time.Now().After(s.softDeadline)) {
+			break
+		}
+	}
+	return move, score
+}
+
+// capFortress caps score, the result of searching p to Depth, at FortressCap if p looks like a fortress. That is
+// when the defending side still has a piece, the score has stayed flat over the last three depths, and the line the
+// search expects neither trades nor wins material, so deeper search is not finding progress.
+func (s *searcher) capFortress(p chess.Position, score float64) float64 {
+	const flatness = 0.25
+
+	if s.Depth < 2 || eval.IsMateScore(score) || math.Abs(score) <= s.FortressCap {
+		return score
+	}
+	defender := chess.Black
+	if score < 0 {
+		defender = chess.White
+	}
+	if !hasPiece(&p, defender) {
+		return score
+	}
+	s.MaxNodes = 0
+	s.aborted = false
+	for depth := s.Depth - 2; depth < s.Depth; depth++ {
+		_, shallowScore := s.search(p, depth, 0, -math.MaxFloat64, math.MaxFloat64)
+		if math.Abs(shallowScore-score) > flatness {
+			return score
+		}
+	}
+
+	end := p
+	for _, move := range s.line(p, s.Depth, 0) {
+		end.Move(move)
+	}
+	if eval.MaterialBalance(&end) != eval.MaterialBalance(&p) ||
+		eval.PieceCount(&end, chess.White)+eval.PieceCount(&end, chess.Black) !=
+			eval.PieceCount(&p, chess.White)+eval.PieceCount(&p, chess.Black) {
+		return score
+	}
+	return math.Copysign(s.FortressCap, score)
+}
+
+// cutoff records a cutoff caused by the move at index i.
+func (s *searcher) cutoff(i int) {
+	s.cutoffs++
+	if i == 0 {
+		s.firstMoveCutoffs++
+	}
+	s.cutoffIndexSum += uint64(i)
+}
+
+// stopped marks the search aborted once it has visited more than MaxNodes nodes or its context is done.
+func (s *searcher) stopped() bool {
+	if (s.MaxNodes > 0 && s.nodes > s.MaxNodes) || s.ctx.Err() != nil {
+		s.aborted = true
+	}
+	return s.aborted
+}
+
+// sampleRootMove scores every root move with a full window and samples one according to Temperature and
+// SelectionMargin, or among the tied best moves when only Dither is set.
+func (s *searcher) sampleRootMove(p chess.Position) (chess.Move, float64) {
+	moves := agent.LegalMoves(&p)
+	scores := make([]float64, len(moves))
+	for i, move := range moves {
+		scores[i] = s.scoreMove(p, move, s.Depth, 0)
+		if s.aborted {
+			// Cancelled, so sample among the moves scored in full.
+			moves, scores = moves[:i], scores[:i]
+			break
+		}
+		if p.Turn == chess.Black {
+			scores[i] = -scores[i]
+		}
 	}
+	if len(moves) == 0 {
+		// Stopped before any move was scored, so play the first rather than none.
+		first := agent.LegalMoves(&p)[0]
+		return first, eval.Evaluate(&p, s.Weights)
+	}
+	margin, temperature := s.SelectionMargin, s.Temperature
+	if temperature == 0 {
+		// Dither alone, so pick uniformly among the moves tied for best.
+		margin, temperature = 0, 1
+	}
+	move, score := agent.SampleMove(moves, scores, margin, temperature, agent.MoveRand(s.Seed, &p))
 	if p.Turn == chess.Black {
-		return min(&p, depth, alpha, beta)
+		score = -score
 	}
-	return chess.Move{}, 0
+	return move, score
 }
 
-func min(p *chess.Position, depth int, alpha float64, beta float64) (chess.Move, float64) {
+// scoreMove returns the score of the position reached by playing move from p, when p is searched to depth.
+func (s *searcher) scoreMove(p chess.Position, move chess.Move, depth int, ply int) float64 {
+	p.Move(move)
+	s.nodes++
+	if chess.IsCheckMate(&p) {
+		return eval.MatedScore(&p, ply+1)
+	}
+	if chess.IsStaleMate(&p) {
+		return s.stalemateScore
+	}
+	if depth == 0 {
+		if score, ok := s.drawn(&p, zobrist.Hash(&p)); ok {
+			return score
+		}
+		return s.quiesce(&p, ply+1, 0, -math.MaxFloat64, math.MaxFloat64) + s.rootBias(ply, move)
+	}
+	_, score := s.search(p, depth-1, ply+1, -math.MaxFloat64, math.MaxFloat64)
+	return score + s.rootBias(ply, move)
+}
+
+// rootBias returns what is added to the score of move, from white's perspective, when it is played at the root.
+func (s *searcher) rootBias(ply int, move chess.Move) float64 {
+	if ply > 0 {
+		return 0
+	}
+	return s.rootBiases[move]
+}
+
+// principalVariation returns the line the search expects from p, starting with move and followed by the moves the
+// transposition table holds for the positions after it. It is at most Depth+1 moves long, ending early at a position the
+// table has no legal move for. Without the table, the line is searched again instead.
+func (s *searcher) principalVariation(p chess.Position, move chess.Move) []chess.Move {
+	if move == (chess.Move{}) {
+		return nil
+	}
+	pv := []chess.Move{move}
+	p.Move(move)
+	if s.NoTransposition {
+		return append(pv, s.line(p, s.Depth-1, 1)...)
+	}
+	for len(pv) <= s.Depth {
+		entry, ok := s.table.get(zobrist.Hash(&p))
+		if !ok || !slices.Contains(agent.LegalMoves(&p), entry.move) {
+			break
+		}
+		pv = append(pv, entry.move)
+		p.Move(entry.move)
+	}
+	return pv
+}
+
+// line returns the sequence of best moves the search expects from p.
+func (s *searcher) line(p chess.Position, depth int, ply int) []chess.Move {
+	line := []chess.Move{}
+	for ; depth >= 0; depth-- {
+		move, _ := s.search(p, depth, ply, -math.MaxFloat64, math.MaxFloat64)
+		if move == (chess.Move{}) {
+			break
+		}
+		line = append(line, move)
+		p.Move(move)
+		ply++
+	}
+	return line
+}
+
+// search returns the best move from p and its score, searched to depth. Below the root, positions searched before are
+// looked up in the transposition table.
+func (s *searcher) search(p chess.Position, depth int, ply int, alpha float64, beta float64) (chess.Move, float64) {
+	var key uint64
+	if ply > 0 {
+		key = zobrist.Hash(&p)
+		if score, ok := s.drawn(&p, key); ok {
+			return chess.Move{}, score
+		}
+		s.path = append(s.path, key)
+		defer func() { s.path = s.path[:len(s.path)-1] }()
+	}
+	useTable := ply > 0 && !s.NoTransposition
+	if useTable {
+		s.tableProbes++
+		if move, score, ok := s.probe(key, depth, ply, alpha, beta); ok {
+			s.tableHits++
+			return move, score
+		}
+	}
+
+	var first chess.Move
+	if ply == 0 {
+		first = s.rootMove
+	} else if useTable {
+		entry, _ := s.table.get(key)
+		first = entry.move
+	}
+	var move chess.Move
+	var score float64
+	if p.Turn == chess.White {
+		move, score = s.max(&p, depth, ply, alpha, beta, first)
+	} else if p.Turn == chess.Black {
+		move, score = s.min(&p, depth, ply, alpha, beta, first)
+	}
+	if useTable && !s.aborted && move != (chess.Move{}) {
+		s.store(key, depth, ply, alpha, beta, move, score)
+	}
+	return move, score
+}
+
+// min returns the move from p, with black to move, that minimizes the score searched to depth, trying first before the
+// others.
+func (s *searcher) min(p *chess.Position, depth int, ply int, alpha float64, beta float64,
+	first chess.Move) (chess.Move, float64) {
 	if depth == 0 {
 		lowestScore := math.MaxFloat64
 		bestMove := chess.Move{}
-		for _, move := range chess.GenerateLegalMoves(p) {
+		mateFound := false // Once a move mates, only other mates need looking at
+		for i, move := range s.moves(p, first) {
 			newPos := *p
 			newPos.Move(move)
-			score := evaluate(&newPos)
+			if s.illegal(p, &newPos, move) {
+				continue
+			}
+			s.nodes++
+			if s.stopped() {
+				break
+			}
+			var score float64
+			if chess.IsCheckMate(&newPos) {
+				score = eval.MatedScore(&newPos, ply+1)
+				mateFound = true
+			} else if mateFound {
+				continue
+			} else if drawScore, ok := s.drawn(&newPos, zobrist.Hash(&newPos)); ok {
+				score = drawScore
+			} else {
+				bias := s.rootBias(ply, move)
+				score = s.quiesce(&newPos, ply+1, 0, alpha-bias, min(beta, lowestScore)-bias) + bias
+			}
+			if s.aborted {
+				break
+			}
 			if score < lowestScore {
 				lowestScore = score
 				bestMove = move
 			}
 			if lowestScore < alpha {
+				s.cutoff(i)
 				break
 			}
 		}
 		return bestMove, lowestScore
 	}
+	if score, ok := s.nullMove(p, depth, ply, alpha, beta); ok {
+		return chess.Move{}, score
+	}
 	lowestScore := math.MaxFloat64
 	bestMove := chess.Move{}
-	for _, move := range chess.GenerateLegalMoves(p) {
+	mateFound := false
+	for i, move := range s.moves(p, first) {
 		newPos := *p
 		newPos.Move(move)
+		if s.illegal(p, &newPos, move) {
+			continue
+		}
+		s.nodes++
+		if s.stopped() {
+			break
+		}
+		score := s.stalemateScore
 		if chess.IsCheckMate(&newPos) {
-			return move, -math.MaxFloat64
-		} else if chess.IsStaleMate(&newPos) && lowestScore > 0 {
-			lowestScore = 0
+			score = eval.MatedScore(&newPos, ply+1)
+			mateFound = true
+		} else if mateFound {
+			continue
+		} else if !chess.IsStaleMate(&newPos) {
+			bias := s.rootBias(ply, move)
+			_, score = s.search(newPos, depth-1, ply+1, alpha-bias, beta-bias)
+			score += bias
+		}
+		if s.aborted {
+			break
+		}
+		if score < lowestScore {
+			lowestScore = score
 			bestMove = move
-		} else {
-			_, score := search(newPos, depth-1, alpha, beta)
-			if score < lowestScore {
-				lowestScore = score
-				bestMove = move
-			}
-			if lowestScore < alpha {
-				break
-			}
-			if lowestScore < beta {
-				beta = lowestScore
-			}
+		}
+		if lowestScore < alpha {
+			s.cutoff(i)
+			break
+		}
+		if lowestScore < beta {
+			beta = lowestScore
 		}
 	}
 	return bestMove, lowestScore
 }
 
-func max(p *chess.Position, depth int, alpha float64, beta float64) (chess.Move, float64) {
+// max is min for white, maximizing the score.
+func (s *searcher) max(p *chess.Position, depth int, ply int, alpha float64, beta float64,
+	first chess.Move) (chess.Move, float64) {
 	if depth == 0 {
 		highestScore := -math.MaxFloat64
 		bestMove := chess.Move{}
-		for _, move := range chess.GenerateLegalMoves(p) {
+		mateFound := false
+		for i, move := range s.moves(p, first) {
 			newPos := *p
 			newPos.Move(move)
-			score := evaluate(&newPos)
+			if s.illegal(p, &newPos, move) {
+				continue
+			}
+			s.nodes++
+			if s.stopped() {
+				break
+			}
+			var score float64
+			if chess.IsCheckMate(&newPos) {
+				score = eval.MatedScore(&newPos, ply+1)
+				mateFound = true
+			} else if mateFound {
+				continue
+			} else if drawScore, ok := s.drawn(&newPos, zobrist.Hash(&newPos)); ok {
+				score = drawScore
+			} else {
+				bias := s.rootBias(ply, move)
+				score = s.quiesce(&newPos, ply+1, 0, max(alpha, highestScore)-bias, beta-bias) + bias
+			}
+			if s.aborted {
+				break
+			}
 			if score > highestScore {
 				highestScore = score
 				bestMove = move
 			}
 			if highestScore > beta {
+				s.cutoff(i)
 				break
 			}
 		}
 		return bestMove, highestScore
 	}
+	if score, ok := s.nullMove(p, depth, ply, alpha, beta); ok {
+		return chess.Move{}, score
+	}
 	highestScore := -math.MaxFloat64
 	bestMove := chess.Move{}
-	for _, move := range chess.GenerateLegalMoves(p) {
+	mateFound := false
+	for i, move := range s.moves(p, first) {
 		newPos := *p
 		newPos.Move(move)
+		if s.illegal(p, &newPos, move) {
+			continue
+		}
+		s.nodes++
+		if s.stopped() {
+			break
+		}
+		score := s.stalemateScore
 		if chess.IsCheckMate(&newPos) {
-			return move, math.MaxFloat64
-		} else if chess.IsStaleMate(&newPos) && highestScore < 0 {
-			highestScore = 0
+			score = eval.MatedScore(&newPos, ply+1)
+			mateFound = true
+		} else if mateFound {
+			continue
+		} else if !chess.IsStaleMate(&newPos) {
+			bias := s.rootBias(ply, move)
+			_, score = s.search(newPos, depth-1, ply+1, alpha-bias, beta-bias)
+			score += bias
+		}
+		if s.aborted {
+			break
+		}
+		if score > highestScore {
+			highestScore = score
 			bestMove = move
-		} else {
-			_, score := search(newPos, depth-1, alpha, beta)
-			if score > highestScore {
-				highestScore = score
-				bestMove = move
-			}
-			if highestScore > beta {
-				break
-			}
-			if highestScore > alpha {
-				alpha = highestScore
-			}
+		}
+		if highestScore > beta {
+			s.cutoff(i)
+			break
+		}
+		if highestScore > alpha {
+			alpha = highestScore
 		}
 	}
 	return bestMove, highestScore
 }
 
-func evaluate(p *chess.Position) float64 {
-	total := sumMaterial(p)
-	total += float64(numPseudoLegalChecks(p)) * 0.2
-	return total
+// evaluateLeaf statically scores a position at the search horizon. Stalemate is only looked for when the side to move
+// has few pieces left, since it is rare otherwise and finding it means generating the leaf's legal moves.
+func (s *searcher) evaluateLeaf(p *chess.Position) float64 {
+	if eval.PieceCount(p, p.Turn) <= eval.StaleMatePieces && chess.IsStaleMate(p) {
+		return s.stalemateScore
+	}
+	return eval.Evaluate(p, s.Weights)
 }
 
-func sumMaterial(p *chess.Position) float64 {
-	totalValue := 0.0
-	for _, piece := range p.Board {
-		totalValue += getPieceValue(piece)
-	}
-	return totalValue
-}
-
-func getPieceValue(p chess.Piece) float64 {
-	const pawn = 1
-	const rook = 5
-	const knight = 2.9
-	const bishop = 3
-	const queen = 8
-	const king = 10000
-
-	var val float64
-	switch p.Type {
-	case chess.Pawn:
-		val = pawn
-	case chess.Rook:
-		val = rook
-	case chess.Knight:
-		val = knight
-	case chess.Bishop:
-		val = bishop
-	case chess.Queen:
-		val = queen
-	case chess.King:
-		val = king
-	default:
-		val = 0
-	}
-	if p.Color == chess.White {
-		return val
+// moves returns the moves to try from p, best first as far as can be told before searching them: first, if it is one
+// of them, then captures and promotions by MVV-LVA, most valuable victim first and least valuable attacker among
+// equals, then the quiet moves in generation order. With NoOrdering set they are all in generation order. With
+// PseudoLegal set they are only pseudo-legal, and each must be checked with illegal once played.
+func (s *searcher) moves(p *chess.Position, first chess.Move) []chess.Move {
+	var moves []chess.Move
+	if s.PseudoLegal {
+		moves = chess.GeneratePseudoLegalMoves(p)
 	} else {
-		return -val
+		moves = agent.LegalMoves(p)
+	}
+	if s.NoOrdering {
+		return moves
+	}
+	keys := make([]float64, len(moves))
+	for i, move := range moves {
+		switch {
+		case move == first:
+			keys[i] = math.Inf(1)
+		case isNoisy(p, move):
+			// Captures that lose the exchange go after the rest, which all have positive keys, but before quiet moves.
+			if see := eval.SEE(p, move, s.Weights); see < 0 {
+				keys[i] = see
+				break
+			}
+			keys[i] = gain(p, move, s.Weights)*attackerTieBreak - pieceValue(p.PieceAt(move.FromSquare), s.Weights)
+		default:
+			keys[i] = math.Inf(-1)
+		}
 	}
+	order := make([]int, len(moves))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(keys[b], keys[a]) })
+	ordered := make([]chess.Move, len(moves))
+	for i, index := range order {
+		ordered[i] = moves[index]
+	}
+	return ordered
 }
 
-func numPseudoLegalChecks(p *chess.Position) int {
-	origTurn := p.Turn
+// drawn reports whether p, hashing to key, is a draw by the fifty-move rule or repeats a position in s.path, and
+// returns its score. A repetition the root side reaches by giving check scores perpetualScore.
+func (s *searcher) drawn(p *chess.Position, key uint64) (float64, bool) {
+	switch {
+	case p.HalfMove >= fiftyMoveLimit:
+		return s.drawScore, true
+	case !zobrist.Repeated(s.path, key, p.HalfMove):
+		return 0, false
+	case p.Turn != s.rootTurn && chess.IsCheck(p):
+		return s.perpetualScore, true
+	}
+	return s.drawScore, true
+}
 
-	total := 0
-	p.Turn = chess.White
-	blackKing := findKing(p, chess.Black)
-	pLegalMoves := chess.GeneratePseudoLegalMoves(p)
-	for _, move := range pLegalMoves {
-		if move.ToSquare == blackKing {
-			total++
-		}
+// illegal reports whether move, played from p to reach newPos, left the mover's king in check or castled out of or
+// through check.
+// It is always false unless PseudoLegal is set, since the moves are then already legal.
+func (s *searcher) illegal(p *chess.Position, newPos *chess.Position, move chess.Move) bool {
+	if !s.PseudoLegal {
+		return false
+	}
+	moverToMove := *newPos
+	moverToMove.Turn = p.Turn
+	if chess.IsCheck(&moverToMove) {
+		return true
 	}
+	return agent.CastlesThroughCheck(p, move)
+}
 
-	p.Turn = chess.Black
-	whiteKing := findKing(p, chess.White)
-	pLegalMoves = chess.GeneratePseudoLegalMoves(p)
-	for _, move := range pLegalMoves {
-		if move.ToSquare == whiteKing {
-			total--
+// hasPiece reports whether c has anything besides its king and pawns.
+func hasPiece(p *chess.Position, c chess.Color) bool {
+	for _, piece := range p.Board {
+		if piece.Color == c && piece.Type != chess.King && piece.Type != chess.Pawn && piece.Type != chess.NoPieceType {
+			return true
 		}
 	}
+	return false
+}
 
-	p.Turn = origTurn
-	return total
+// TreeNode is a move of a SearchTree and the score the search gives it, from white's perspective. The root has no
+// move.
+type TreeNode struct {
+	Move     string      `json:"move,omitempty"` // In UCI notation
+	Score    float64     `json:"score"`
+	Children []*TreeNode `json:"children,omitempty"` // Best first for the side to move
+
+	move chess.Move
 }
 
-func findKing(p *chess.Position, c chess.Color) chess.Square {
-	for _, square := range chess.AllSquares {
-		piece := p.PieceAt(square)
-		if piece.Type == chess.King && piece.Color == c {
-			return square
+// SearchTree returns the top of the tree GetMoveStats searches when p is searched to depth: the topN best moves from
+// p, and below the best of them its topN best replies, and so on along the best line for depth+1 plies. It returns an
+// error if topN is less than 1, and an *agent.AgentError if p is invalid or has no legal moves.
+func (ab AlphaBeta) SearchTree(p chess.Position, depth int, topN int) (*TreeNode, error) {
+	if topN < 1 {
+		return nil, fmt.Errorf("topN must be at least 1, got %d", topN)
+	}
+	if err := agent.CheckPosition("alphabeta", &p); err != nil {
+		return nil, err
+	}
+	s := newSearcher(ab, &p)
+	s.MaxNodes = 0
+	_, score := s.search(p, depth, 0, -math.MaxFloat64, math.MaxFloat64)
+	root := &TreeNode{Score: score}
+	node := root
+	for ply := 0; depth >= 0; depth, ply = depth-1, ply+1 {
+		moves := agent.LegalMoves(&p)
+		if len(moves) == 0 {
+			break
+		}
+		children := make([]*TreeNode, len(moves))
+		for i, move := range moves {
+			children[i] = &TreeNode{Move: move.String(), Score: s.scoreMove(p, move, depth, ply), move: move}
 		}
+		turn := p.Turn
+		slices.SortStableFunc(children, func(a, b *TreeNode) int {
+			if turn == chess.Black {
+				return cmp.Compare(a.Score, b.Score)
+			}
+			return cmp.Compare(b.Score, a.Score)
+		})
+		node.Children = children[:min(topN, len(children))]
+		node = node.Children[0]
+		p.Move(node.move)
 	}
-	return chess.NoSquare
+	return root, nil
 }
@@ -0,0 +1,760 @@
+package alphabeta
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/applechess.git/metrics"
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+func mustParseMove(t *testing.T, uci string) chess.Move {
+	t.Helper()
+	move, err := chess.ParseUCIMove(uci)
+	if err != nil {
+		t.Fatalf("could not parse move %s: %v", uci, err)
+	}
+	return move
+}
+
+// playLine plays the moves of line from fen, and returns the position reached and those before it, oldest first, as
+// History takes them.
+func playLine(t *testing.T, fen string, line ...string) (chess.Position, []chess.Position) {
+	t.Helper()
+	p := mustParseFen(t, fen)
+	var history []chess.Position
+	for _, uci := range line {
+		history = append(history, p)
+		p.Move(mustParseMove(t, uci))
+	}
+	return p, history
+}
+
+// distinctMoves returns how many different moves ab plays from p with each of seeds.
+func distinctMoves(ab AlphaBeta, p chess.Position, seeds int) int {
+	moves := map[chess.Move]bool{}
+	for seed := 1; seed <= seeds; seed++ {
+		ab.Seed = uint64(seed)
+		moves[ab.GetMove(p)] = true
+	}
+	return len(moves)
+}
+
+func TestTemperatureVariesAcrossSeeds(t *testing.T) {
+	p := *chess.NewGame().Position()
+	if n := distinctMoves(AlphaBeta{Depth: 1, Temperature: 100, SelectionMargin: 1}, p, 20); n < 2 {
+		t.Errorf("temperature 100 played %d distinct moves across 20 seeds, want several", n)
+	}
+	if n := distinctMoves(AlphaBeta{Depth: 1}, p, 20); n != 1 {
+		t.Errorf("temperature 0 played %d distinct moves across 20 seeds, want 1", n)
+	}
+}
+
+func TestDitherVariesAcrossSeeds(t *testing.T) {
+	// With only kings, several king moves tie for best.
+	p := mustParseFen(t, "4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if n := distinctMoves(AlphaBeta{Depth: 1, Dither: true}, p, 20); n < 2 {
+		t.Errorf("dither played %d distinct moves across 20 seeds, want several", n)
+	}
+	if n := distinctMoves(AlphaBeta{Depth: 1}, p, 20); n != 1 {
+		t.Errorf("without dither %d distinct moves were played across 20 seeds, want 1", n)
+	}
+}
+
+func TestDitherVariesWhenPositionRepeats(t *testing.T) {
+	ab := AlphaBeta{Depth: 1, Dither: true, Seed: 7}
+	p := mustParseFen(t, "4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if first, again := ab.GetMove(p), ab.GetMove(p); first != again {
+		t.Errorf("the same seed and position played %s and then %s", first, again)
+	}
+	moves := map[chess.Move]bool{}
+	for fullMove := uint16(1); fullMove <= 20; fullMove++ {
+		p.FullMove = fullMove
+		moves[ab.GetMove(p)] = true
+	}
+	if len(moves) < 2 {
+		t.Errorf("a fixed seed played %d distinct moves as the position came around again, want several", len(moves))
+	}
+}
+
+func TestDeepeningKeepsToMaxTime(t *testing.T) {
+	p := *chess.NewGame().Position()
+	ab := AlphaBeta{MaxTime: 200 * time.Millisecond}
+	startTime := time.Now()
+	move, stats := ab.GetMoveStats(p)
+	if elapsed := time.Since(startTime); elapsed > 2*ab.MaxTime {
+		t.Errorf("search took %s with MaxTime %s", elapsed, ab.MaxTime)
+	}
+	if !slices.Contains(chess.GenerateLegalMoves(&p), move) || stats.Depth == 0 {
+		t.Errorf("search played %s after depth %d, want a legal move from a completed iteration", move, stats.Depth)
+	}
+}
+
+func TestSamplingKeepsToMaxTime(t *testing.T) {
+	p := *chess.NewGame().Position()
+	ab := AlphaBeta{Depth: 8, Temperature: 1, MaxTime: 50 * time.Millisecond}
+	startTime := time.Now()
+	move, err := ab.GetMoveContext(context.Background(), p)
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("sampling search took %s with MaxTime %s", elapsed, ab.MaxTime)
+	}
+	if err != nil || !slices.Contains(chess.GenerateLegalMoves(&p), move) {
+		t.Errorf("sampling search returned %s, %v, want a legal move", move, err)
+	}
+}
+
+// searchPositions have pins, checks and castling to tell legal moves from pseudo-legal ones.
+var searchPositions = []string{
+	chess.DefaultFen,
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3",
+	"4k3/8/8/b7/8/8/3N4/4K2R w K - 0 1", // The knight is pinned,
+}
+
+func TestPseudoLegalSearchMatchesLegal(t *testing.T) {
+	for _, fen := range searchPositions {
+		p := mustParseFen(t, fen)
+		legalMove, legal := AlphaBeta{Depth: 3}.GetMoveStats(p)
+		pseudoMove, pseudo := AlphaBeta{Depth: 3, PseudoLegal: true}.GetMoveStats(p)
+		if pseudoMove != legalMove || pseudo.Score != legal.Score {
+			t.Errorf("pseudo-legal search of %s plays %s scoring %v, want %s scoring %v as with legal moves", fen,
+				pseudoMove, pseudo.Score, legalMove, legal.Score)
+		}
+	}
+}
+
+func TestPseudoLegalRejectsCastlingThroughCheck(t *testing.T) {
+	// The rook on f1 attacks f8, which the king passes over to castle kingside.
+	p := mustParseFen(t, "r3k2r/8/8/8/8/8/8/4KR2 b kq - 0 1")
+	s := searcher{AlphaBeta: AlphaBeta{PseudoLegal: true}}
+	for _, tc := range []struct {
+		move string
+		want bool
+	}{
+		{"e8g8", true},
+		{"e8c8", false},
+	} {
+		move := mustParseMove(t, tc.move)
+		newPos := p
+		newPos.Move(move)
+		if got := s.illegal(&p, &newPos, move); got != tc.want {
+			t.Errorf("illegal(%s) = %v, want %v", tc.move, got, tc.want)
+		}
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	p, err := chess.ParseFen(searchPositions[1])
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, pseudoLegal := range []bool{false, true} {
+		name := "legal"
+		if pseudoLegal {
+			name = "pseudolegal"
+		}
+		b.Run(name, func(b *testing.B) {
+			for range b.N {
+				AlphaBeta{Depth: 3, PseudoLegal: pseudoLegal}.GetMove(*p)
+			}
+		})
+	}
+}
+
+// BenchmarkMoveOrdering reports the nodes searched with and without move ordering at a fixed depth.
+func BenchmarkMoveOrdering(b *testing.B) {
+	p, err := chess.ParseFen(searchPositions[1])
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, noOrdering := range []bool{false, true} {
+		name := "ordered"
+		if noOrdering {
+			name = "unordered"
+		}
+		b.Run(name, func(b *testing.B) {
+			var stats Stats
+			for range b.N {
+				_, stats = AlphaBeta{Depth: 2, NoQuiescence: true, NoOrdering: noOrdering}.GetMoveStats(*p)
+			}
+			b.ReportMetric(float64(stats.Nodes), "nodes/op")
+		})
+	}
+}
+
+func TestScoreMoveMatchesSearch(t *testing.T) {
+	p := mustParseFen(t, "r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3")
+	for depth := 1; depth <= 3; depth++ {
+		ab := AlphaBeta{Depth: depth}
+		best, stats := ab.GetMoveStats(p)
+		if score, err := ab.ScoreMove(p, best, depth); err != nil || score != stats.Score {
+			t.Errorf("at depth %d the best move %s scores %v, %v, want the search's %v", depth, best, score, err,
+				stats.Score)
+		}
+		// Qg5 hangs the queen to Nxg5, so it scores better for white.
+		if score, err := ab.ScoreMove(p, mustParseMove(t, "d8g5"), depth); err != nil || score <= stats.Score {
+			t.Errorf("at depth %d Qg5 scores %v, %v, want worse for black than %v", depth, score, err, stats.Score)
+		}
+	}
+	if _, err := (AlphaBeta{}).ScoreMove(p, mustParseMove(t, "e1g1"), 1); err == nil {
+		t.Error("scoring white's castling with black to move gave no error")
+	}
+}
+
+func TestDeepeningReportsDeepestIteration(t *testing.T) {
+	for _, fen := range searchPositions {
+		p := mustParseFen(t, fen)
+		move, stats := AlphaBeta{}.GetMoveStats(p)
+		if !slices.Contains(chess.GenerateLegalMoves(&p), move) || stats.Depth != 0 {
+			t.Errorf("%s at depth 0 played %s after depth %d, want a legal move at depth 0", fen, move, stats.Depth)
+		}
+		if _, stats := (AlphaBeta{Depth: 3}).GetMoveStats(p); stats.Depth != 3 || stats.PV == nil {
+			t.Errorf("%s at depth 3 completed depth %d with line %v, want depth 3", fen, stats.Depth, stats.PV)
+		}
+	}
+
+	// Rb8# is found by the shallowest iterations, and deeper ones cannot improve on it.
+	p := mustParseFen(t, "7k/6pp/8/8/8/8/6PP/1R4K1 w - - 0 1")
+	if move, stats := (AlphaBeta{Depth: 5}).GetMoveStats(p); move != mustParseMove(t, "b1b8") || stats.Depth > 1 {
+		t.Errorf("played %s after depth %d, want the mate b1b8 by depth 1", move, stats.Depth)
+	}
+}
+
+func TestQuiescenceSeesRecapture(t *testing.T) {
+	// Qxd6 wins a pawn at the horizon of a depth 0 search, and loses the queen to cxd6 just past it.
+	p := mustParseFen(t, "4k3/2p5/3p4/8/8/8/3Q4/4K3 w - - 0 1")
+	grab := mustParseMove(t, "d2d6")
+	if move := (AlphaBeta{NoQuiescence: true}).GetMove(p); move != grab {
+		t.Errorf("without quiescence played %s, want the pawn grab %s that looks good at the horizon", move, grab)
+	}
+	if move := (AlphaBeta{}).GetMove(p); move == grab {
+		t.Errorf("with quiescence played the pawn grab %s, which loses the queen", grab)
+	}
+}
+
+func TestAnalyzeReturnsPrincipalVariation(t *testing.T) {
+	for _, fen := range searchPositions {
+		p := mustParseFen(t, fen)
+		ab := AlphaBeta{Depth: 3}
+		move, score, pv := ab.Analyze(p)
+		_, stats := ab.GetMoveStats(p)
+		if score != stats.Score || len(pv) != stats.Depth+1 || pv[0] != move {
+			t.Errorf("%s: Analyze gave %s scoring %v with line %v, want the search's score %v and a line of %d moves "+
+				"starting with its move", fen, move, score, pv, stats.Score, stats.Depth+1)
+			continue
+		}
+		for _, m := range pv {
+			if !slices.Contains(chess.GenerateLegalMoves(&p), m) {
+				t.Errorf("%s: line %v plays the illegal %s", fen, pv, m)
+				break
+			}
+			p.Move(m)
+		}
+	}
+}
+
+func TestNullMovePrunesWinningPositions(t *testing.T) {
+	// White is a queen up, so passing still leaves it far ahead.
+	p := mustParseFen(t, "r1b1kb1r/pppp1ppp/2n2n2/4p3/2B1P3/2N2N2/PPPP1PPP/R1BQK2R w KQkq - 0 1")
+	move, stats := AlphaBeta{Depth: 4}.GetMoveStats(p)
+	nullMove, nullStats := AlphaBeta{Depth: 4, UseNullMove: true}.GetMoveStats(p)
+	if stats.NullMoveCutoffs != 0 {
+		t.Errorf("search without null moves made %d null move cutoffs", stats.NullMoveCutoffs)
+	}
+	if nullMove != move || nullStats.NullMoveCutoffs == 0 || nullStats.Nodes >= stats.Nodes {
+		t.Errorf("with null moves played %s in %d nodes after %d cutoffs, without %s in %d nodes, want the same "+
+			"move in fewer nodes", nullMove, nullStats.Nodes, nullStats.NullMoveCutoffs, move, stats.Nodes)
+	}
+
+	// With only kings and pawns, passing could dodge a zugzwang, so it is never tried however far ahead white is.
+	p = mustParseFen(t, "6k1/8/8/8/8/8/PPPPP3/1K6 w - - 0 1")
+	if _, stats := (AlphaBeta{Depth: 4, UseNullMove: true}).GetMoveStats(p); stats.NullMoveCutoffs != 0 {
+		t.Errorf("king and pawn endgame made %d null move cutoffs, want none", stats.NullMoveCutoffs)
+	}
+}
+
+func TestNodeBudgetIsDeterministic(t *testing.T) {
+	p := mustParseFen(t, searchPositions[1])
+	ab := AlphaBeta{MaxNodes: 5000}
+	move, stats := ab.GetMoveStats(p)
+	if stats.Depth == 0 {
+		t.Fatalf("no iteration completed within %d nodes", ab.MaxNodes)
+	}
+	// Other searches running at the same time slow this one down, which must not change its result.
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			AlphaBeta{Depth: 2}.GetMove(p)
+		}()
+	}
+	again, againStats := ab.GetMoveStats(p)
+	wg.Wait()
+	if again != move || againStats.Depth != stats.Depth || againStats.Score != stats.Score {
+		t.Errorf("budget of %d nodes played %s at depth %d scoring %v, then %s at depth %d scoring %v", ab.MaxNodes,
+			move, stats.Depth, stats.Score, again, againStats.Depth, againStats.Score)
+	}
+}
+
+func TestTTHitRate(t *testing.T) {
+	// Quiet openings reach the same positions by many move orders.
+	p := *chess.NewGame().Position()
+	if _, stats := (AlphaBeta{Depth: 4}).GetMoveStats(p); stats.TTHitRate() <= 0 || stats.TTHitRate() > 1 {
+		t.Errorf("search with a transposition table has hit rate %v, want between 0 and 1", stats.TTHitRate())
+	}
+	if _, stats := (AlphaBeta{Depth: 4, NoTransposition: true}).GetMoveStats(p); stats.TTHitRate() != 0 {
+		t.Errorf("search without a transposition table has hit rate %v, want 0", stats.TTHitRate())
+	}
+}
+
+func TestMoveOrderingRaisesFirstMoveCutoffs(t *testing.T) {
+	// Kiwipete, with captures available to both sides.
+	p := mustParseFen(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	orderedMove, ordered := AlphaBeta{Depth: 2, NoQuiescence: true}.GetMoveStats(p)
+	unorderedMove, unordered := AlphaBeta{Depth: 2, NoQuiescence: true, NoOrdering: true}.GetMoveStats(p)
+	orderedRate, orderedIndex := ordered.CutoffStats()
+	unorderedRate, unorderedIndex := unordered.CutoffStats()
+	if ordered.Cutoffs == 0 || orderedRate <= unorderedRate || orderedIndex >= unorderedIndex {
+		t.Errorf("ordered search has first-move cutoff rate %.2f and average cutoff index %.2f, unordered %.2f and "+
+			"%.2f, want the ordered rate higher and index lower", orderedRate, orderedIndex, unorderedRate,
+			unorderedIndex)
+	}
+	if orderedMove != unorderedMove || ordered.Score != unordered.Score || ordered.Nodes >= unordered.Nodes {
+		t.Errorf("ordered search played %s scoring %v in %d nodes, unordered %s scoring %v in %d, want the same move "+
+			"and score in fewer nodes", orderedMove, ordered.Score, ordered.Nodes, unorderedMove, unordered.Score,
+			unordered.Nodes)
+	}
+	if first, index := (Stats{}).CutoffStats(); first != 0 || index != 0 {
+		t.Errorf("no cutoffs gave CutoffStats %v, %v, want 0, 0", first, index)
+	}
+}
+
+func TestMateInCountsMovesForSideToMove(t *testing.T) {
+	for _, tc := range []struct {
+		fen   string
+		depth int
+		want  int
+	}{
+		{"6k1/8/8/5K2/8/8/8/R7 w - - 0 1", 5, 3},
+		{"6k1/8/5K2/8/8/8/8/R7 b - - 1 1", 4, -2}, // After Kf6 from the position above
+		{chess.DefaultFen, 2, 0},
+	} {
+		if _, stats := (AlphaBeta{Depth: tc.depth}).GetMoveStats(mustParseFen(t, tc.fen)); stats.MateIn != tc.want {
+			t.Errorf("MateIn is %d for %s, want %d", stats.MateIn, tc.fen, tc.want)
+		}
+	}
+}
+
+func TestLosingSideFindsStalemate(t *testing.T) {
+	// Black's king has no moves, so Rh1+ Kxh1 is stalemate. Anything else loses the rook or leaves it against the queen.
+	p := mustParseFen(t, "k7/2Q5/8/8/8/8/5PPr/6K1 b - - 0 1")
+	for depth := 1; depth <= 3; depth++ {
+		move, stats := AlphaBeta{Depth: depth}.GetMoveStats(p)
+		if move != mustParseMove(t, "h2h1") || stats.Score != 0 {
+			t.Errorf("at depth %d played %s scoring %v, want the stalemating h2h1 scoring 0", depth, move, stats.Score)
+		}
+	}
+}
+
+func TestStalematePenaltyNeverStalematesWithMateAvailable(t *testing.T) {
+	// Qg7# mates, while Qg6 would stalemate the cornered king.
+	p := mustParseFen(t, "7k/8/5K2/8/8/8/8/6Q1 w - - 0 1")
+	stalemate := mustParseMove(t, "g1g6")
+	for _, penalty := range []float64{0, 5} {
+		for depth := 1; depth <= 4; depth++ {
+			ab := AlphaBeta{Depth: depth, StalematePenalty: penalty}
+			move, stats := ab.GetMoveStats(p)
+			after := p
+			after.Move(move)
+			if !chess.IsCheckMate(&after) || stats.MateIn != 1 {
+				t.Errorf("with StalematePenalty %v at depth %d played %s with mate in %d, want mate in 1", penalty,
+					depth, move, stats.MateIn)
+			}
+		}
+		score, err := AlphaBeta{StalematePenalty: penalty}.ScoreMove(p, stalemate, 1)
+		if err != nil || score != -penalty {
+			t.Errorf("with StalematePenalty %v stalemating scores %v, %v, want %v", penalty, score, err, -penalty)
+		}
+	}
+}
+
+func TestPromotionRaceQueensFirst(t *testing.T) {
+	// Both pawns are three moves from queening. b6 wins the race, and b8=Q comes with check if black keeps racing, so
+	// the black pawn is stopped a move short.
+	p := mustParseFen(t, "7k/8/8/1P6/6p1/8/8/K7 w - - 0 1")
+	move, stats := AlphaBeta{Depth: 6}.GetMoveStats(p)
+	if move != mustParseMove(t, "b5b6") || stats.Score < eval.DefaultWeights.Rook {
+		t.Errorf("played %s scoring %v, want b5b6 winning the race by more than a rook", move, stats.Score)
+	}
+	if !slices.Contains(stats.PV, mustParseMove(t, "b7b8q")) {
+		t.Errorf("principal variation %v does not queen the b-pawn", stats.PV)
+	}
+}
+
+func TestFortressCapOnPhilidorDraw(t *testing.T) {
+	// Philidor's position: black's rook holds the third rank, and white's extra pawn can't make progress.
+	philidor := mustParseFen(t, "4k3/8/3r4/4PK2/8/8/8/1R6 b - - 0 1")
+	if _, stats := (AlphaBeta{Depth: 3}).GetMoveStats(philidor); stats.Score < 1 {
+		t.Fatalf("uncapped search scores the pawn up ending %v, want at least a pawn", stats.Score)
+	}
+	if _, stats := (AlphaBeta{Depth: 3, FortressCap: 0.5}).GetMoveStats(philidor); stats.Score > 0.5 {
+		t.Errorf("Philidor's draw scores %v with FortressCap 0.5, want it capped", stats.Score)
+	}
+
+	// Winning the rook is progress, and is not capped.
+	hanging := mustParseFen(t, "4k3/8/8/3r4/8/8/8/3RK3 w - - 0 1")
+	if _, stats := (AlphaBeta{Depth: 3, FortressCap: 0.5}).GetMoveStats(hanging); stats.Score < 4 {
+		t.Errorf("winning a hanging rook scores %v with FortressCap 0.5, want a rook up", stats.Score)
+	}
+}
+
+func TestSearchTreeFollowsBestLine(t *testing.T) {
+	p := mustParseFen(t, "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	ab := AlphaBeta{Depth: 2}
+	const depth, topN = 2, 3
+	root, err := ab.SearchTree(p, depth, topN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best := ab.GetMove(p); root.Children[0].move != best {
+		t.Errorf("best child of the root is %s, want GetMove's %s", root.Children[0].Move, best)
+	}
+	plies := 0
+	for node := root; len(node.Children) > 0; node = node.Children[0] {
+		plies++
+		if len(node.Children) > topN {
+			t.Errorf("node at ply %d has %d children, want at most %d", plies, len(node.Children), topN)
+		}
+		for _, child := range node.Children[1:] {
+			if len(child.Children) > 0 {
+				t.Errorf("%s is not on the best line but has children", child.Move)
+			}
+		}
+	}
+	if plies != depth+1 {
+		t.Errorf("tree is %d plies deep, want %d", plies, depth+1)
+	}
+}
+
+func TestSearchTreeRejectsBadArguments(t *testing.T) {
+	ab := AlphaBeta{Depth: 1}
+	if _, err := ab.SearchTree(*chess.NewGame().Position(), 1, 0); err == nil {
+		t.Error("topN 0 gave no error")
+	}
+	mated := mustParseFen(t, "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
+	if _, err := ab.SearchTree(mated, 1, 3); err == nil {
+		t.Error("a checkmated position gave no error")
+	}
+}
+
+// perpetualLine brings the queen back to f8 after a first round of checks, so Qf7+ now repeats a position. Black
+// threatens Qxg2#, so the checks are white's only way to stay out of a loss.
+var perpetualLine = []string{"f8f7", "h7h8", "f7f8", "h8h7"}
+
+func TestRepetitionPenaltyScoresPerpetualCheck(t *testing.T) {
+	// White has a rook and a knight for a bishop.
+	p, history := playLine(t, "5Q2/1b5k/6pp/R4p2/N7/8/4q1PP/7K w - - 0 1", perpetualLine...)
+	check := mustParseMove(t, "f8f7")
+	for _, tc := range []struct {
+		penalty float64
+		want    float64
+	}{{0, 0}, {1, -1}} {
+		ab := AlphaBeta{History: history, RepetitionPenalty: tc.penalty}
+		if score, err := ab.ScoreMove(p, check, 1); err != nil || score != tc.want {
+			t.Errorf("perpetual check with RepetitionPenalty %v scores %v, %v, want %v", tc.penalty, score, err,
+				tc.want)
+		}
+	}
+	if move := (AlphaBeta{Depth: 3, History: history, RepetitionPenalty: 1}).GetMove(p); move != check {
+		t.Errorf("played %s, want the perpetual %s since every other move loses far more than the penalty", move, check)
+	}
+
+	// Without the rook and knight white is the side behind, and the repetition is a plain draw.
+	p, history = playLine(t, "5Q2/1b5k/6pp/5p2/8/8/4q1PP/7K w - - 0 1", perpetualLine...)
+	ab := AlphaBeta{History: history, RepetitionPenalty: 1}
+	if score, err := ab.ScoreMove(p, check, 1); err != nil || score != 0 {
+		t.Errorf("perpetual check by the side behind scores %v, %v, want 0", score, err)
+	}
+}
+
+func TestRepetitionAndFiftyMoveDraws(t *testing.T) {
+	// White is a bishop down and faces mate, so repeating with Qf7+ is its best result.
+	p, history := playLine(t, "5Q2/1b5k/6pp/5p2/8/8/4q1PP/7K w - - 0 1", perpetualLine...)
+	check := mustParseMove(t, "f8f7")
+	if score, err := (AlphaBeta{History: history}).ScoreMove(p, check, 1); err != nil || score != 0 {
+		t.Errorf("repeating with %s scores %v, %v, want the draw 0", check, score, err)
+	}
+	if score, err := (AlphaBeta{}).ScoreMove(p, check, 1); err != nil || score == 0 {
+		t.Errorf("without history %s scores %v, %v, want the position evaluated rather than drawn", check, score, err)
+	}
+	if move, stats := (AlphaBeta{Depth: 3, History: history}).GetMoveStats(p); move != check || stats.Score != 0 {
+		t.Errorf("played %s scoring %v, want the repetition %s scoring 0", move, stats.Score, check)
+	}
+
+	// A queen up, every move but the pawn's lets the fifty-move rule draw the game.
+	p = mustParseFen(t, "4k3/8/8/8/8/8/P7/4K2Q w - - 99 80")
+	move, stats := AlphaBeta{Depth: 2}.GetMoveStats(p)
+	if p.PieceAt(move.FromSquare).Type != chess.Pawn || stats.Score <= 0 {
+		t.Errorf("played %s scoring %v with the fifty-move rule due, want the pawn to move", move, stats.Score)
+	}
+}
+
+func TestRepetitionPenaltyAvoidsPerpetualWhenAhead(t *testing.T) {
+	// Without black's queen there is no threat, and white up a rook has better than a draw.
+	p, history := playLine(t, "5Q2/1b5k/6pp/R4p2/N7/8/6PP/7K w - - 0 1", perpetualLine...)
+	ab := AlphaBeta{Depth: 3, History: history, RepetitionPenalty: 1}
+	move, stats := ab.GetMoveStats(p)
+	if move == mustParseMove(t, "f8f7") || stats.Score <= 0 {
+		t.Errorf("played %s scoring %v, want a move making progress rather than the perpetual", move, stats.Score)
+	}
+}
+
+func TestAdaptiveContemptScalesWithMaterial(t *testing.T) {
+	// Each side has shuffled twice, and the next shuffle repeats a position. The knight move's own penalty is left
+	// out, so only the draw is scored.
+	weights := eval.DefaultWeights
+	weights.RepeatedMinorMove = 0
+	heavy, heavyHistory := playLine(t, chess.DefaultFen, "g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6")
+	bare, bareHistory := playLine(t, "4k3/4p3/8/8/8/8/4P3/4K3 w - - 0 1", "e1d1", "e8d8", "d1e1", "d8e8", "e1d1",
+		"e8d8")
+	for _, tc := range []struct {
+		name     string
+		p        chess.Position
+		history  []chess.Position
+		repeat   string
+		adaptive bool
+		want     float64
+	}{
+		{"all pieces on", heavy, heavyHistory, "f3g1", true, -1},
+		{"only pawns", bare, bareHistory, "d1e1", true, 0},
+		{"only pawns without adapting", bare, bareHistory, "d1e1", false, -1},
+	} {
+		ab := AlphaBeta{History: tc.history, Weights: &weights, Contempt: 1, AdaptiveContempt: tc.adaptive}
+		score, err := ab.ScoreMove(tc.p, mustParseMove(t, tc.repeat), 1)
+		if err != nil || math.Abs(score-tc.want) > 1e-9 {
+			t.Errorf("%s: repeating with %s scores %v, %v, want %v", tc.name, tc.repeat, score, err, tc.want)
+		}
+	}
+
+	ab := AlphaBeta{Depth: 2, History: heavyHistory, Contempt: 1, AdaptiveContempt: true}
+	if move := ab.GetMove(heavy); move == mustParseMove(t, "f3g1") {
+		t.Errorf("played the repetition %s with every piece on the board", move)
+	}
+}
+
+func TestRepeatedMinorMoveLowersRootScore(t *testing.T) {
+	p, history := playLine(t, chess.DefaultFen, "g1f3", "b8c6")
+	again, developing := mustParseMove(t, "f3g5"), mustParseMove(t, "b1c3")
+	noTerm := eval.DefaultWeights
+	noTerm.RepeatedMinorMove = 0
+	for _, move := range []chess.Move{again, developing} {
+		with, err := AlphaBeta{History: history}.ScoreMove(p, move, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		without, err := AlphaBeta{History: history, Weights: &noTerm}.ScoreMove(p, move, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := without
+		if move == again {
+			want -= eval.DefaultWeights.RepeatedMinorMove
+		}
+		if math.Abs(with-want) > 1e-9 {
+			t.Errorf("%s scores %v, want %v", move, with, want)
+		}
+	}
+}
+
+// recordingHandler is a slog.Handler that keeps the records it is sent at every level.
+type recordingHandler struct {
+	mu      *sync.Mutex
+	records *[]slog.Record
+}
+
+func (h recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func (h recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h recordingHandler) WithGroup(string) slog.Handler { return h }
+
+func TestRefutationLoggedAtDebug(t *testing.T) {
+	// Rxf2 wins the checking knight but leaves the back rank to Re1+ Rf1 Rxf1#, so Kg1 is played instead.
+	p := mustParseFen(t, "4r1k1/5ppp/8/8/8/8/5nPP/5R1K w - - 0 1")
+	var records []slog.Record
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(recordingHandler{mu: &sync.Mutex{}, records: &records}))
+
+	if move := (AlphaBeta{Depth: 4}).GetMove(p); move != mustParseMove(t, "h1g1") {
+		t.Fatalf("played %s, want h1g1", move)
+	}
+	for _, r := range records {
+		if r.Message != "alphabeta rejected move" {
+			continue
+		}
+		attrs := map[string]string{}
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value.String()
+			return true
+		})
+		if attrs["move"] != "F1F2" || attrs["refutation"] != "E8E1 F2F1 E1F1" {
+			t.Errorf("logged rejected move %s with refutation %q, want F1F2 refuted by E8E1 F2F1 E1F1",
+				attrs["move"], attrs["refutation"])
+		}
+		return
+	}
+	t.Error("no rejected move was logged")
+}
+
+// recordingSink is a metrics.Sink that keeps what it is sent.
+type recordingSink struct {
+	counters, gauges map[string]float64
+}
+
+func (r *recordingSink) Add(name string, value float64) { r.counters[name] += value }
+
+func (r *recordingSink) Set(name string, value float64) { r.gauges[name] = value }
+
+func TestSearchRecordsMetrics(t *testing.T) {
+	sink := &recordingSink{counters: map[string]float64{}, gauges: map[string]float64{}}
+	ab := AlphaBeta{Depth: 3, Metrics: sink}
+	_, stats := ab.GetMoveStats(*chess.NewGame().Position())
+	if sink.counters[metrics.Nodes] != float64(stats.Nodes) {
+		t.Errorf("%s counter is %v, want the %d nodes searched", metrics.Nodes, sink.counters[metrics.Nodes],
+			stats.Nodes)
+	}
+	if sink.gauges[metrics.Depth] != 3 {
+		t.Errorf("%s gauge is %v, want 3", metrics.Depth, sink.gauges[metrics.Depth])
+	}
+	if sink.gauges[metrics.NPS] <= 0 {
+		t.Errorf("%s gauge is %v, want positive", metrics.NPS, sink.gauges[metrics.NPS])
+	}
+	if sink.gauges[metrics.TTHitRate] != stats.TTHitRate() {
+		t.Errorf("%s gauge is %v, want %v", metrics.TTHitRate, sink.gauges[metrics.TTHitRate], stats.TTHitRate())
+	}
+
+	ab.GetMove(*chess.NewGame().Position())
+	if sink.counters[metrics.Nodes] != 2*float64(stats.Nodes) {
+		t.Errorf("%s counter is %v after two searches, want %d", metrics.Nodes, sink.counters[metrics.Nodes],
+			2*stats.Nodes)
+	}
+}
+
+func TestWeightsChangePlay(t *testing.T) {
+	// The rook can take the bishop or the knight, and by default the bishop is worth slightly more.
+	p := mustParseFen(t, "7k/3n4/8/8/3R2b1/8/8/4K3 w - - 0 1")
+	if move := (AlphaBeta{Depth: 2}).GetMove(p); move.ToSquare != chess.G4 {
+		t.Errorf("with the default weights played %s, want the bishop taken", move)
+	}
+	weights := eval.DefaultWeights
+	weights.Knight = 10
+	if move := (AlphaBeta{Depth: 2, Weights: &weights}).GetMove(p); move.ToSquare != chess.D7 {
+		t.Errorf("with knights worth 10 played %s, want the knight taken", move)
+	}
+}
+
+func TestGetMoveContextCategorisesFailures(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	noTurn := mustParseFen(t, chess.DefaultFen)
+	noTurn.Turn = chess.NoColor
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		p    chess.Position
+		kind agent.ErrorKind
+	}{
+		{"cancelled", cancelled, mustParseFen(t, chess.DefaultFen), agent.Cancelled},
+		{"checkmated", context.Background(), mustParseFen(t, "R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1"),
+			agent.NoLegalMoves},
+		{"adjacent kings", context.Background(), mustParseFen(t, "8/8/8/8/8/8/3k4/4K3 w - - 0 1"),
+			agent.InvalidPosition},
+		{"invalid turn", context.Background(), noTurn, agent.InvalidPosition},
+	} {
+		_, err := AlphaBeta{Depth: 3}.GetMoveContext(tc.ctx, tc.p)
+		var agentErr *agent.AgentError
+		if !errors.As(err, &agentErr) || agentErr.Kind != tc.kind || agentErr.Agent != "alphabeta" {
+			t.Errorf("%s: GetMoveContext returned %v, want a %s error from alphabeta", tc.name, err, tc.kind)
+		}
+	}
+}
+
+func TestGetMoveContextStopsWithBestMoveSoFar(t *testing.T) {
+	p := mustParseFen(t, searchPositions[2])
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	move, stats, err := AlphaBeta{Depth: maxDepth}.GetMoveStatsContext(ctx, p)
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("search cancelled after 100ms took %s", elapsed)
+	}
+	if err != nil || !slices.Contains(chess.GenerateLegalMoves(&p), move) || stats.Depth >= maxDepth {
+		t.Errorf("cancelled search gave %s after depth %d, %v, want the legal move of the last depth completed", move,
+			stats.Depth, err)
+	}
+}
+
+func TestPrefersMateKeepingMoreMaterial(t *testing.T) {
+	// Qg8+ Rxg8 Nf7# gives up the queen, while Re8+ Rxe8 Rxe8# trades rooks. Both mate in 2.
+	p := mustParseFen(t, "r6k/6pp/7N/8/2Q5/8/4R1PP/4R1K1 w - - 0 1")
+	sacrifice, trade := mustParseMove(t, "c4g8"), mustParseMove(t, "e2e8")
+	s := newSearcher(AlphaBeta{Depth: 3}, &p)
+	sacrificeScore, tradeScore := s.scoreMove(p, sacrifice, 2, 0), s.scoreMove(p, trade, 2, 0)
+	if eval.MateIn(sacrificeScore) != 2 || eval.MateIn(tradeScore) != 2 || tradeScore <= sacrificeScore {
+		t.Errorf("queen sacrifice scores %v and rook trade scores %v, want both mate in 2 with the trade higher",
+			sacrificeScore, tradeScore)
+	}
+	if move := (AlphaBeta{Depth: 3}).GetMove(p); move != trade {
+		t.Errorf("played %s, want %s, the mate that keeps the queen", move, trade)
+	}
+}
+
+func TestImmediateMatePlayed(t *testing.T) {
+	// Rb8# and Rxa8# both mate at once, and Rxa8# also takes the knight.
+	p := mustParseFen(t, "n6k/6pp/8/8/8/8/6PP/RR4K1 w - - 0 1")
+	capture := mustParseMove(t, "a1a8")
+	for _, depth := range []int{1, 3} {
+		move, stats := AlphaBeta{Depth: depth}.GetMoveStats(p)
+		if move != capture || stats.MateIn != 1 {
+			t.Errorf("at depth %d played %s with mate in %d, want the capturing mate %s in 1", depth, move,
+				stats.MateIn, capture)
+		}
+	}
+}
+
+func TestInstabilityOfHangingQueen(t *testing.T) {
+	// Material is nearly level, but exd4 wins white's queen for nothing.
+	hanging := mustParseFen(t, "rnbqkbnr/pppp1ppp/8/4p3/3Q4/8/PPP1PPPP/RNB1KBNR b KQkq - 0 1")
+	if unstable := (AlphaBeta{}).Instability(hanging, 2); unstable < 5 {
+		t.Errorf("hanging queen has instability %v, want at least 5", unstable)
+	}
+	quiet := mustParseFen(t, chess.DefaultFen)
+	if unstable := (AlphaBeta{}).Instability(quiet, 2); unstable > 1 {
+		t.Errorf("starting position has instability %v, want at most 1", unstable)
+	}
+}
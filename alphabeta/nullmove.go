@@ -0,0 +1,48 @@
+package alphabeta
+
+import (
+	"math"
+
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+// nullMoveReduction is how many plies shallower than a normal reply the position after a null move is searched.
+const nullMoveReduction = 2
+
+// nullMove lets the side to move in p pass and searches the opponent's reply nullMoveReduction plies shallower than
+// depth. It returns that score, with true, if it still falls outside the window alpha to beta, since then any real move
+// would too unless passing is a disadvantage. That is only common in zugzwang, so nothing is tried when the side to move
+// is in check or has only its king and pawns. No null move is tried within the search of another, which also rules out
+// two passes in a row. Positions after the pass are not compared with those before it for repetitions.
+func (s *searcher) nullMove(p *chess.Position, depth int, ply int, alpha float64, beta float64) (float64, bool) {
+	white := p.Turn == chess.White
+	if !s.UseNullMove || s.inNullMove || ply == 0 || depth <= nullMoveReduction ||
+		(white && beta == math.MaxFloat64) || (!white && alpha == -math.MaxFloat64) ||
+		!hasPiece(p, p.Turn) || chess.IsCheck(p) {
+		return 0, false
+	}
+
+	passed := *p
+	passed.Turn = chess.Black
+	if !white {
+		passed.Turn = chess.White
+	}
+	passed.EnPassant = chess.NoSquare
+	s.inNullMove = true
+	path := s.path
+	s.path = nil
+	var score float64
+	if white {
+		_, score = s.search(passed, depth-1-nullMoveReduction, ply+1, beta, math.MaxFloat64)
+	} else {
+		_, score = s.search(passed, depth-1-nullMoveReduction, ply+1, -math.MaxFloat64, alpha)
+	}
+	s.inNullMove = false
+	s.path = path
+	if s.aborted || eval.IsMateScore(score) || (white && score <= beta) || (!white && score >= alpha) {
+		return 0, false
+	}
+	s.nullMoveCutoffs++
+	return score, true
+}
@@ -0,0 +1,36 @@
+package alphabeta
+
+import (
+	"context"
+	"slices"
+
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/zobrist"
+	"github.com/brighamskarda/chess"
+)
+
+// Predict returns the move Table holds for p, which after a search of the position before p is the reply that search
+// expected, and during or after a search of p itself is the best move of its deepest iteration so far. It returns the
+// zero move without a Table, or if the table has no legal move for p.
+func (ab AlphaBeta) Predict(p chess.Position) chess.Move {
+	if ab.Table == nil {
+		return chess.Move{}
+	}
+	entry, ok := ab.Table.get(zobrist.Hash(&p))
+	if !ok || !slices.Contains(agent.LegalMoves(&p), entry.move) {
+		return chess.Move{}
+	}
+	return entry.move
+}
+
+// Ponder searches p one ply deeper at a time until ctx is done or a mate is found, filling Table so that a later search
+// of p finds most of its positions there. It does nothing without a Table, or with NoTransposition set.
+func (ab AlphaBeta) Ponder(ctx context.Context, p chess.Position) {
+	if ab.Table == nil || ab.NoTransposition || agent.CheckPosition("alphabeta", &p) != nil {
+		return
+	}
+	s := newSearcher(ab, &p)
+	s.ctx = ctx
+	s.Depth, s.MaxNodes = maxDepth, 0
+	s.deepen(p)
+}
@@ -0,0 +1,119 @@
+package alphabeta
+
+import (
+	"math"
+	"slices"
+
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+// maxQuiescenceDepth bounds how many plies quiescence searches past the horizon, since check evasions need not
+// capture.
+const maxQuiescenceDepth = 16
+
+// deltaMargin is how many pawns a capture may gain beyond the value of its victim, positionally, before quiesce
+// assumes it cannot raise the score enough to matter.
+const deltaMargin = 2
+
+// quiesce scores p, reached at the search horizon ply half-moves into the search, by searching captures and promotions
+// until the position is quiet, so that a leaf is not judged in the middle of an exchange. The side to move may stand pat
+// on the static evaluation rather than capture, unless it is in check, when every evasion is searched; otherwise
+// captures that eval.SEE says lose material are skipped. qdepth counts the plies searched past the horizon. Scores are from white's perspective.
+func (s *searcher) quiesce(p *chess.Position, ply int, qdepth int, alpha float64, beta float64) float64 {
+	inCheck := chess.IsCheck(p)
+	if s.NoQuiescence || qdepth >= maxQuiescenceDepth {
+		return s.evaluateLeaf(p)
+	}
+
+	white := p.Turn == chess.White
+	best := math.MaxFloat64
+	if white {
+		best = -math.MaxFloat64
+	}
+	if !inCheck {
+		best = s.evaluateLeaf(p)
+		if (white && best > beta) || (!white && best < alpha) {
+			return best
+		}
+	}
+	searched := 0
+	for _, move := range s.quiescenceMoves(p, inCheck) {
+		if margin := gain(p, move, s.Weights) + deltaMargin; !inCheck &&
+			((white && best+margin < alpha) || (!white && best-margin > beta)) {
+			// Even winning the piece cannot bring the score back into the window, nor can any later, smaller capture.
+			break
+		}
+		if !inCheck && eval.SEE(p, move, s.Weights) < 0 {
+			continue
+		}
+		newPos := *p
+		newPos.Move(move)
+		if s.illegal(p, &newPos, move) {
+			continue
+		}
+		searched++
+		s.nodes++
+		if s.stopped() {
+			break
+		}
+		if white {
+			score := s.quiesce(&newPos, ply+1, qdepth+1, max(alpha, best), beta)
+			if s.aborted {
+				break
+			}
+			best = max(best, score)
+			if best > beta {
+				break
+			}
+		} else {
+			score := s.quiesce(&newPos, ply+1, qdepth+1, alpha, min(beta, best))
+			if s.aborted {
+				break
+			}
+			best = min(best, score)
+			if best < alpha {
+				break
+			}
+		}
+	}
+	if inCheck && searched == 0 && !s.aborted {
+		return eval.MatedScore(p, ply)
+	}
+	return best
+}
+
+// quiescenceMoves returns the moves quiesce tries from p: every move when in check, and otherwise only the captures and
+// promotions, in the order moves gives them.
+func (s *searcher) quiescenceMoves(p *chess.Position, inCheck bool) []chess.Move {
+	moves := s.moves(p, chess.Move{})
+	if inCheck {
+		return moves
+	}
+	return slices.DeleteFunc(moves, func(move chess.Move) bool { return !isNoisy(p, move) })
+}
+
+// gain returns the value in pawns, by w, of what move captures from p, plus what promoting adds.
+func gain(p *chess.Position, move chess.Move, w *eval.Weights) float64 {
+	g := pieceValue(p.PieceAt(move.ToSquare), w)
+	if move.ToSquare == p.EnPassant && p.PieceAt(move.FromSquare).Type == chess.Pawn {
+		g = w.Pawn
+	}
+	if move.Promotion != chess.NoPieceType {
+		g += pieceValue(chess.Piece{Color: chess.White, Type: move.Promotion}, w) - w.Pawn
+	}
+	return g
+}
+
+// pieceValue returns the value of piece in pawns by w, whatever its color. Kings are worth nothing.
+func pieceValue(piece chess.Piece, w *eval.Weights) float64 {
+	return math.Abs(eval.PieceValue(piece, w))
+}
+
+// isNoisy reports whether move, from p, captures or promotes.
+func isNoisy(p *chess.Position, move chess.Move) bool {
+	if move.Promotion != chess.NoPieceType || p.PieceAt(move.ToSquare).Type != chess.NoPieceType {
+		return true
+	}
+	return move.ToSquare == p.EnPassant && p.PieceAt(move.FromSquare).Type == chess.Pawn
+}
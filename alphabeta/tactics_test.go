@@ -0,0 +1,52 @@
+package alphabeta
+
+import (
+	_ "embed"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+// tactics holds positions with known best moves, one per line as "<fen> ;bm <uci move>...". Lines starting with # are
+// comments.
+//
+//go:embed testdata/tactics.epd
+var tactics string
+
+// minTacticsSolved is how many of tactics the default search must solve at tacticsDepth. Raise it as the engine
+// improves, and look into any change that drops below it.
+const (
+	minTacticsSolved = 20
+	tacticsDepth     = 3
+)
+
+func TestTacticsSolved(t *testing.T) {
+	solved, total := 0, 0
+	for _, line := range strings.Split(tactics, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fen, bm, ok := strings.Cut(line, ";bm")
+		if !ok {
+			t.Fatalf("no best move in %q", line)
+		}
+		p := mustParseFen(t, strings.TrimSpace(fen))
+		var best []chess.Move
+		for _, uci := range strings.Fields(bm) {
+			best = append(best, mustParseMove(t, uci))
+		}
+		total++
+		if move := (AlphaBeta{Depth: tacticsDepth}).GetMove(p); slices.Contains(best, move) {
+			solved++
+		} else {
+			t.Logf("%s: played %s, want %s", fen, move, strings.TrimSpace(bm))
+		}
+	}
+	t.Logf("solved %d of %d tactics at depth %d", solved, total, tacticsDepth)
+	if solved < minTacticsSolved {
+		t.Errorf("solved %d of %d tactics at depth %d, want at least %d", solved, total, tacticsDepth, minTacticsSolved)
+	}
+}
@@ -0,0 +1,286 @@
+package alphabeta
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+// maxTableEntries bounds the transposition table. Once it is full, only positions already in it are updated until the
+// next search makes room.
+const maxTableEntries = 1 << 20
+
+// bound says how a stored score relates to the true score of its position.
+type bound uint8
+
+const (
+	exact bound = iota
+	lowerBound
+	upperBound
+)
+
+// tableEntry is the result of searching a position, stored in the transposition table by its Zobrist hash.
+type tableEntry struct {
+	depth int
+	score float64 // Mate scores count plies from this position rather than the root
+	bound bound
+	move  chess.Move
+	age   uint8 // Generation of the Table when it was stored
+}
+
+// tableStripes is how many parts the entries of a Table are split into by key, each behind a lock of its own, so that
+// searches sharing a Table seldom wait for each other.
+const tableStripes = 64
+
+// tableStripe holds the entries of a Table whose keys fall in it.
+type tableStripe struct {
+	mu      sync.Mutex
+	entries map[uint64]tableEntry
+}
+
+// Table is a transposition table kept between searches. The zero value is empty, and it may be shared by searches
+// running at once. Each search is a new generation of the table, and once it fills up the entries of older searches
+// are dropped first, so that the deep results of positions long gone don't crowd out those of the game as it is now.
+type Table struct {
+	stripes    [tableStripes]tableStripe
+	size       atomic.Int64 // Entries in all the stripes
+	mu         sync.Mutex   // Guards generation, and the dropping of old entries as a new one starts
+	generation uint8
+}
+
+// HashFull returns how full t is, in thousandths of the entries it can hold, as UCI's info hashfull reports it. A nil
+// Table is empty.
+func (t *Table) HashFull() int {
+	if t == nil {
+		return 0
+	}
+	return hashFull(t.len())
+}
+
+// hashFull converts a count of table entries to thousandths of maxTableEntries.
+func hashFull(entries int) int {
+	return entries * 1000 / maxTableEntries
+}
+
+// len returns the number of entries in t.
+func (t *Table) len() int {
+	return int(t.size.Load())
+}
+
+// stripe returns the part of t that key falls in.
+func (t *Table) stripe(key uint64) *tableStripe {
+	return &t.stripes[key%tableStripes]
+}
+
+// get returns the entry stored for key.
+func (t *Table) get(key uint64) (tableEntry, bool) {
+	stripe := t.stripe(key)
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	entry, ok := stripe.entries[key]
+	return entry, ok
+}
+
+// put stores entry for key, unless key is not in t yet and t already holds maxTableEntries.
+func (t *Table) put(key uint64, entry tableEntry) {
+	stripe := t.stripe(key)
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	if _, ok := stripe.entries[key]; !ok {
+		if t.size.Add(1) > maxTableEntries {
+			t.size.Add(-1)
+			return
+		}
+		if stripe.entries == nil {
+			stripe.entries = map[uint64]tableEntry{}
+		}
+	}
+	stripe.entries[key] = entry
+}
+
+// each calls f with every entry of t, one stripe at a time.
+func (t *Table) each(f func(key uint64, entry tableEntry)) {
+	for i := range t.stripes {
+		stripe := &t.stripes[i]
+		stripe.mu.Lock()
+		for key, entry := range stripe.entries {
+			f(key, entry)
+		}
+		stripe.mu.Unlock()
+	}
+}
+
+// drop deletes the entries of t that old reports true for.
+func (t *Table) drop(old func(entry tableEntry) bool) {
+	for i := range t.stripes {
+		stripe := &t.stripes[i]
+		stripe.mu.Lock()
+		for key, entry := range stripe.entries {
+			if old(entry) {
+				delete(stripe.entries, key)
+				t.size.Add(-1)
+			}
+		}
+		stripe.mu.Unlock()
+	}
+}
+
+// newGeneration starts a new search of t, returning the generation to store its entries with. Once t is full it keeps
+// only what the last search stored, and starts over if that still leaves it more than half full.
+func (t *Table) newGeneration() uint8 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.generation++
+	if t.len() >= maxTableEntries {
+		last := t.generation - 1
+		t.drop(func(entry tableEntry) bool { return entry.age != last })
+		if t.len() > maxTableEntries/2 {
+			t.drop(func(tableEntry) bool { return true })
+		}
+	}
+	return t.generation
+}
+
+// probe returns the stored result for p, hashed to key, searched ply half-moves into the search, if it was searched at
+// least depth deep and its score settles the window alpha to beta.
+func (s *searcher) probe(key uint64, depth int, ply int, alpha float64, beta float64) (chess.Move, float64, bool) {
+	entry, ok := s.table.get(key)
+	if !ok || entry.depth < depth {
+		return chess.Move{}, 0, false
+	}
+	score := fromTable(entry.score, ply)
+	if entry.bound == exact || (entry.bound == lowerBound && score >= beta) || (entry.bound == upperBound && score <= alpha) {
+		return entry.move, score, true
+	}
+	return chess.Move{}, 0, false
+}
+
+// store records the result of searching a position, hashed to key, with the window alpha to beta.
+func (s *searcher) store(key uint64, depth int, ply int, alpha float64, beta float64, move chess.Move, score float64) {
+	b := exact
+	if score <= alpha {
+		b = upperBound
+	} else if score >= beta {
+		b = lowerBound
+	}
+	s.table.put(key, tableEntry{depth: depth, score: toTable(score, ply), bound: b, move: move, age: s.generation})
+}
+
+// tableMagic and tableVersion start a saved Table, so that LoadTable rejects anything else.
+const (
+	tableMagic   = "ACTT"
+	tableVersion = 1
+)
+
+// tableRecord is an entry of a saved Table, in little endian with no padding.
+type tableRecord struct {
+	Key       uint64
+	Score     float64
+	Depth     int32
+	Bound     uint8
+	FromFile  uint8
+	FromRank  uint8
+	ToFile    uint8
+	ToRank    uint8
+	Promotion uint8
+}
+
+// SaveTable writes the entries of Table to w, to be read back by LoadTable in a later session.
+func (ab AlphaBeta) SaveTable(w io.Writer) error {
+	if ab.Table == nil {
+		return errors.New("no table to save")
+	}
+	var records []tableRecord
+	ab.Table.each(func(key uint64, entry tableEntry) {
+		records = append(records, tableRecord{
+			Key:       key,
+			Score:     entry.score,
+			Depth:     int32(entry.depth),
+			Bound:     uint8(entry.bound),
+			FromFile:  uint8(entry.move.FromSquare.File),
+			FromRank:  uint8(entry.move.FromSquare.Rank),
+			ToFile:    uint8(entry.move.ToSquare.File),
+			ToRank:    uint8(entry.move.ToSquare.Rank),
+			Promotion: uint8(entry.move.Promotion),
+		})
+	})
+	bw := bufio.NewWriter(w)
+	bw.WriteString(tableMagic)
+	binary.Write(bw, binary.LittleEndian, [2]uint32{tableVersion, uint32(len(records))})
+	binary.Write(bw, binary.LittleEndian, records)
+	return bw.Flush()
+}
+
+// LoadTable adds the entries SaveTable wrote to r to Table, replacing those of the same positions and counting as
+// stored by the latest search. It returns an error if Table is nil or r holds no saved table, leaving Table as it was.
+func (ab AlphaBeta) LoadTable(r io.Reader) error {
+	if ab.Table == nil {
+		return errors.New("no table to load into")
+	}
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(tableMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != tableMagic {
+		return errors.New("not a saved transposition table")
+	}
+	var header [2]uint32
+	if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("could not read table header: %w", err)
+	}
+	if header[0] != tableVersion {
+		return fmt.Errorf("saved table is version %d, want %d", header[0], tableVersion)
+	}
+	if header[1] > maxTableEntries {
+		return fmt.Errorf("saved table has %d entries, more than the %d a table holds", header[1], maxTableEntries)
+	}
+	records := make([]tableRecord, header[1])
+	if err := binary.Read(br, binary.LittleEndian, records); err != nil {
+		return fmt.Errorf("could not read table entries: %w", err)
+	}
+	ab.Table.mu.Lock()
+	generation := ab.Table.generation
+	ab.Table.mu.Unlock()
+	for _, record := range records {
+		ab.Table.put(record.Key, tableEntry{
+			depth: int(record.Depth),
+			score: record.Score,
+			bound: bound(record.Bound),
+			move: chess.Move{
+				FromSquare: chess.Square{File: chess.File(record.FromFile), Rank: chess.Rank(record.FromRank)},
+				ToSquare:   chess.Square{File: chess.File(record.ToFile), Rank: chess.Rank(record.ToRank)},
+				Promotion:  chess.PieceType(record.Promotion),
+			},
+			age: generation,
+		})
+	}
+	return nil
+}
+
+// toTable converts a mate score found ply half-moves into the search to count plies from the position it was found in,
+// so it stays right wherever the position recurs.
+func toTable(score float64, ply int) float64 {
+	if !eval.IsMateScore(score) {
+		return score
+	}
+	if score > 0 {
+		return score + float64(ply)
+	}
+	return score - float64(ply)
+}
+
+// fromTable reverses toTable for a position ply half-moves into the search.
+func fromTable(score float64, ply int) float64 {
+	if !eval.IsMateScore(score) {
+		return score
+	}
+	if score > 0 {
+		return score - float64(ply)
+	}
+	return score + float64(ply)
+}
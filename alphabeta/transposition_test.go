@@ -0,0 +1,211 @@
+package alphabeta
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/chess"
+)
+
+func TestHashFullCountsThousandths(t *testing.T) {
+	var table *Table
+	if full := table.HashFull(); full != 0 {
+		t.Errorf("nil table is %d thousandths full, want 0", full)
+	}
+	table = &Table{}
+	for i := range maxTableEntries / 4 {
+		table.put(uint64(i), tableEntry{})
+	}
+	if full := table.HashFull(); full != 250 {
+		t.Errorf("table with a quarter of its entries is %d thousandths full, want 250", full)
+	}
+}
+
+func TestStatsReportHashFull(t *testing.T) {
+	ab := AlphaBeta{Depth: 3, Table: &Table{}}
+	_, stats := ab.GetMoveStats(*chess.NewGame().Position())
+	if stats.HashFull != ab.Table.HashFull() {
+		t.Errorf("stats report hashfull %d, table is %d thousandths full", stats.HashFull, ab.Table.HashFull())
+	}
+	ab = AlphaBeta{Depth: 3, NoTransposition: true}
+	if _, stats := ab.GetMoveStats(*chess.NewGame().Position()); stats.HashFull != 0 {
+		t.Errorf("search without a table reports hashfull %d, want 0", stats.HashFull)
+	}
+}
+
+func TestFullTableKeepsLastSearch(t *testing.T) {
+	table := &Table{generation: 1}
+	for i := range maxTableEntries {
+		age := uint8(0)
+		if i%4 == 0 {
+			age = 1
+		}
+		table.put(uint64(i), tableEntry{age: age})
+	}
+	table.put(maxTableEntries, tableEntry{age: 1})
+	if _, ok := table.get(maxTableEntries); ok {
+		t.Errorf("full table took a new entry")
+	}
+	if generation := table.newGeneration(); generation != 2 {
+		t.Errorf("new search has generation %d, want 2", generation)
+	}
+	if table.len() != maxTableEntries/4 {
+		t.Errorf("full table kept %d entries, want the %d of the last search", table.len(), maxTableEntries/4)
+	}
+	table.each(func(key uint64, entry tableEntry) {
+		if entry.age != 1 {
+			t.Errorf("entry %d from generation %d kept", key, entry.age)
+		}
+	})
+}
+
+func TestKeptTableRaisesHitRate(t *testing.T) {
+	before := mustParseFen(t, "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	after := mustParseFen(t, "r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3")
+	ab := AlphaBeta{Depth: 3, Table: &Table{}}
+	ab.GetMoveStats(before)
+	_, kept := ab.GetMoveStats(after)
+	ab.Table = &Table{}
+	_, fresh := ab.GetMoveStats(after)
+	if kept.TTHitRate() <= fresh.TTHitRate() {
+		t.Errorf("hit rate is %.3f with the table of the last search, not above %.3f with a fresh one",
+			kept.TTHitRate(), fresh.TTHitRate())
+	}
+}
+
+func TestSaveTableRoundTrip(t *testing.T) {
+	p := *chess.NewGame().Position()
+	ab := AlphaBeta{Depth: 3, Table: &Table{}}
+	best := ab.GetMove(p)
+	var saved bytes.Buffer
+	if err := ab.SaveTable(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := AlphaBeta{Depth: 3, Table: &Table{}}
+	if err := loaded.LoadTable(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Table.len() != ab.Table.len() {
+		t.Fatalf("loaded %d entries, saved %d", loaded.Table.len(), ab.Table.len())
+	}
+	ab.Table.each(func(key uint64, entry tableEntry) {
+		got, _ := loaded.Table.get(key)
+		got.age = entry.age
+		if got != entry {
+			t.Errorf("entry %d loaded as %+v, saved as %+v", key, got, entry)
+		}
+	})
+	p.Move(best)
+	if want, got := ab.Predict(p), loaded.Predict(p); got != want || got == (chess.Move{}) {
+		t.Errorf("loaded table predicts the reply %s, saved one %s", got, want)
+	}
+}
+
+func TestLoadTableRejectsOtherData(t *testing.T) {
+	ab := AlphaBeta{Table: &Table{}}
+	if err := ab.LoadTable(strings.NewReader("not a table")); err == nil {
+		t.Error("loading text gave no error")
+	}
+	if err := (AlphaBeta{}).LoadTable(strings.NewReader(tableMagic)); err == nil {
+		t.Error("loading into a nil Table gave no error")
+	}
+	if ab.Table.len() != 0 {
+		t.Errorf("failed load left %d entries", ab.Table.len())
+	}
+}
+
+func TestPonderHandsTableToSearch(t *testing.T) {
+	// Pondering fills the table in the background, and is stopped and waited for before the next search takes it over.
+	ab := AlphaBeta{Depth: 3, Table: &Table{}}
+	p := *chess.NewGame().Position()
+	for range 3 {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ab.Ponder(ctx, p)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		<-done
+
+		filled := ab.Table.len()
+		_, stats := ab.GetMoveStats(p)
+		if filled == 0 || stats.TableHits == 0 {
+			t.Fatalf("pondering stored %d entries and the search after it had %d table hits, want both above 0",
+				filled, stats.TableHits)
+		}
+	}
+}
+
+// sharedEntry is the entry writer stores for key, so that an entry read back can be checked against its key and the
+// writer it names.
+func sharedEntry(key uint64, writer int) tableEntry {
+	return tableEntry{
+		depth: writer,
+		score: float64(key)*100 + float64(writer),
+		bound: bound(key % 3),
+		move:  chess.Move{ToSquare: chess.Square{File: chess.File(key%8 + 1), Rank: chess.Rank(writer%8 + 1)}},
+		age:   uint8(key),
+	}
+}
+
+func TestTableSharedAcrossGoroutines(t *testing.T) {
+	// The writers overwrite each other's entries for the same keys, but each entry read back must be whole.
+	const writers, keys, rounds = 16, 512, 20
+	table := &Table{}
+	var wg sync.WaitGroup
+	for writer := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := range rounds {
+				for i := range keys {
+					key := uint64((i*7 + writer + round) % keys)
+					table.put(key, sharedEntry(key, writer))
+					if entry, ok := table.get(key); !ok || entry != sharedEntry(key, entry.depth) {
+						t.Errorf("key %d read back as %+v, which no writer stored", key, entry)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if table.len() != keys {
+		t.Errorf("table holds %d entries, want one for each of the %d keys", table.len(), keys)
+	}
+	table.each(func(key uint64, entry tableEntry) {
+		if entry.depth < 0 || entry.depth >= writers || entry != sharedEntry(key, entry.depth) {
+			t.Errorf("key %d holds %+v, which no writer stored", key, entry)
+		}
+	})
+}
+
+// BenchmarkTableContention stores and probes random keys from several goroutines per CPU at once.
+func BenchmarkTableContention(b *testing.B) {
+	for _, goroutines := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("goroutines=%d", goroutines), func(b *testing.B) {
+			table := &Table{}
+			var seed atomic.Uint64
+			b.SetParallelism(goroutines)
+			b.RunParallel(func(pb *testing.PB) {
+				rng := agent.NewRand(seed.Add(1))
+				for pb.Next() {
+					key := rng.Uint64() % maxTableEntries
+					if _, ok := table.get(key); !ok {
+						table.put(key, tableEntry{depth: 1})
+					}
+				}
+			})
+		})
+	}
+}
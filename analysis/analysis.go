@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+// ScoredAgent is an agent that can score a position from white's perspective.
+type ScoredAgent interface {
+	Score(p chess.Position) float64
+}
+
+// MoveScores returns the score, from white's perspective, of the position reached by each legal move in p.
+func MoveScores(p chess.Position, agent ScoredAgent) map[chess.Move]float64 {
+	scores := map[chess.Move]float64{}
+	for _, move := range chess.GenerateLegalMoves(&p) {
+		newPos := p
+		newPos.Move(move)
+		scores[move] = agent.Score(newPos)
+	}
+	return scores
+}
+
+// RenderMoveScores draws the board from white's side. Each square holding a piece that can move shows the best score,
+// for the side to move, reachable by moving that piece. Other squares show a dot.
+func RenderMoveScores(scores map[chess.Move]float64, turn chess.Color) string {
+	best := map[chess.Square]float64{}
+	for move, score := range scores {
+		current, ok := best[move.FromSquare]
+		if !ok || (turn == chess.White && score > current) || (turn == chess.Black && score < current) {
+			best[move.FromSquare] = score
+		}
+	}
+
+	str := strings.Builder{}
+	for i, square := range chess.AllSquares {
+		if i%8 == 0 {
+			str.WriteString(square.Rank.String())
+		}
+		if score, ok := best[square]; ok {
+			fmt.Fprintf(&str, "%7s", FormatScore(score))
+		} else {
+			fmt.Fprintf(&str, "%7s", ".")
+		}
+		if i%8 == 7 {
+			str.WriteRune('\n')
+		}
+	}
+	str.WriteString(" ")
+	for _, file := range "ABCDEFGH" {
+		fmt.Fprintf(&str, "%7c", file)
+	}
+	return str.String()
+}
+
+// FormatScore formats a score in pawns, or as #N / #-N for a mate in N moves by white or black.
+func FormatScore(score float64) string {
+	if eval.IsMateScore(score) {
+		mateIn := eval.MateIn(score)
+		if score < 0 {
+			return fmt.Sprintf("#-%d", -mateIn)
+		}
+		return fmt.Sprintf("#%d", mateIn)
+	}
+	return fmt.Sprintf("%+.2f", score)
+}
+
+// AssessScore formats a score in centipawns from white's perspective together with a short description, such as
+// "+0.50 (White is slightly better)".
+func AssessScore(cp int) string {
+	score := float64(cp) / 100
+	side := "White"
+	if cp < 0 {
+		side = "Black"
+		cp = -cp
+	}
+
+	var assessment string
+	switch {
+	case eval.IsMateScore(score):
+		assessment = side + " has a forced mate"
+	case cp <= 25:
+		assessment = "The position is equal"
+	case cp <= 75:
+		assessment = side + " is slightly better"
+	case cp <= 150:
+		assessment = side + " is clearly better"
+	case cp <= 500:
+		assessment = side + " is winning"
+	default:
+		assessment = side + " is decisively ahead"
+	}
+	return fmt.Sprintf("%s (%s)", FormatScore(score), assessment)
+}
@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+// materialScorer is a ScoredAgent that counts material.
+type materialScorer struct{}
+
+func (materialScorer) Score(p chess.Position) float64 {
+	return eval.Material(&p, nil)
+}
+
+func TestMoveScoresCoverEveryMove(t *testing.T) {
+	// exd5 wins the queen.
+	p := mustParseFen(t, "4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1")
+	scores := MoveScores(p, materialScorer{})
+	legal := chess.GenerateLegalMoves(&p)
+	if len(scores) != len(legal) {
+		t.Errorf("%d moves scored, want the %d legal moves", len(scores), len(legal))
+	}
+	for _, move := range legal {
+		if _, ok := scores[move]; !ok {
+			t.Errorf("legal move %s has no score", move)
+		}
+	}
+
+	capture, err := chess.ParseUCIMove("e4d5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := FormatScore(scores[capture])
+	// The capture is scored on e4, the pawn's square, in the rank 4 row.
+	for _, row := range strings.Split(RenderMoveScores(scores, p.Turn), "\n") {
+		if strings.HasPrefix(row, "4") {
+			if fields := strings.Fields(row); len(fields) != 9 || fields[5] != best {
+				t.Errorf("rank 4 is drawn as %q, want %s on e4", row, best)
+			}
+			return
+		}
+	}
+	t.Error("no row for rank 4")
+}
+
+func TestAssessScoreBands(t *testing.T) {
+	for _, tc := range []struct {
+		cp   int
+		want string
+	}{
+		{0, "+0.00 (The position is equal)"},
+		{25, "+0.25 (The position is equal)"},
+		{-25, "-0.25 (The position is equal)"},
+		{26, "+0.26 (White is slightly better)"},
+		{75, "+0.75 (White is slightly better)"},
+		{-76, "-0.76 (Black is clearly better)"},
+		{150, "+1.50 (White is clearly better)"},
+		{151, "+1.51 (White is winning)"},
+		{-500, "-5.00 (Black is winning)"},
+		{501, "+5.01 (White is decisively ahead)"},
+		{int(math.Round((eval.MateScore - 3) * 100)), "#2 (White has a forced mate)"},
+		{int(math.Round((-eval.MateScore + 1) * 100)), "#-1 (Black has a forced mate)"},
+	} {
+		if got := AssessScore(tc.cp); got != tc.want {
+			t.Errorf("AssessScore(%d) = %q, want %q", tc.cp, got, tc.want)
+		}
+	}
+}
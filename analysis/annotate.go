@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/chess"
+)
+
+// Pawns a move must lose against the best alternative to be flagged.
+const (
+	inaccuracy = 0.5
+	mistake    = 1
+	blunder    = 3
+)
+
+// Annotation assesses a move of a game against the move the search prefers.
+type Annotation struct {
+	Move      chess.Move
+	Score     float64 // Of Move, from white's perspective
+	Best      chess.Move
+	BestScore float64 // Of Best, from white's perspective
+	Delta     float64 // Pawns the mover gave up by playing Move instead of Best, never negative
+}
+
+// Flag returns "??" for a blunder, "?" for a mistake, "?!" for an inaccuracy and "" otherwise, judged by Delta.
+func (a Annotation) Flag() string {
+	switch {
+	case a.Delta >= blunder:
+		return "??"
+	case a.Delta >= mistake:
+		return "?"
+	case a.Delta >= inaccuracy:
+		return "?!"
+	}
+	return ""
+}
+
+// String formats a in UCI notation, such as "e2e4? +0.10 best d2d4 +1.20 delta 1.10".
+func (a Annotation) String() string {
+	return fmt.Sprintf("%s%s %s best %s %s delta %.2f", a.Move, a.Flag(), FormatScore(a.Score), a.Best,
+		FormatScore(a.BestScore), a.Delta)
+}
+
+// Annotate plays moves from start and, at each ply, compares the score of the move played with that of the best move,
+// both searched by ab to ab.Depth. It returns an error if a move is not legal.
+func Annotate(start chess.Position, moves []chess.Move, ab alphabeta.AlphaBeta) ([]Annotation, error) {
+	annotations := make([]Annotation, 0, len(moves))
+	p := start
+	for _, move := range moves {
+		score, err := ab.ScoreMove(p, move, ab.Depth)
+		if err != nil {
+			return annotations, err
+		}
+		best, stats := ab.GetMoveStats(p)
+		a := Annotation{Move: move, Score: score, Best: best, BestScore: stats.Score}
+		if best == move {
+			// Searching with MaxNodes can reach a different depth than ScoreMove, so keep the played score.
+			a.BestScore = score
+		}
+		a.Delta = a.BestScore - a.Score
+		if p.Turn == chess.Black {
+			a.Delta = -a.Delta
+		}
+		a.Delta = max(a.Delta, 0)
+		annotations = append(annotations, a)
+		p.Move(move)
+	}
+	return annotations, nil
+}
@@ -0,0 +1,46 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/chess"
+)
+
+func TestAnnotateFindsBestAlternativeToBlunder(t *testing.T) {
+	// Black's queen wanders to g5, and white develops instead of taking it with Nxg5.
+	var moves []chess.Move
+	for _, uci := range []string{"e2e4", "e7e5", "g1f3", "d8g5", "b1c3"} {
+		move, err := chess.ParseUCIMove(uci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		moves = append(moves, move)
+	}
+	annotations, err := Annotate(*chess.NewGame().Position(), moves, alphabeta.AlphaBeta{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != len(moves) {
+		t.Fatalf("got %d annotations for %d moves", len(annotations), len(moves))
+	}
+
+	missed := annotations[4]
+	capture, err := chess.ParseUCIMove("f3g5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missed.Best != capture || missed.Delta < blunder || missed.Flag() != "??" {
+		t.Errorf("annotated Nc3 as %s, want a blunder with best alternative %s", missed, capture)
+	}
+	if !strings.Contains(missed.String(), "best "+capture.String()) {
+		t.Errorf("annotation %q does not name the best alternative %s", missed, capture)
+	}
+	if hang := annotations[3]; hang.Best == moves[3] || hang.Delta < blunder {
+		t.Errorf("annotated Qg5 as %s, want a blunder with a different best move", hang)
+	}
+	if opening := annotations[0]; opening.Delta >= inaccuracy || opening.Flag() != "" {
+		t.Errorf("annotated e4 as %s, want it unflagged", opening)
+	}
+}
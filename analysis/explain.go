@@ -0,0 +1,106 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+var pieceNames = map[chess.PieceType]string{
+	chess.Pawn:   "pawn",
+	chess.Knight: "knight",
+	chess.Bishop: "bishop",
+	chess.Rook:   "rook",
+	chess.Queen:  "queen",
+	chess.King:   "king",
+}
+
+// Explain returns a sentence describing what m, played from p, does, such as "Nf3 develops a piece and controls the
+// center." It only looks at the move itself and the positions before and after it, not at any search.
+func Explain(p chess.Position, m chess.Move) string {
+	san := m.SanString(&p)
+	mover := p.Turn
+	piece := p.PieceAt(m.FromSquare)
+	newPos := p
+	newPos.Move(m)
+	if chess.IsCheckMate(&newPos) {
+		return san + " delivers checkmate."
+	}
+
+	reasons := []string{}
+	captured := p.PieceAt(m.ToSquare).Type
+	if captured == chess.NoPieceType && piece.Type == chess.Pawn && m.FromSquare.File != m.ToSquare.File {
+		captured = chess.Pawn
+	}
+	if captured != chess.NoPieceType {
+		gained := eval.MaterialBalance(&newPos) - eval.MaterialBalance(&p)
+		if mover == chess.Black {
+			gained = -gained
+		}
+		reasons = append(reasons, fmt.Sprintf("captures a %s, winning %d %s of material", pieceNames[captured], gained,
+			plural("pawn", gained)))
+	}
+	if m.Promotion != chess.NoPieceType {
+		reasons = append(reasons, "promotes to a "+pieceNames[m.Promotion])
+	}
+	if piece.Type == chess.King && absDiff(int(m.FromSquare.File), int(m.ToSquare.File)) == 2 {
+		reasons = append(reasons, "castles the king to safety")
+	}
+	if (piece.Type == chess.Knight || piece.Type == chess.Bishop) && isHomeSquare(m.FromSquare, mover) {
+		reasons = append(reasons, "develops a piece")
+	}
+	if isCenter(m.ToSquare) {
+		reasons = append(reasons, "controls the center")
+	}
+	if chess.IsCheck(&newPos) {
+		reasons = append(reasons, "gives check")
+	}
+
+	if len(reasons) == 0 {
+		improvement := eval.Evaluate(&newPos, nil) - eval.Evaluate(&p, nil)
+		if mover == chess.Black {
+			improvement = -improvement
+		}
+		if improvement > 0.1 {
+			reasons = append(reasons, fmt.Sprintf("improves the position by %.2f", improvement))
+		} else {
+			reasons = append(reasons, "makes a quiet move")
+		}
+	}
+	return san + " " + joinReasons(reasons) + "."
+}
+
+func isHomeSquare(s chess.Square, c chess.Color) bool {
+	if c == chess.White {
+		return s.Rank == chess.Rank1
+	}
+	return s.Rank == chess.Rank8
+}
+
+func isCenter(s chess.Square) bool {
+	return (s.File == chess.FileD || s.File == chess.FileE) && (s.Rank == chess.Rank4 || s.Rank == chess.Rank5)
+}
+
+// joinReasons joins reasons as "a", "a and b" or "a, b and c".
+func joinReasons(reasons []string) string {
+	if len(reasons) == 1 {
+		return reasons[0]
+	}
+	return strings.Join(reasons[:len(reasons)-1], ", ") + " and " + reasons[len(reasons)-1]
+}
+
+func plural(word string, n int) string {
+	if n == 1 || n == -1 {
+		return word
+	}
+	return word + "s"
+}
+
+func absDiff(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
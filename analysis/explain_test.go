@@ -0,0 +1,28 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestExplain(t *testing.T) {
+	for _, tc := range []struct {
+		fen, move, want string
+	}{
+		{"4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1", "e4d5",
+			"exd5 captures a queen, winning 9 pawns of material and controls the center."},
+		{chess.DefaultFen, "g1f3", "Nf3 develops a piece."},
+		{chess.DefaultFen, "e2e4", "e4 controls the center."},
+		{"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", "b8c6", "Nc6 develops a piece."},
+		{"r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4", "h5f7", "Qxf7# delivers checkmate."},
+	} {
+		move, err := chess.ParseUCIMove(tc.move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Explain(mustParseFen(t, tc.fen), move); got != tc.want {
+			t.Errorf("Explain(%s) from %s = %q, want %q", tc.move, tc.fen, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/applechess.git/analysis"
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+// analyzeBatch searches every FEN read from r, one per line, with ab and writes a tab separated row of the FEN, best
+// move and score for each to w in input order. Searches run on threads goroutines.
+func analyzeBatch(r io.Reader, w io.Writer, ab alphabeta.AlphaBeta, threads int) error {
+	fens, err := readFens(r)
+	if err != nil {
+		return err
+	}
+	rows := make([]string, len(fens))
+	forEach(len(fens), threads, func(i int) {
+		rows[i] = analyzeRow(fens[i], ab)
+	})
+	for _, row := range rows {
+		if _, err := fmt.Fprintln(w, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instabilityBatch measures the instability of every FEN read from r, one per line, searched to ab.Depth, and writes
+// the top most unstable as tab separated rows of the FEN, instability and static evaluation, most unstable first.
+// Positions that fail to parse are skipped. Searches run on threads goroutines.
+func instabilityBatch(r io.Reader, w io.Writer, ab alphabeta.AlphaBeta, threads int, top int) error {
+	fens, err := readFens(r)
+	if err != nil {
+		return err
+	}
+	type row struct {
+		fen         string
+		static      float64
+		instability float64
+	}
+	rows := make([]row, len(fens))
+	forEach(len(fens), threads, func(i int) {
+		rows[i] = row{fen: fens[i], instability: -1}
+		p, err := chess.ParseFen(fens[i])
+		if err != nil || !chess.IsValidPosition(p) {
+			return
+		}
+		rows[i].static = eval.Evaluate(p, ab.Weights)
+		rows[i].instability = ab.Instability(*p, ab.Depth)
+	})
+	slices.SortStableFunc(rows, func(a, b row) int {
+		return cmp.Compare(b.instability, a.instability)
+	})
+	for i, row := range rows {
+		if i == top || row.instability < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%.2f\t%s\n", row.fen, row.instability, analysis.FormatScore(row.static)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFens reads the non-blank lines of r.
+func readFens(r io.Reader) ([]string, error) {
+	fens := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if fen := strings.TrimSpace(scanner.Text()); fen != "" {
+			fens = append(fens, fen)
+		}
+	}
+	return fens, scanner.Err()
+}
+
+// forEach calls f with every index below n, spread over threads goroutines, and returns once all calls are done.
+func forEach(n int, threads int, f func(i int)) {
+	if threads < 1 {
+		threads = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				f(j)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func analyzeRow(fen string, ab alphabeta.AlphaBeta) string {
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		return fmt.Sprintf("%s\terror: %s", fen, err)
+	}
+	move, stats := ab.GetMoveStats(*p)
+	if move == (chess.Move{}) {
+		return fmt.Sprintf("%s\terror: no move found", fen)
+	}
+	return fmt.Sprintf("%s\t%s\t%s", fen, move, analysis.FormatScore(stats.Score))
+}
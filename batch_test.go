@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/chess"
+)
+
+func TestAnalyzeBatchKeepsInputOrder(t *testing.T) {
+	positions := []string{
+		chess.DefaultFen,
+		"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1",
+		"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3",
+		"not a fen",
+		"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1",
+		"8/8/4k3/8/8/3K4/8/8 b - - 0 1",
+	}
+	fens := []string{}
+	for range 10 {
+		fens = append(fens, positions...)
+	}
+	var out strings.Builder
+	err := analyzeBatch(strings.NewReader(strings.Join(fens, "\n")+"\n\n"), &out, alphabeta.AlphaBeta{Depth: 1}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(rows) != len(fens) {
+		t.Fatalf("got %d rows for %d FENs", len(rows), len(fens))
+	}
+	for i, row := range rows {
+		fields := strings.Split(row, "\t")
+		if fields[0] != fens[i] {
+			t.Errorf("row %d is for %q, want %q", i+1, fields[0], fens[i])
+		}
+		if wantError := fens[i] == "not a fen"; wantError != strings.HasPrefix(fields[1], "error:") {
+			t.Errorf("row %d is %q, want an error only for the unparsable FEN", i+1, row)
+		}
+	}
+}
+
+func TestInstabilityBatchListsMostUnstableFirst(t *testing.T) {
+	hanging := "rnbqkbnr/pppp1ppp/8/4p3/3Q4/8/PPP1PPPP/RNB1KBNR b KQkq - 0 1"
+	input := strings.Join([]string{chess.DefaultFen, "not a fen", hanging, "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"}, "\n")
+	var out strings.Builder
+	if err := instabilityBatch(strings.NewReader(input), &out, alphabeta.AlphaBeta{Depth: 2}, 4, 2); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(rows) != 2 || !strings.HasPrefix(rows[0], hanging+"\t") {
+		t.Errorf("got rows %q, want the top 2 with the hanging queen first", rows)
+	}
+}
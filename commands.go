@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/applechess.git/analysis"
+	"github.com/brighamskarda/applechess.git/mcts"
+	"github.com/brighamskarda/applechess.git/minmax"
+	"github.com/brighamskarda/applechess.git/perft"
+	"github.com/brighamskarda/applechess.git/pgn"
+	"github.com/brighamskarda/applechess.git/uci"
+	"github.com/brighamskarda/chess"
+)
+
+// benchPositions are searched by the bench command. They cover the opening, a busy middlegame and an endgame.
+var benchPositions = []string{
+	chess.DefaultFen,
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N1PN2/PP2BPPP/R2QKB1R w KQ - 0 8",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1",
+}
+
+func analyzeCommand(args []string) error {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	fen := flags.String("fen", chess.DefaultFen, "position to analyze")
+	depth := flags.Int("depth", 3, "search depth")
+	batch := flags.Bool("batch", false, "analyze FENs read from stdin, one per line, instead of -fen")
+	threads := flags.Int("threads", runtime.NumCPU(), "positions to analyze at once with -batch")
+	unstable := flags.Int("unstable", 0, "with -batch, list this many positions whose static evaluation most disagrees with the search instead")
+	logLevel := flags.String("log", "ERROR", "logging level [ERROR|WARN|INFO|DEBUG]")
+	flags.Parse(args)
+	setLogLevel(*logLevel)
+
+	if *batch && *unstable > 0 {
+		return instabilityBatch(os.Stdin, os.Stdout, alphabeta.AlphaBeta{Depth: *depth}, *threads, *unstable)
+	}
+	if *batch {
+		return analyzeBatch(os.Stdin, os.Stdout, alphabeta.AlphaBeta{Depth: *depth}, *threads)
+	}
+
+	p, err := chess.ParseFen(*fen)
+	if err != nil {
+		return fmt.Errorf("could not parse -fen argument: %w", err)
+	}
+	move, stats := alphabeta.AlphaBeta{Depth: *depth}.GetMoveStats(*p)
+	if move == (chess.Move{}) {
+		return fmt.Errorf("no move found for %s", *fen)
+	}
+	fmt.Printf("bestmove %s (%s) score %s nodes %d\n", move, pgn.San(move, p), analysis.AssessScore(int(math.Round(stats.Score*100))), stats.Nodes)
+	fmt.Println("pv", pgn.Line(*p, stats.PV))
+	fmt.Println(analysis.Explain(*p, move))
+	return nil
+}
+
+func benchCommand(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	depth := flags.Int("depth", 2, "search depth")
+	nullMove := flags.Bool("nullmove", false, "search with null-move pruning")
+	logLevel := flags.String("log", "ERROR", "logging level [ERROR|WARN|INFO|DEBUG]")
+	flags.Parse(args)
+	setLogLevel(*logLevel)
+
+	var totalNodes uint64
+	var totalTime time.Duration
+	for _, fen := range benchPositions {
+		p, err := chess.ParseFen(fen)
+		if err != nil {
+			return fmt.Errorf("invalid bench position %s: %w", fen, err)
+		}
+		startTime := time.Now()
+		move, stats := alphabeta.AlphaBeta{Depth: *depth, UseNullMove: *nullMove}.GetMoveStats(*p)
+		elapsed := time.Since(startTime)
+		totalNodes += stats.Nodes
+		totalTime += elapsed
+		fmt.Printf("%s: %s nodes %d time %s\n", fen, move, stats.Nodes, elapsed)
+	}
+	fmt.Printf("total nodes %d time %s nps %.0f\n", totalNodes, totalTime, float64(totalNodes)/totalTime.Seconds())
+	return nil
+}
+
+func perftCommand(args []string) error {
+	flags := flag.NewFlagSet("perft", flag.ExitOnError)
+	fen := flags.String("fen", chess.DefaultFen, "position to count from")
+	depth := flags.Int("depth", 3, "perft depth, or the deepest annotated depth to check with -suite")
+	suite := flags.String("suite", "", "EPD perft suite to check, such as perftsuite.epd")
+	flags.Parse(args)
+
+	if *suite != "" {
+		failures, err := perft.RunPerftSuite(*suite, *depth)
+		for _, failure := range failures {
+			fmt.Println(failure)
+		}
+		if err != nil {
+			return fmt.Errorf("could not run perft suite: %w", err)
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("%d perft suite failures", len(failures))
+		}
+		fmt.Println("perft suite passed")
+		return nil
+	}
+
+	p, err := chess.ParseFen(*fen)
+	if err != nil {
+		return fmt.Errorf("could not parse -fen argument: %w", err)
+	}
+	startTime := time.Now()
+	nodes := perft.Perft(*p, *depth)
+	fmt.Printf("perft(%d) = %d time %s\n", *depth, nodes, time.Since(startTime))
+	return nil
+}
+
+func uciCommand(args []string) error {
+	flags := flag.NewFlagSet("uci", flag.ExitOnError)
+	spec := flags.String("agent", "ab:depth=4", "agent to play with, as for -p1 of play. mcts thinks for the time the GUI allows.")
+	logLevel := flags.String("log", "ERROR", "logging level [ERROR|WARN|INFO|DEBUG]")
+	flags.Parse(args)
+	setLogLevel(*logLevel)
+
+	base, err := parseAgentSpec(*spec, 2)
+	if err != nil {
+		return fmt.Errorf("could not parse -agent argument: %w", err)
+	}
+	engine := uci.Engine{
+		Name:   "applechess " + *spec,
+		Author: "Brigham Skarda",
+		NewAgent: func(p chess.Position, limits uci.Limits) uci.Agent {
+			return uciAgent(base, p, limits)
+		},
+	}
+	return engine.Run(os.Stdin, os.Stdout)
+}
+
+// uciAgent adapts base to the limits of a UCI go command for p. mcts searches for the time budget, and alphabeta stops
+// deepening within it and reports its search. The depth based agents search to a depth the GUI asks for.
+func uciAgent(base ChessAgent, p chess.Position, limits uci.Limits) ChessAgent {
+	switch agent := base.(type) {
+	case mcts.Mcts:
+		if budget := limits.Budget(p.Turn); budget > 0 {
+			agent.MaxTime = budget
+		}
+		return agent
+	case alphabeta.AlphaBeta:
+		if limits.Depth > 0 {
+			agent.Depth = limits.Depth
+		}
+		if budget := limits.Budget(p.Turn); budget > 0 {
+			agent.MaxTime = budget
+		}
+		return uciAlphaBeta{agent}
+	case minmax.Minmax:
+		if limits.Depth > 0 {
+			agent.Depth = limits.Depth
+		}
+		return agent
+	}
+	return base
+}
+
+// uciAlphaBeta is an alphabeta agent that reports the depth, nodes and transposition table use of its search to the
+// GUI, with the table's hit rate as an info string.
+type uciAlphaBeta struct {
+	alphabeta.AlphaBeta
+}
+
+func (ab uciAlphaBeta) GetMoveInfo(ctx context.Context, p chess.Position) (chess.Move, uci.Info, error) {
+	move, stats, err := ab.GetMoveStatsContext(ctx, p)
+	info := uci.Info{Depth: stats.Depth, Nodes: stats.Nodes, HashFull: stats.HashFull}
+	if stats.TableProbes > 0 {
+		info.Text = fmt.Sprintf("tt hit rate %.3f", stats.TTHitRate())
+	}
+	return move, info, err
+}
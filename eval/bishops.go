@@ -0,0 +1,52 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// badBishops scores each bishop by the friendly pawns on the other color minus those on its own color, which block
+// its diagonals. A blocked central pawn on the bishop's color counts double, since it will not move off that color.
+func badBishops(p *chess.Position, w *Weights) float64 {
+	return badBishopsFor(p, chess.White, w) - badBishopsFor(p, chess.Black, w)
+}
+
+func badBishopsFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	var bishops, pawns []chess.Square
+	for _, square := range chess.AllSquares {
+		piece := p.PieceAt(square)
+		if piece.Color != c {
+			continue
+		}
+		switch piece.Type {
+		case chess.Bishop:
+			bishops = append(bishops, square)
+		case chess.Pawn:
+			pawns = append(pawns, square)
+		}
+	}
+
+	forward := 1
+	if c == chess.Black {
+		forward = -1
+	}
+	total := 0
+	for _, bishop := range bishops {
+		for _, pawn := range pawns {
+			if squareColor(pawn) != squareColor(bishop) {
+				total++
+				continue
+			}
+			total--
+			front := chess.Square{File: pawn.File, Rank: chess.Rank(int(pawn.Rank) + forward)}
+			if (pawn.File == chess.FileD || pawn.File == chess.FileE) && p.PieceAt(front) != chess.NoPiece {
+				total--
+			}
+		}
+	}
+	return float64(total) * w.BadBishop
+}
+
+// squareColor returns 0 for dark squares and 1 for light ones.
+func squareColor(s chess.Square) int {
+	return (int(s.File) + int(s.Rank)) % 2
+}
@@ -0,0 +1,28 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBadBishopScoresBelowGoodBishop(t *testing.T) {
+	// White's bishop on f1 is light squared. In bad its pawns stand on c4 and e4, light squares, with e4 blocked by
+	// e5. In good they stand on c3 and e3, dark squares.
+	bad := mustParseFen(t, "4k3/8/8/4p3/2P1P3/8/8/4KB2 w - - 0 1")
+	good := mustParseFen(t, "4k3/8/8/4p3/8/2P1P3/8/4KB2 w - - 0 1")
+	// c4 costs one pawn's weight and the blocked e4 two.
+	if got, want := badBishops(&bad, &DefaultWeights), -3*DefaultWeights.BadBishop; math.Abs(got-want) > 1e-9 {
+		t.Errorf("bishop behind its own light pawns scores %v, want %v", got, want)
+	}
+	if got, want := badBishops(&good, &DefaultWeights), 2*DefaultWeights.BadBishop; math.Abs(got-want) > 1e-9 {
+		t.Errorf("bishop with its pawns on dark squares scores %v, want %v", got, want)
+	}
+
+	noBadBishop := without(func(w *Weights) { w.BadBishop = 0 })
+	if Evaluate(&bad, nil) >= Evaluate(&bad, noBadBishop) {
+		t.Errorf("BadBishop does not lower the score of the bad bishop")
+	}
+	if Evaluate(&good, nil) <= Evaluate(&good, noBadBishop) {
+		t.Errorf("BadBishop does not raise the score of the good bishop")
+	}
+}
@@ -0,0 +1,80 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// development rewards each minor piece moved off its starting square with w.Development and a castled king with
+// w.Castled, scaled by phase so it fades as pieces are traded. The castled bonus comes on top of the UncastledKing
+// penalty, which only applies while the enemy has heavy pieces.
+func development(p *chess.Position, w *Weights) float64 {
+	return (developmentFor(p, chess.White, w) - developmentFor(p, chess.Black, w)) * phase(p)
+}
+
+func developmentFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	total := float64(4-undevelopedMinors(p, c)) * w.Development
+	if castled(p, c) {
+		total += w.Castled
+	}
+	return total
+}
+
+// castled reports whether c's king stands on its home rank on a wing it castles to.
+func castled(p *chess.Position, c chess.Color) bool {
+	king := findPiece(p, chess.Piece{Color: c, Type: chess.King})
+	homeRank := chess.Rank1
+	if c == chess.Black {
+		homeRank = chess.Rank8
+	}
+	if king == chess.NoSquare || king.Rank != homeRank {
+		return false
+	}
+	switch king.File {
+	case chess.FileA, chess.FileB, chess.FileC, chess.FileG, chess.FileH:
+		return true
+	}
+	return false
+}
+
+// RepeatedMinorMove scores playing move from p, from white's perspective, when it moves a knight or bishop for a
+// second time in the opening while the mover still has another on its starting square: -w.RepeatedMinorMove for white
+// and w.RepeatedMinorMove for black. history holds the positions of the game before p, oldest first. A minor piece has
+// moved if it is off its starting square or that square held something else at some point in history, so that one
+// which went out and came back counts too. Any other move scores 0.
+func RepeatedMinorMove(history []chess.Position, p *chess.Position, move chess.Move, w *Weights) float64 {
+	if w.RepeatedMinorMove == 0 || GamePhase(p) != Opening {
+		return 0
+	}
+	piece := p.PieceAt(move.FromSquare)
+	if piece.Type != chess.Knight && piece.Type != chess.Bishop {
+		return 0
+	}
+	startSquares := []chess.Square{chess.B1, chess.C1, chess.F1, chess.G1}
+	if piece.Color == chess.Black {
+		startSquares = []chess.Square{chess.B8, chess.C8, chess.F8, chess.G8}
+	}
+	stayedHome := func(square chess.Square) bool {
+		home := p.PieceAt(square)
+		if home.Color != piece.Color || (home.Type != chess.Knight && home.Type != chess.Bishop) {
+			return false
+		}
+		for i := range history {
+			if history[i].PieceAt(square) != home {
+				return false
+			}
+		}
+		return true
+	}
+	if stayedHome(move.FromSquare) {
+		return 0
+	}
+	for _, square := range startSquares {
+		if square != move.FromSquare && stayedHome(square) {
+			if piece.Color == chess.White {
+				return -w.RepeatedMinorMove
+			}
+			return w.RepeatedMinorMove
+		}
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseMove(t *testing.T, uci string) chess.Move {
+	t.Helper()
+	move, err := chess.ParseUCIMove(uci)
+	if err != nil {
+		t.Fatalf("could not parse move %s: %v", uci, err)
+	}
+	return move
+}
+
+// playLine plays the moves of line from the starting position, and returns the position reached and those before it,
+// oldest first.
+func playLine(t *testing.T, line ...string) (chess.Position, []chess.Position) {
+	t.Helper()
+	p := *chess.NewGame().Position()
+	var history []chess.Position
+	for _, uci := range line {
+		history = append(history, p)
+		p.Move(mustParseMove(t, uci))
+	}
+	return p, history
+}
+
+func TestRepeatedMinorMove(t *testing.T) {
+	w := &DefaultWeights
+	p, history := playLine(t, "g1f3", "e7e5")
+	for _, tc := range []struct {
+		move string
+		want float64
+	}{
+		{"f3g5", -w.RepeatedMinorMove}, // The same knight again
+		{"b1c3", 0},                    // A new knight
+		{"e2e4", 0},                    // Not a minor piece
+	} {
+		if got := RepeatedMinorMove(history, &p, mustParseMove(t, tc.move), w); got != tc.want {
+			t.Errorf("after 1. Nf3 e5, %s scores %v, want %v", tc.move, got, tc.want)
+		}
+	}
+
+	// Black's knight went out and came back, which only the history shows.
+	p, history = playLine(t, "e2e4", "g8f6", "d2d4", "f6g8", "b1c3")
+	move := mustParseMove(t, "g8f6")
+	if got := RepeatedMinorMove(history, &p, move, w); got != w.RepeatedMinorMove {
+		t.Errorf("knight that returned home scores %v going out again, want %v", got, w.RepeatedMinorMove)
+	}
+	if got := RepeatedMinorMove(nil, &p, move, w); got != 0 {
+		t.Errorf("knight on its starting square scores %v without history, want 0", got)
+	}
+
+	// Once every other minor piece is out, moving one again is fine.
+	p, history = playLine(t, "g1f3", "g8f6", "b1c3", "b8c6", "f1c4", "f8c5", "c1g5", "c8g4")
+	if got := RepeatedMinorMove(history, &p, mustParseMove(t, "f3e5"), w); got != 0 {
+		t.Errorf("moving a knight again with all minors developed scores %v, want 0", got)
+	}
+}
+
+func TestDevelopedSideScoresHigher(t *testing.T) {
+	// The same material and pawns, with white's minor pieces out and its king castled in the first.
+	developed := mustParseFen(t, "rnbqkbnr/pppp1ppp/8/4p3/2BPPB2/2N2N2/PPP2PPP/R2Q1RK1 w kq - 0 1")
+	undeveloped := mustParseFen(t, "rnbqkbnr/pppp1ppp/8/4p3/3PP3/8/PPP2PPP/RNBQKBNR w KQkq - 0 1")
+	want := (4*DefaultWeights.Development + DefaultWeights.Castled) * phase(&developed)
+	if got := development(&developed, &DefaultWeights); math.Abs(got-want) > 1e-9 {
+		t.Errorf("four minors out and castled scores %v, want %v", got, want)
+	}
+	if got := development(&undeveloped, &DefaultWeights); got != 0 {
+		t.Errorf("no minors out scores %v, want 0", got)
+	}
+	if Evaluate(&developed, nil) <= Evaluate(&undeveloped, nil) {
+		t.Errorf("developed position scores %v, want more than the undeveloped %v", Evaluate(&developed, nil),
+			Evaluate(&undeveloped, nil))
+	}
+	noDevelopment := without(func(w *Weights) { w.Development, w.Castled = 0, 0 })
+	if Evaluate(&developed, nil) <= Evaluate(&developed, noDevelopment) {
+		t.Errorf("Development and Castled do not raise the score of the developed position")
+	}
+}
@@ -0,0 +1,338 @@
+package eval
+
+import (
+	"log/slog"
+	"math"
+
+	"github.com/brighamskarda/chess"
+)
+
+// MateScore is the score for delivering checkmate. A mate found ply half-moves into the search scores about
+// MateScore - ply, so shorter mates score higher. It is far above any material or positional score.
+const MateScore = 1e9
+
+// StaleMatePieces is the number of pieces, king included, at or below which a side is worth checking for stalemate at
+// the search horizon.
+const StaleMatePieces = 4
+
+// MaxEval bounds the magnitude of any score Evaluate returns, keeping everything beyond it for mate scores.
+const MaxEval = 30
+
+// maxMatePly bounds how far from MateScore a score can be and still be treated as a mate.
+const maxMatePly = 10000
+
+// Weights configures the terms used by Evaluate. All values are in pawns.
+type Weights struct {
+	Pawn   float64
+	Knight float64
+	Bishop float64
+	Rook   float64
+	Queen  float64
+
+	// Per own pawn above five, added to each knight and taken from each rook. Kaufman suggests 1/16 and 1/8.
+	// 0 disables.
+	KnightPawnAdjust float64
+	RookPawnAdjust   float64
+
+	Check float64 // Bonus per pseudo-legal check available
+
+	// Bonus per pseudo-legal move of each piece type
+	KnightMobility float64
+	BishopMobility float64
+	RookMobility   float64
+	QueenMobility  float64
+
+	EarlyQueen        float64 // Penalty for a queen leaving its square before MinorsBeforeQueen minors are developed
+	MinorsBeforeQueen int
+
+	Development float64 // Bonus per minor piece off its starting square, scaled by phase
+	Castled     float64 // Bonus for a king castled to either wing, scaled by phase
+
+	// RepeatedMinorMove is the penalty for moving a minor piece again in the opening before the others are developed.
+	// It scores moves rather than positions, so Evaluate leaves it out, and the search counts it for the move it plays.
+	RepeatedMinorMove float64
+
+	KPKWin float64 // Bonus for a won king and pawn versus king endgame
+
+	DoubledRooks   float64 // Bonus for two rooks on a file without friendly pawns
+	ConnectedRooks float64 // Bonus for rooks defending each other on the back rank, scaled by phase
+
+	PromotionRace float64 // Bonus for the passed pawn closest to queening, scaled up in the endgame
+
+	PawnShield    float64 // Penalty per pawn advanced from in front of a castled king, scaled by enemy pieces on that wing
+	UncastledKing float64 // Penalty for a king stuck in the center while enemy heavy pieces remain, scaled by phase
+	KingOpenFile  float64 // Penalty per open file on or beside the king, half if half-open, scaled by phase
+
+	DoubledPawn  float64 // Penalty per pawn beyond the first on a file
+	IsolatedPawn float64 // Penalty per pawn without friendly pawns on the adjacent files
+	BackwardPawn float64 // Penalty per pawn left behind its neighbours with its next square guarded by an enemy pawn
+	PassedPawn   float64 // Bonus per rank a passed pawn has advanced
+
+	BadBishop float64 // Per friendly pawn, bonus when off a bishop's color and penalty when on it
+
+	KingPressure float64 // Bonus per rook or queen lined up on the enemy king's file, or queen on its diagonal, through pawns
+	PawnStorm    float64 // With kings castled on opposite wings, bonus per rank pawns near the enemy king have advanced
+
+	PieceSquare       float64 // Scales the bonus for where each piece stands, read from PieceSquareTables. 0 disables.
+	PieceSquareTables PieceSquareTables
+}
+
+var DefaultWeights = Weights{
+	Pawn:   1,
+	Knight: 2.9,
+	Bishop: 3,
+	Rook:   5,
+	Queen:  8,
+
+	Check: 0.2,
+
+	KnightMobility: 0.04,
+	BishopMobility: 0.03,
+	RookMobility:   0.02,
+	QueenMobility:  0.01,
+
+	EarlyQueen:        0.3,
+	MinorsBeforeQueen: 2,
+
+	Development: 0.1,
+	Castled:     0.15,
+
+	RepeatedMinorMove: 0.15,
+
+	KPKWin: 5,
+
+	DoubledRooks:   0.3,
+	ConnectedRooks: 0.15,
+
+	PromotionRace: 0.5,
+
+	PawnShield:    0.25,
+	UncastledKing: 0.4,
+	KingOpenFile:  0.15,
+
+	DoubledPawn:  0.15,
+	IsolatedPawn: 0.15,
+	BackwardPawn: 0.1,
+	PassedPawn:   0.05,
+
+	BadBishop: 0.03,
+
+	KingPressure: 0.1,
+	PawnStorm:    0.05,
+
+	PieceSquare:       0.5,
+	PieceSquareTables: DefaultPieceSquareTables,
+}
+
+// Evaluate scores p from white's perspective, clamped to plus or minus MaxEval. It is always finite, scoring p as equal
+// and logging a warning if the terms add up to NaN. A nil w uses DefaultWeights.
+func Evaluate(p *chess.Position, w *Weights) float64 {
+	if w == nil {
+		w = &DefaultWeights
+	}
+	if score, ok := kingPawnVsKing(p, w); ok {
+		return score
+	}
+	white, black := pseudoLegalMoves(p, chess.White), pseudoLegalMoves(p, chess.Black)
+	total := sumMaterial(p, w)
+	total += imbalance(p, w)
+	total += float64(numPseudoLegalChecks(p, white, black)) * w.Check
+	total += mobility(p, w, white, black)
+	total += earlyQueen(p, w) * phase(p)
+	total += development(p, w)
+	total += rookCoordination(p, w)
+	total += promotionRace(p, w)
+	total += pawnShield(p, w)
+	total += uncastledKing(p, w)
+	total += kingOpenFiles(p, w)
+	total += pawnStructure(p, w)
+	total += badBishops(p, w)
+	total += kingPressure(p, w)
+	total += pawnStorm(p, w)
+	total += pieceSquare(p, w)
+	if math.IsNaN(total) {
+		// NaN compares false with everything, which would quietly break the search's move selection.
+		slog.Warn("evaluation is NaN, scoring position as equal", "fen", chess.GenerateFen(p))
+		return 0
+	}
+	if math.IsInf(total, 0) {
+		slog.Warn("evaluation is infinite, clamping it", "fen", chess.GenerateFen(p))
+	}
+	return math.Max(-MaxEval, math.Min(MaxEval, total))
+}
+
+// IsMateScore reports whether score encodes a forced mate for either side.
+func IsMateScore(score float64) bool {
+	return math.Abs(score) > MateScore-maxMatePly && math.Abs(score) <= MateScore
+}
+
+// MatedScore returns the score, from white's perspective, of p, in which the side to move is checkmated plies
+// half-moves into the search. Among mates at the same distance, the one leaving the mating side more material scores
+// slightly higher, so the engine prefers mates that sacrifice less.
+func MatedScore(p *chess.Position, plies int) float64 {
+	// Small enough that the material tie-break can never outweigh a ply.
+	const materialTieBreak = 0.001
+
+	score := MateScore - float64(plies)
+	if p.Turn == chess.White {
+		score = -score
+	}
+	return score + materialTieBreak*float64(MaterialBalance(p))
+}
+
+// MateIn returns the number of moves until the mate encoded by score, positive if white mates and negative if black
+// mates. It returns 0 if score is not a mate score.
+func MateIn(score float64) int {
+	if !IsMateScore(score) {
+		return 0
+	}
+	plies := int(math.Round(MateScore - math.Abs(score)))
+	moves := (plies + 1) / 2
+	if score < 0 {
+		return -moves
+	}
+	return moves
+}
+
+// PieceCount returns the number of pieces, king and pawns included, that c has on the board.
+func PieceCount(p *chess.Position, c chess.Color) int {
+	total := 0
+	for _, piece := range p.Board {
+		if piece.Color == c && piece.Type != chess.NoPieceType {
+			total++
+		}
+	}
+	return total
+}
+
+// Material returns the material balance of p from white's perspective, valued by w. A nil w uses DefaultWeights.
+func Material(p *chess.Position, w *Weights) float64 {
+	if w == nil {
+		w = &DefaultWeights
+	}
+	return sumMaterial(p, w)
+}
+
+func sumMaterial(p *chess.Position, w *Weights) float64 {
+	totalValue := 0.0
+	for _, piece := range p.Board {
+		totalValue += PieceValue(piece, w)
+	}
+	return totalValue
+}
+
+// PieceValue returns the material value of p, negative for black pieces. Kings are worth nothing, since both sides
+// always have one.
+func PieceValue(p chess.Piece, w *Weights) float64 {
+	var val float64
+	switch p.Type {
+	case chess.Pawn:
+		val = w.Pawn
+	case chess.Rook:
+		val = w.Rook
+	case chess.Knight:
+		val = w.Knight
+	case chess.Bishop:
+		val = w.Bishop
+	case chess.Queen:
+		val = w.Queen
+	default:
+		val = 0
+	}
+	if p.Color == chess.White {
+		return val
+	} else {
+		return -val
+	}
+}
+
+// phase returns 1 when all non-pawn material is on the board, falling to 0 as it is traded off.
+func phase(p *chess.Position) float64 {
+	const fullPhase = 24
+
+	total := 0
+	for _, piece := range p.Board {
+		switch piece.Type {
+		case chess.Knight, chess.Bishop:
+			total += 1
+		case chess.Rook:
+			total += 2
+		case chess.Queen:
+			total += 4
+		}
+	}
+	if total > fullPhase {
+		total = fullPhase
+	}
+	return float64(total) / fullPhase
+}
+
+func earlyQueen(p *chess.Position, w *Weights) float64 {
+	total := 0.0
+	if queenOutEarly(p, chess.White, w.MinorsBeforeQueen) {
+		total -= w.EarlyQueen
+	}
+	if queenOutEarly(p, chess.Black, w.MinorsBeforeQueen) {
+		total += w.EarlyQueen
+	}
+	return total
+}
+
+func queenOutEarly(p *chess.Position, c chess.Color, minorsBeforeQueen int) bool {
+	queenSquare := chess.D1
+	if c == chess.Black {
+		queenSquare = chess.D8
+	}
+
+	if p.PieceAt(queenSquare) == (chess.Piece{Color: c, Type: chess.Queen}) {
+		return false
+	}
+	if findPiece(p, chess.Piece{Color: c, Type: chess.Queen}) == chess.NoSquare {
+		return false
+	}
+	return 4-undevelopedMinors(p, c) < minorsBeforeQueen
+}
+
+// undevelopedMinors returns how many of c's knight and bishop starting squares still hold one of c's minor pieces.
+func undevelopedMinors(p *chess.Position, c chess.Color) int {
+	minorSquares := []chess.Square{chess.B1, chess.C1, chess.F1, chess.G1}
+	if c == chess.Black {
+		minorSquares = []chess.Square{chess.B8, chess.C8, chess.F8, chess.G8}
+	}
+
+	undeveloped := 0
+	for _, square := range minorSquares {
+		piece := p.PieceAt(square)
+		if piece.Color == c && (piece.Type == chess.Knight || piece.Type == chess.Bishop) {
+			undeveloped++
+		}
+	}
+	return undeveloped
+}
+
+// numPseudoLegalChecks returns white's pseudo-legal moves onto the black king less black's onto the white king.
+func numPseudoLegalChecks(p *chess.Position, white []chess.Move, black []chess.Move) int {
+	total := 0
+	blackKing := findPiece(p, chess.BlackKing)
+	for _, move := range white {
+		if move.ToSquare == blackKing {
+			total++
+		}
+	}
+	whiteKing := findPiece(p, chess.WhiteKing)
+	for _, move := range black {
+		if move.ToSquare == whiteKing {
+			total--
+		}
+	}
+	return total
+}
+
+func findPiece(p *chess.Position, piece chess.Piece) chess.Square {
+	for _, square := range chess.AllSquares {
+		if p.PieceAt(square) == piece {
+			return square
+		}
+	}
+	return chess.NoSquare
+}
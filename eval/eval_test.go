@@ -0,0 +1,141 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+// without returns DefaultWeights with one term changed by set, to compare against.
+func without(set func(w *Weights)) *Weights {
+	w := DefaultWeights
+	set(&w)
+	return &w
+}
+
+// assertScoreInRange checks that Evaluate, with the default weights, scores fen between lo and hi from white's
+// perspective.
+func assertScoreInRange(t *testing.T, fen string, lo float64, hi float64) {
+	t.Helper()
+	p := mustParseFen(t, fen)
+	if score := Evaluate(&p, nil); score < lo || score > hi {
+		t.Errorf("%s scores %.3f, want between %v and %v", fen, score, lo, hi)
+	}
+}
+
+func TestEvaluateScoreRanges(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fen    string
+		lo, hi float64
+	}{
+		{"starting position is equal", chess.DefaultFen, -0.1, 0.1},
+		{"open game is equal", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", -0.3, 0.3},
+		{"developed italian is roughly equal",
+			"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4", -0.5, 0.5},
+		{"fianchetto middlegame is roughly equal",
+			"r1bq1rk1/pp3ppp/2n2n2/2bpp3/8/2NP1NP1/PPP1PPBP/R1BQ1RK1 w - - 0 9", -1, 1},
+		{"white a knight up is clearly better",
+			"r1bqkb1r/pppp1ppp/2n5/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4", 1.5, math.Inf(1)},
+		{"white without its queen is lost",
+			"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNB1KB1R w KQkq - 2 3", math.Inf(-1), -7},
+		{"extra pawn in a pawn ending", "8/p4k2/8/8/8/8/PP3K2/8 w - - 0 1", 0.5, 2},
+		{"rook against a bare king is winning", "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", 4, math.Inf(1)},
+		{"bare kings are a draw", "8/8/4k3/8/8/3K4/8/8 w - - 0 1", 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assertScoreInRange(t, tc.fen, tc.lo, tc.hi)
+		})
+	}
+}
+
+func TestMateScoresStayClearOfEvaluation(t *testing.T) {
+	// Black is mated on the back rank, and white has a lot of extra material, which the tie-break adds to the score.
+	mated := mustParseFen(t, "R5k1/5ppp/8/8/8/8/QQQQ1PPP/QQQQ2K1 b - - 0 1")
+	for _, plies := range []int{1, 3, 9} {
+		score := MatedScore(&mated, plies)
+		if math.IsInf(score, 0) || score <= 0 || !IsMateScore(score) || MateIn(score) != (plies+1)/2 {
+			t.Errorf("black mated in %d plies scores %v, want a finite mate in %d for white", plies, score, (plies+1)/2)
+		}
+	}
+	if quick, slow := MatedScore(&mated, 1), MatedScore(&mated, 9); quick <= slow {
+		t.Errorf("mate in 1 scores %v and mate in 5 scores %v, want the first higher", quick, slow)
+	}
+	// No evaluation, however lopsided, comes near a mate.
+	if score := Evaluate(&mated, nil); IsMateScore(score) || score > MaxEval {
+		t.Errorf("eight queens up evaluates to %v, want at most MaxEval %v", score, MaxEval)
+	}
+}
+
+func TestEvaluateIsClamped(t *testing.T) {
+	for _, tc := range []struct {
+		fen  string
+		want float64
+	}{
+		{"4k3/8/8/8/8/8/QQQQQPPP/QQQQ2K1 w - - 0 1", MaxEval},
+		{"qqqq2k1/qqqqqppp/8/8/8/8/8/4K3 b - - 0 1", -MaxEval},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if score := Evaluate(&p, nil); score != tc.want {
+			t.Errorf("%s evaluates to %v, want it clamped to %v", tc.fen, score, tc.want)
+		}
+	}
+	// Kings carry no material, so a bare board is level rather than thousands of points each way.
+	kings := mustParseFen(t, "4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if score := Evaluate(&kings, nil); math.Abs(score) > 1 {
+		t.Errorf("bare kings evaluate to %v, want about 0", score)
+	}
+	// The slowest mate the search can find still scores far above the clamp, with each ply telling mates apart.
+	mated := mustParseFen(t, "R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1")
+	if slowest := MatedScore(&mated, maxMatePly-1); slowest <= MaxEval || !IsMateScore(slowest) {
+		t.Errorf("mate after %d plies scores %v, want a mate score above MaxEval %v", maxMatePly-1, slowest, MaxEval)
+	}
+	if MatedScore(&mated, 4)-MatedScore(&mated, 5) < 0.5 {
+		t.Errorf("mates 4 and 5 plies away score %v and %v, want them clearly apart", MatedScore(&mated, 4),
+			MatedScore(&mated, 5))
+	}
+}
+
+func TestEvaluateStaysFinite(t *testing.T) {
+	p := mustParseFen(t, "4k3/8/8/8/8/8/PPPPPPPP/4K3 w - - 0 1")
+	nan := DefaultWeights
+	nan.Pawn = math.NaN()
+	if score := Evaluate(&p, &nan); score != 0 {
+		t.Errorf("NaN pawn value evaluates to %v, want 0", score)
+	}
+	inf := DefaultWeights
+	inf.Pawn = math.Inf(1)
+	if score := Evaluate(&p, &inf); score != MaxEval {
+		t.Errorf("infinite pawn value evaluates to %v, want MaxEval %v", score, MaxEval)
+	}
+}
+
+func TestEarlyQueenPenalisesSortie(t *testing.T) {
+	noPenalty := without(func(w *Weights) { w.EarlyQueen = 0 })
+	sortie, _ := playLine(t, "e2e4", "e7e5", "d1h5")
+	knight, _ := playLine(t, "e2e4", "e7e5", "g1f3")
+
+	// The penalty is all that changes for the queen, and nothing for the knight.
+	want := -DefaultWeights.EarlyQueen * MaterialPhase(&sortie)
+	if got := Evaluate(&sortie, nil) - Evaluate(&sortie, noPenalty); math.Abs(got-want) > 1e-9 {
+		t.Errorf("EarlyQueen changes the score after 2. Qh5 by %v, want %v", got, want)
+	}
+	if got := Evaluate(&knight, nil) - Evaluate(&knight, noPenalty); got != 0 {
+		t.Errorf("EarlyQueen changes the score after 2. Nf3 by %v, want 0", got)
+	}
+	// Queen out after two minor pieces is fine.
+	developed, _ := playLine(t, "e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "g8f6", "d1e2")
+	if got := Evaluate(&developed, nil) - Evaluate(&developed, noPenalty); got != 0 {
+		t.Errorf("EarlyQueen changes the score of a queen out after two minors by %v, want 0", got)
+	}
+}
@@ -0,0 +1,217 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// pawnShield penalizes pawns that have advanced from in front of a castled king. Each advanced pawn costs
+// w.PawnShield when the enemy has a queen, rook and both minors on that wing, less with fewer, and half that if it has
+// only moved one square. The total is scaled by phase, as shields matter little once attackers are traded off.
+func pawnShield(p *chess.Position, w *Weights) float64 {
+	return (pawnShieldFor(p, chess.Black, w) - pawnShieldFor(p, chess.White, w)) * phase(p)
+}
+
+func pawnShieldFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	// Attack potential counts enemy pieces on the wing, with a queen, a rook and two minors counting as full.
+	const fullAttack = 8
+
+	king := findPiece(p, chess.Piece{Color: c, Type: chess.King})
+	homeRank, shieldRank := chess.Rank1, chess.Rank2
+	forward := 1
+	if c == chess.Black {
+		homeRank, shieldRank = chess.Rank8, chess.Rank7
+		forward = -1
+	}
+	if king == chess.NoSquare || king.Rank != homeRank {
+		return 0
+	}
+
+	var shieldFiles, wingFiles []chess.File
+	switch king.File {
+	case chess.FileG, chess.FileH:
+		shieldFiles = []chess.File{chess.FileF, chess.FileG, chess.FileH}
+		wingFiles = []chess.File{chess.FileE, chess.FileF, chess.FileG, chess.FileH}
+	case chess.FileA, chess.FileB, chess.FileC:
+		shieldFiles = []chess.File{chess.FileA, chess.FileB, chess.FileC}
+		wingFiles = []chess.File{chess.FileA, chess.FileB, chess.FileC, chess.FileD}
+	default:
+		return 0
+	}
+
+	attack := 0
+	for _, f := range wingFiles {
+		for r := chess.Rank1; r <= chess.Rank8; r++ {
+			piece := p.PieceAt(chess.Square{File: f, Rank: r})
+			if piece.Color == c || piece.Color == chess.NoColor {
+				continue
+			}
+			switch piece.Type {
+			case chess.Knight, chess.Bishop:
+				attack += 1
+			case chess.Rook:
+				attack += 2
+			case chess.Queen:
+				attack += 4
+			}
+		}
+	}
+	if attack == 0 {
+		return 0
+	}
+	if attack > fullAttack {
+		attack = fullAttack
+	}
+
+	pawn := chess.Piece{Color: c, Type: chess.Pawn}
+	advanced := 0.0
+	for _, f := range shieldFiles {
+		oneStep := chess.Square{File: f, Rank: chess.Rank(int(shieldRank) + forward)}
+		switch {
+		case p.PieceAt(chess.Square{File: f, Rank: shieldRank}) == pawn:
+		case p.PieceAt(oneStep) == pawn:
+			advanced += 0.5
+		default:
+			advanced += 1
+		}
+	}
+	return advanced * w.PawnShield * float64(attack) / fullAttack
+}
+
+// uncastledKing penalizes a king left on the d, e or f file while the enemy still has a queen or rook. It costs
+// w.UncastledKing once castling rights are gone and half that while the king can still castle, scaled by phase.
+func uncastledKing(p *chess.Position, w *Weights) float64 {
+	return (uncastledKingFor(p, chess.Black, w) - uncastledKingFor(p, chess.White, w)) * phase(p)
+}
+
+func uncastledKingFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	king := findPiece(p, chess.Piece{Color: c, Type: chess.King})
+	if king == chess.NoSquare || king.File < chess.FileD || king.File > chess.FileF {
+		return 0
+	}
+
+	enemy := chess.Black
+	canCastle := p.WhiteKingSideCastle || p.WhiteQueenSideCastle
+	if c == chess.Black {
+		enemy = chess.White
+		canCastle = p.BlackKingSideCastle || p.BlackQueenSideCastle
+	}
+	if findPiece(p, chess.Piece{Color: enemy, Type: chess.Queen}) == chess.NoSquare &&
+		findPiece(p, chess.Piece{Color: enemy, Type: chess.Rook}) == chess.NoSquare {
+		return 0
+	}
+
+	if canCastle {
+		return w.UncastledKing / 2
+	}
+	return w.UncastledKing
+}
+
+// kingPressure rewards rooks and queens on the enemy king's file, and queens on one of its diagonals, that bear on the
+// king with nothing but pawns in the way. Pieces lined up behind each other all count. It is w.KingPressure per piece,
+// scaled by phase. There is no distance-based king tropism term for it to overlap with.
+func kingPressure(p *chess.Position, w *Weights) float64 {
+	return float64(kingPressureOn(p, chess.Black)-kingPressureOn(p, chess.White)) * w.KingPressure * phase(p)
+}
+
+// kingPressureOn counts the enemy heavy pieces bearing on c's king.
+func kingPressureOn(p *chess.Position, c chess.Color) int {
+	directions := []struct {
+		file, rank int
+		diagonal   bool
+	}{
+		{0, 1, false}, {0, -1, false},
+		{1, 1, true}, {1, -1, true}, {-1, 1, true}, {-1, -1, true},
+	}
+
+	king := findPiece(p, chess.Piece{Color: c, Type: chess.King})
+	if king == chess.NoSquare {
+		return 0
+	}
+	total := 0
+	for _, d := range directions {
+		f, r := int(king.File)+d.file, int(king.Rank)+d.rank
+		for ; f >= int(chess.FileA) && f <= int(chess.FileH) && r >= int(chess.Rank1) && r <= int(chess.Rank8); f, r = f+d.file, r+d.rank {
+			piece := p.PieceAt(chess.Square{File: chess.File(f), Rank: chess.Rank(r)})
+			if piece.Type == chess.NoPieceType || piece.Type == chess.Pawn {
+				continue
+			}
+			if piece.Color == c || !(piece.Type == chess.Queen || piece.Type == chess.Rook && !d.diagonal) {
+				break
+			}
+			total++
+		}
+	}
+	return total
+}
+
+// pawnStorm rewards, when the kings are castled on opposite wings, each pawn on or beside the enemy king's file for
+// every rank it has advanced, w.PawnStorm per rank. The bonus grows by half for each heavy piece bearing on that king,
+// as counted for kingPressure, since the storm is what opens lines for them. It is scaled by phase.
+func pawnStorm(p *chess.Position, w *Weights) float64 {
+	white := findPiece(p, chess.WhiteKing)
+	black := findPiece(p, chess.BlackKing)
+	if !castled(p, chess.White) || !castled(p, chess.Black) || (white.File >= chess.FileE) == (black.File >= chess.FileE) {
+		return 0
+	}
+	return (pawnStormAt(p, chess.White, black) - pawnStormAt(p, chess.Black, white)) * w.PawnStorm * phase(p)
+}
+
+// pawnStormAt returns how many ranks c's pawns around king have advanced in total, scaled up by the pressure on king.
+func pawnStormAt(p *chess.Position, c chess.Color, king chess.Square) float64 {
+	startRank, enemy := chess.Rank2, chess.Black
+	if c == chess.Black {
+		startRank, enemy = chess.Rank7, chess.White
+	}
+
+	pawn := chess.Piece{Color: c, Type: chess.Pawn}
+	advanced := 0
+	for f := max(chess.FileA, king.File-1); f <= min(chess.FileH, king.File+1); f++ {
+		for r := chess.Rank1; r <= chess.Rank8; r++ {
+			if p.PieceAt(chess.Square{File: f, Rank: r}) == pawn {
+				advanced += absDiff(int(r), int(startRank))
+			}
+		}
+	}
+	return float64(advanced) * (1 + 0.5*float64(kingPressureOn(p, enemy)))
+}
+
+// kingOpenFiles penalizes open files on and beside each king while the enemy still has a queen or rook to use them.
+// A file with no pawns costs w.KingOpenFile and one with only enemy pawns half that, scaled by phase.
+func kingOpenFiles(p *chess.Position, w *Weights) float64 {
+	return (kingOpenFilesFor(p, chess.Black, w) - kingOpenFilesFor(p, chess.White, w)) * phase(p)
+}
+
+func kingOpenFilesFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	king := findPiece(p, chess.Piece{Color: c, Type: chess.King})
+	if king == chess.NoSquare {
+		return 0
+	}
+	enemy := chess.Black
+	if c == chess.Black {
+		enemy = chess.White
+	}
+	if findPiece(p, chess.Piece{Color: enemy, Type: chess.Queen}) == chess.NoSquare &&
+		findPiece(p, chess.Piece{Color: enemy, Type: chess.Rook}) == chess.NoSquare {
+		return 0
+	}
+
+	penalty := 0.0
+	for f := max(chess.FileA, king.File-1); f <= min(chess.FileH, king.File+1); f++ {
+		own, enemies := false, false
+		for r := chess.Rank1; r <= chess.Rank8; r++ {
+			switch p.PieceAt(chess.Square{File: f, Rank: r}) {
+			case chess.Piece{Color: c, Type: chess.Pawn}:
+				own = true
+			case chess.Piece{Color: enemy, Type: chess.Pawn}:
+				enemies = true
+			}
+		}
+		switch {
+		case !own && !enemies:
+			penalty += w.KingOpenFile
+		case !own:
+			penalty += w.KingOpenFile / 2
+		}
+	}
+	return penalty
+}
@@ -0,0 +1,128 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestPawnShieldPenalisesAdvancedPawn(t *testing.T) {
+	// Black's queen and knight are on white's kingside wing.
+	intact := mustParseFen(t, "r5k1/5ppp/5n2/7q/8/8/5PPP/R5K1 w - - 0 1")
+	advanced := mustParseFen(t, "r5k1/5ppp/5n2/7q/6P1/8/5P1P/R5K1 w - - 0 1")
+	if got := pawnShield(&intact, &DefaultWeights); got != 0 {
+		t.Errorf("intact shields score %v, want 0", got)
+	}
+	// The queen and knight are 5 of the 8 attack points that make a full attack.
+	want := -DefaultWeights.PawnShield * 5 / 8 * phase(&advanced)
+	if got := pawnShield(&advanced, &DefaultWeights); math.Abs(got-want) > 1e-9 {
+		t.Errorf("g-pawn advanced in front of the king scores %v, want %v", got, want)
+	}
+	noShield := without(func(w *Weights) { w.PawnShield = 0 })
+	if Evaluate(&advanced, nil) >= Evaluate(&advanced, noShield) {
+		t.Errorf("PawnShield does not lower the score of g4 in front of the king")
+	}
+
+	// With the attackers on the other wing, g4 is not penalised.
+	quiet := mustParseFen(t, "r5k1/5ppp/8/8/q5P1/2n5/5P1P/R5K1 w - - 0 1")
+	if got := pawnShield(&quiet, &DefaultWeights); got != 0 {
+		t.Errorf("g-pawn advanced with no attackers on the wing scores %v, want 0", got)
+	}
+}
+
+func TestUncastledKingPenalisesCentralKing(t *testing.T) {
+	// White has castled, and black's king has stepped to e7, giving up castling, with every piece still on.
+	stuck := mustParseFen(t, "r1bq3r/ppppkppp/2n2n2/2b1p3/2B1P3/2NP1N2/PPP2PPP/R1BQ1RK1 w - - 0 7")
+	want := DefaultWeights.UncastledKing * phase(&stuck)
+	if got := uncastledKing(&stuck, &DefaultWeights); math.Abs(got-want) > 1e-9 {
+		t.Errorf("black king stuck on e7 scores %v for white, want %v", got, want)
+	}
+	noPenalty := without(func(w *Weights) { w.UncastledKing = 0 })
+	if Evaluate(&stuck, nil) <= Evaluate(&stuck, noPenalty) {
+		t.Errorf("UncastledKing does not favour white, whose king has castled")
+	}
+
+	// With its castling rights kept, black's king on e8 pays half.
+	canCastle := mustParseFen(t, "r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/2NP1N2/PPP2PPP/R1BQ1RK1 b kq - 0 6")
+	want = DefaultWeights.UncastledKing / 2 * phase(&canCastle)
+	if got := uncastledKing(&canCastle, &DefaultWeights); math.Abs(got-want) > 1e-9 {
+		t.Errorf("black king on e8 able to castle scores %v for white, want %v", got, want)
+	}
+
+	// Without enemy heavy pieces a central king is safe.
+	noHeavies := mustParseFen(t, "2b5/ppppkppp/2n2n2/2b1p3/2B1P3/2NP1N2/PPP2PPP/2B3K1 w - - 0 20")
+	if got := uncastledKing(&noHeavies, &DefaultWeights); got != 0 {
+		t.Errorf("central king with no enemy queen or rook scores %v, want 0", got)
+	}
+}
+
+func TestKingPressureRewardsBatteryOnKing(t *testing.T) {
+	// The queen and rook stack on the g-file, aimed through the g7 pawn at black's king, or on the c-file away from it.
+	aimed := mustParseFen(t, "3rq1k1/5ppp/8/8/8/8/6Q1/1K4R1 w - - 0 1")
+	elsewhere := mustParseFen(t, "3rq1k1/5ppp/8/8/8/8/2Q5/1KR5 w - - 0 1")
+	want := 2 * DefaultWeights.KingPressure * phase(&aimed)
+	if got := kingPressure(&aimed, &DefaultWeights); math.Abs(got-want) > 1e-9 {
+		t.Errorf("battery on the king's file scores %v, want %v", got, want)
+	}
+	if got := kingPressure(&elsewhere, &DefaultWeights); got != 0 {
+		t.Errorf("battery on the c-file scores %v, want 0", got)
+	}
+	noPressure := without(func(w *Weights) { w.KingPressure = 0 })
+	aimedGain := Evaluate(&aimed, nil) - Evaluate(&aimed, noPressure)
+	if aimedGain <= Evaluate(&elsewhere, nil)-Evaluate(&elsewhere, noPressure) {
+		t.Errorf("KingPressure does not favour the battery aimed at the king")
+	}
+
+	// A piece of either side in the way blocks the pressure, while pawns do not.
+	blocked := mustParseFen(t, "3rq1k1/5pnp/8/8/8/8/6Q1/1K4R1 w - - 0 1")
+	if got := kingPressure(&blocked, &DefaultWeights); got != 0 {
+		t.Errorf("battery behind black's knight on g7 scores %v, want 0", got)
+	}
+}
+
+func TestPawnStormAgainstOppositeWingKing(t *testing.T) {
+	// White has castled queenside and black kingside. In storm white's g and h pawns have each gone two ranks.
+	storm := mustParseFen(t, "r2q1rk1/ppp2ppp/2n2n2/3p4/3P2PP/2N5/PPPQ1P2/2KR3R w - - 0 1")
+	passive := mustParseFen(t, "r2q1rk1/ppp2ppp/2n2n2/3p4/3P4/2N5/PPPQ1PPP/2KR3R w - - 0 1")
+	gap := pawnStorm(&storm, &DefaultWeights) - pawnStorm(&passive, &DefaultWeights)
+	if want := 4 * DefaultWeights.PawnStorm * phase(&storm); math.Abs(gap-want) > 1e-9 {
+		t.Errorf("advancing g and h pawns two ranks each raises the storm by %v, want %v", gap, want)
+	}
+	noStorm := without(func(w *Weights) { w.PawnStorm = 0 })
+	stormGain := Evaluate(&storm, nil) - Evaluate(&storm, noStorm)
+	if stormGain <= Evaluate(&passive, nil)-Evaluate(&passive, noStorm) {
+		t.Errorf("PawnStorm does not favour the advanced storm over the passive setup")
+	}
+
+	// With both kings castled kingside there is no race.
+	sameWing := mustParseFen(t, "r2q1rk1/ppp2ppp/2n2n2/3p4/3P2PP/2N5/PPPQ1P2/R4RK1 w - - 0 1")
+	if got := pawnStorm(&sameWing, &DefaultWeights); got != 0 {
+		t.Errorf("kings on the same wing score a storm of %v, want 0", got)
+	}
+}
+
+func TestKingOpenFilesPenaliseOpenFiles(t *testing.T) {
+	w := &DefaultWeights
+	for _, tc := range []struct {
+		name string
+		fen  string
+		want float64
+	}{
+		{"open", "6k1/r7/8/8/8/8/5P1P/6K1 w - - 0 1", w.KingOpenFile},
+		{"half-open", "6k1/r5p1/8/8/8/8/5P1P/6K1 w - - 0 1", w.KingOpenFile / 2},
+		{"closed", "6k1/r7/8/8/8/8/5PPP/6K1 w - - 0 1", 0},
+		{"no heavy pieces", "6k1/b7/8/8/8/8/5P1P/6K1 w - - 0 1", 0},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if got := kingOpenFilesFor(&p, chess.White, w); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s file by the king costs white %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	open := mustParseFen(t, "6k1/r7/8/8/8/8/5P1P/6K1 w - - 0 1")
+	noPenalty := without(func(w *Weights) { w.KingOpenFile = 0 })
+	if Evaluate(&open, nil) >= Evaluate(&open, noPenalty) {
+		t.Errorf("KingOpenFile does not lower white's score with the g-file open")
+	}
+}
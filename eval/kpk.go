@@ -0,0 +1,125 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// kingPawnVsKing scores king and pawn versus king endgames using the rule of the square, key squares, the opposition
+// and the rook pawn corner draw. ok is false for other material or when none of the rules decide the position.
+func kingPawnVsKing(p *chess.Position, w *Weights) (score float64, ok bool) {
+	pawnSquare := chess.NoSquare
+	var pawnColor chess.Color
+	strongKing, weakKing := chess.NoSquare, chess.NoSquare
+	for _, square := range chess.AllSquares {
+		piece := p.PieceAt(square)
+		switch piece.Type {
+		case chess.NoPieceType, chess.King:
+		case chess.Pawn:
+			if pawnSquare != chess.NoSquare {
+				return 0, false
+			}
+			pawnSquare = square
+			pawnColor = piece.Color
+		default:
+			return 0, false
+		}
+	}
+	if pawnSquare == chess.NoSquare {
+		return 0, false
+	}
+	if pawnColor == chess.White {
+		strongKing = findPiece(p, chess.WhiteKing)
+		weakKing = findPiece(p, chess.BlackKing)
+	} else {
+		strongKing = findPiece(p, chess.BlackKing)
+		weakKing = findPiece(p, chess.WhiteKing)
+	}
+	if strongKing == chess.NoSquare || weakKing == chess.NoSquare {
+		return 0, false
+	}
+
+	sign := 1.0
+	if pawnColor == chess.Black {
+		sign = -1
+		pawnSquare = mirror(pawnSquare)
+		strongKing = mirror(strongKing)
+		weakKing = mirror(weakKing)
+	}
+	weakToMove := p.Turn != pawnColor
+
+	promotionSquare := chess.Square{File: pawnSquare.File, Rank: chess.Rank8}
+	pawnMoves := movesToPromote(pawnSquare, chess.White)
+	won := sign * (w.Pawn + w.KPKWin - 0.1*float64(pawnMoves))
+
+	weakDistance := kingDistance(weakKing, promotionSquare)
+	if weakToMove {
+		weakDistance--
+	}
+	kingBlocksPawn := strongKing.File == pawnSquare.File && strongKing.Rank > pawnSquare.Rank
+	if weakDistance > pawnMoves && !kingBlocksPawn {
+		return won, true
+	}
+
+	rookPawn := pawnSquare.File == chess.FileA || pawnSquare.File == chess.FileH
+	if rookPawn {
+		if kingDistance(weakKing, promotionSquare) <= 1 {
+			return 0, true
+		}
+		return 0, false
+	}
+
+	pawnHanging := weakToMove && kingDistance(weakKing, pawnSquare) == 1 &&
+		kingDistance(strongKing, pawnSquare) > 1
+	if pawnHanging {
+		return 0, false
+	}
+
+	if isKeySquare(strongKing, pawnSquare) {
+		return won, true
+	}
+
+	inFront := strongKing.Rank > pawnSquare.Rank && absDiff(int(strongKing.File), int(pawnSquare.File)) <= 1
+	hasOpposition := weakToMove && strongKing.File == weakKing.File && weakKing.Rank == strongKing.Rank+2
+	if inFront && hasOpposition {
+		return won, true
+	}
+
+	if weakKing.File == pawnSquare.File && weakKing.Rank == pawnSquare.Rank+1 {
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// isKeySquare reports whether a king on s guarantees promotion of a white non-rook pawn on pawnSquare.
+func isKeySquare(s chess.Square, pawnSquare chess.Square) bool {
+	if absDiff(int(s.File), int(pawnSquare.File)) > 1 {
+		return false
+	}
+	switch {
+	case pawnSquare.Rank <= chess.Rank4:
+		return s.Rank == pawnSquare.Rank+2
+	case pawnSquare.Rank <= chess.Rank6:
+		return s.Rank == pawnSquare.Rank+1 || s.Rank == pawnSquare.Rank+2
+	default:
+		return s.Rank == chess.Rank8 || (s.Rank == chess.Rank7 && s.File != pawnSquare.File)
+	}
+}
+
+// kingDistance returns the number of king moves between a and b. chess.ChebyshevDistance takes the minimum of the
+// file and rank distances rather than the maximum, so it can't be used here.
+func kingDistance(a chess.Square, b chess.Square) int {
+	return max(absDiff(int(a.File), int(b.File)), absDiff(int(a.Rank), int(b.Rank)))
+}
+
+// mirror flips s vertically so that black's pieces can be treated as white's.
+func mirror(s chess.Square) chess.Square {
+	return chess.Square{File: s.File, Rank: chess.Rank8 + 1 - s.Rank}
+}
+
+func absDiff(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
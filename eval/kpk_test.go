@@ -0,0 +1,34 @@
+package eval
+
+import "testing"
+
+func TestKingPawnVsKing(t *testing.T) {
+	const winning = 5 // Above KPKWin less the pawn's moves to go, and far above any drawn score
+	for _, tc := range []struct {
+		name string
+		fen  string
+		want string // "white", "black" or "draw"
+	}{
+		{"key square", "3k4/8/3K4/3P4/8/8/8/8 w - - 0 1", "white"},
+		{"opposition", "8/3k4/8/3K4/3P4/8/8/8 b - - 0 1", "white"},
+		{"outside the square", "k7/8/8/7P/8/8/8/K7 w - - 0 1", "white"},
+		{"black key square", "8/8/8/8/3p4/3k4/8/3K4 b - - 0 1", "black"},
+		{"rook pawn corner", "k7/8/8/8/P7/1K6/8/8 w - - 0 1", "draw"},
+		{"rook pawn corner with the king ahead", "1k6/8/1K6/P7/8/8/8/8 w - - 0 1", "draw"},
+		{"defender in front", "8/8/8/4k3/4P3/4K3/8/8 w - - 0 1", "draw"},
+	} {
+		p := mustParseFen(t, tc.fen)
+		score := Evaluate(&p, nil)
+		got := "draw"
+		if score > winning {
+			got = "white"
+		} else if score < -winning {
+			got = "black"
+		} else if score != 0 {
+			got = "unclear"
+		}
+		if got != tc.want {
+			t.Errorf("%s: %s scores %v, a %s result, want %s", tc.name, tc.fen, score, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// startingPieces is the number of each piece type a side starts with, king excluded, in the order captured pieces are
+// reported.
+var startingPieces = []struct {
+	pieceType chess.PieceType
+	count     int
+}{
+	{chess.Queen, 1},
+	{chess.Rook, 2},
+	{chess.Bishop, 2},
+	{chess.Knight, 2},
+	{chess.Pawn, 8},
+}
+
+// MaterialBalance returns white's material minus black's in whole pawns, counting knights and bishops as 3, rooks as 5
+// and queens as 9, for display. The search uses Weights instead.
+func MaterialBalance(p *chess.Position) int {
+	total := 0
+	for _, piece := range p.Board {
+		val := 0
+		switch piece.Type {
+		case chess.Pawn:
+			val = 1
+		case chess.Knight, chess.Bishop:
+			val = 3
+		case chess.Rook:
+			val = 5
+		case chess.Queen:
+			val = 9
+		}
+		if piece.Color == chess.White {
+			total += val
+		} else if piece.Color == chess.Black {
+			total -= val
+		}
+	}
+	return total
+}
+
+// CapturedPieces infers the pieces each side has lost by comparing p with the starting complement, most valuable
+// first. A promoted piece beyond the starting count is assumed to have come from one of that side's missing pawns.
+func CapturedPieces(p *chess.Position) (white []chess.PieceType, black []chess.PieceType) {
+	return capturedPieces(p, chess.White), capturedPieces(p, chess.Black)
+}
+
+func capturedPieces(p *chess.Position, c chess.Color) []chess.PieceType {
+	counts := map[chess.PieceType]int{}
+	for _, piece := range p.Board {
+		if piece.Color == c {
+			counts[piece.Type]++
+		}
+	}
+
+	promoted := 0
+	for _, start := range startingPieces {
+		if start.pieceType != chess.Pawn && counts[start.pieceType] > start.count {
+			promoted += counts[start.pieceType] - start.count
+		}
+	}
+
+	captured := []chess.PieceType{}
+	for _, start := range startingPieces {
+		missing := start.count - counts[start.pieceType]
+		if start.pieceType == chess.Pawn {
+			missing -= promoted
+		}
+		for i := 0; i < missing; i++ {
+			captured = append(captured, start.pieceType)
+		}
+	}
+	return captured
+}
+
+// imbalance adjusts the value of knights and rooks for the pawns their own side has, after Kaufman: knights gain
+// w.KnightPawnAdjust for each pawn above five and rooks lose w.RookPawnAdjust, as pawns block the files rooks need and
+// give knights outposts. Both also apply in reverse below five pawns.
+func imbalance(p *chess.Position, w *Weights) float64 {
+	return imbalanceFor(p, chess.White, w) - imbalanceFor(p, chess.Black, w)
+}
+
+func imbalanceFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	const basePawns = 5
+
+	pawns, knights, rooks := 0, 0, 0
+	for _, piece := range p.Board {
+		if piece.Color != c {
+			continue
+		}
+		switch piece.Type {
+		case chess.Pawn:
+			pawns++
+		case chess.Knight:
+			knights++
+		case chess.Rook:
+			rooks++
+		}
+	}
+	extraPawns := float64(pawns - basePawns)
+	return extraPawns * (float64(knights)*w.KnightPawnAdjust - float64(rooks)*w.RookPawnAdjust)
+}
@@ -0,0 +1,55 @@
+package eval
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestMaterialBalanceAndCapturedPieces(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		fen          string
+		balance      int
+		white, black []chess.PieceType
+	}{
+		{"start", chess.DefaultFen, 0, []chess.PieceType{}, []chess.PieceType{}},
+		{"white down a knight", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKB1R w KQkq - 0 1", -3,
+			[]chess.PieceType{chess.Knight}, []chess.PieceType{}},
+		// White has queened a pawn, and black has lost its a-pawn and a rook.
+		{"white promoted", "Qnbqkbnr/1ppppppp/8/8/8/8/1PPPPPPP/RNBQKBNR b KQk - 0 1", 14,
+			[]chess.PieceType{}, []chess.PieceType{chess.Rook, chess.Pawn}},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if got := MaterialBalance(&p); got != tc.balance {
+			t.Errorf("%s: MaterialBalance = %d, want %d", tc.name, got, tc.balance)
+		}
+		white, black := CapturedPieces(&p)
+		if !slices.Equal(white, tc.white) || !slices.Equal(black, tc.black) {
+			t.Errorf("%s: CapturedPieces = %v, %v, want %v, %v", tc.name, white, black, tc.white, tc.black)
+		}
+	}
+}
+
+func TestKaufmanAdjustShiftsKnightAgainstRook(t *testing.T) {
+	kaufman := DefaultWeights
+	kaufman.KnightPawnAdjust, kaufman.RookPawnAdjust = 1.0/16, 1.0/8
+	// How much more the knight is worth than the rook to white, beyond their base values, with the pawns given.
+	knightOverRook := func(knightFen, rookFen string, w *Weights) float64 {
+		knight, rook := mustParseFen(t, knightFen), mustParseFen(t, rookFen)
+		return imbalance(&knight, w) - imbalance(&rook, w)
+	}
+	heavy := knightOverRook("4k3/pppppppp/8/8/8/2N5/PPPPPPPP/4K3 w - - 0 1",
+		"4k3/pppppppp/8/8/8/2R5/PPPPPPPP/4K3 w - - 0 1", &kaufman)
+	sparse := knightOverRook("4k3/pp6/8/8/8/2N5/PP6/4K3 w - - 0 1", "4k3/pp6/8/8/8/2R5/PP6/4K3 w - - 0 1", &kaufman)
+	// Three pawns above five, or below.
+	if want := 3 * (1.0/16 + 1.0/8); math.Abs(heavy-want) > 1e-9 || math.Abs(sparse+want) > 1e-9 {
+		t.Errorf("knight gains %v on the rook with 8 pawns and %v with 2, want %v and %v", heavy, sparse, want, -want)
+	}
+	if off := knightOverRook("4k3/pppppppp/8/8/8/2N5/PPPPPPPP/4K3 w - - 0 1",
+		"4k3/pppppppp/8/8/8/2R5/PPPPPPPP/4K3 w - - 0 1", &DefaultWeights); off != 0 {
+		t.Errorf("with the adjustments off the knight gains %v on the rook, want 0", off)
+	}
+}
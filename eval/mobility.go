@@ -0,0 +1,37 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// mobility rewards each piece for its pseudo-legal moves, at the weight for its type. white and black are the
+// pseudo-legal moves of each side.
+func mobility(p *chess.Position, w *Weights, white []chess.Move, black []chess.Move) float64 {
+	return mobilityOf(p, w, white) - mobilityOf(p, w, black)
+}
+
+func mobilityOf(p *chess.Position, w *Weights, moves []chess.Move) float64 {
+	total := 0.0
+	for _, move := range moves {
+		switch p.PieceAt(move.FromSquare).Type {
+		case chess.Knight:
+			total += w.KnightMobility
+		case chess.Bishop:
+			total += w.BishopMobility
+		case chess.Rook:
+			total += w.RookMobility
+		case chess.Queen:
+			total += w.QueenMobility
+		}
+	}
+	return total
+}
+
+// pseudoLegalMoves returns the pseudo-legal moves c would have if it were c's turn in p.
+func pseudoLegalMoves(p *chess.Position, c chess.Color) []chess.Move {
+	origTurn := p.Turn
+	p.Turn = c
+	moves := chess.GeneratePseudoLegalMoves(p)
+	p.Turn = origTurn
+	return moves
+}
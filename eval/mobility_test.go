@@ -0,0 +1,62 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestKnightMobilityWeight(t *testing.T) {
+	// The knight has 8 moves on d4 and 2 in the corner, and no other piece has mobility.
+	center := mustParseFen(t, "4k3/8/8/8/3N4/8/8/4K3 w - - 0 1")
+	corner := mustParseFen(t, "4k3/8/8/8/8/8/8/N3K3 w - - 0 1")
+	for _, tc := range []struct {
+		p     chess.Position
+		moves float64
+	}{{center, 8}, {corner, 2}} {
+		white, black := pseudoLegalMoves(&tc.p, chess.White), pseudoLegalMoves(&tc.p, chess.Black)
+		want := tc.moves * DefaultWeights.KnightMobility
+		if got := mobility(&tc.p, &DefaultWeights, white, black); math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s has mobility %v, want %v", chess.GenerateFen(&tc.p), got, want)
+		}
+	}
+
+	// The centered knight's lead grows by its 6 extra moves at the added weight, and only the knight weight moves it.
+	lead := func(w *Weights) float64 {
+		return Evaluate(&center, w) - Evaluate(&corner, w)
+	}
+	knights := DefaultWeights
+	knights.KnightMobility += 0.1
+	if got, want := lead(&knights)-lead(nil), 6*0.1; math.Abs(got-want) > 1e-9 {
+		t.Errorf("raising KnightMobility by 0.1 raised the centered knight's lead by %v, want %v", got, want)
+	}
+	bishops := DefaultWeights
+	bishops.BishopMobility += 0.1
+	if got := lead(&bishops) - lead(nil); math.Abs(got) > 1e-9 {
+		t.Errorf("raising BishopMobility changed the centered knight's lead by %v, want 0", got)
+	}
+}
+
+// BenchmarkEvaluate reports how many positions a second Evaluate scores, mobility included, across openings,
+// middlegames and endgames.
+func BenchmarkEvaluate(b *testing.B) {
+	var positions []chess.Position
+	for _, fen := range []string{
+		chess.DefaultFen,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	} {
+		p, err := chess.ParseFen(fen)
+		if err != nil {
+			b.Fatal(err)
+		}
+		positions = append(positions, *p)
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		Evaluate(&positions[i%len(positions)], nil)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "positions/s")
+}
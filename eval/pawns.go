@@ -0,0 +1,144 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// promotionRace rewards the side whose most advanced passed pawn is closest to queening, counting the side to move as
+// a move closer. It is scaled up as material comes off, where pawn races decide games.
+func promotionRace(p *chess.Position, w *Weights) float64 {
+	endgame := 1 - phase(p)
+	if endgame == 0 {
+		return 0
+	}
+	return (raceBonus(p, chess.White, w) - raceBonus(p, chess.Black, w)) * endgame
+}
+
+func raceBonus(p *chess.Position, c chess.Color, w *Weights) float64 {
+	closest := -1
+	for _, square := range chess.AllSquares {
+		if p.PieceAt(square) != (chess.Piece{Color: c, Type: chess.Pawn}) || !isPassedPawn(p, square, c) {
+			continue
+		}
+		moves := movesToPromote(square, c)
+		if p.Turn == c {
+			moves--
+		}
+		if closest == -1 || moves < closest {
+			closest = moves
+		}
+	}
+	if closest == -1 {
+		return 0
+	}
+	return w.PromotionRace * float64(6-closest) / 6
+}
+
+// isPassedPawn reports whether no enemy pawn stands in front of the c pawn on square, on its own or an adjacent file.
+func isPassedPawn(p *chess.Position, square chess.Square, c chess.Color) bool {
+	enemyPawn := chess.Piece{Color: chess.Black, Type: chess.Pawn}
+	if c == chess.Black {
+		enemyPawn = chess.Piece{Color: chess.White, Type: chess.Pawn}
+	}
+	for f := square.File - 1; f <= square.File+1; f++ {
+		if f < chess.FileA || f > chess.FileH {
+			continue
+		}
+		for r := chess.Rank1; r <= chess.Rank8; r++ {
+			ahead := (c == chess.White && r > square.Rank) || (c == chess.Black && r < square.Rank)
+			if ahead && p.PieceAt(chess.Square{File: f, Rank: r}) == enemyPawn {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// movesToPromote returns the number of moves a c pawn on square needs to reach the last rank, counting the double step.
+func movesToPromote(square chess.Square, c chess.Color) int {
+	if c == chess.Black {
+		square = mirror(square)
+	}
+	moves := int(chess.Rank8 - square.Rank)
+	if square.Rank == chess.Rank2 {
+		moves--
+	}
+	return moves
+}
+
+// pawnStructure scores each side's pawns: w.DoubledPawn for every pawn beyond the first on a file, w.IsolatedPawn for
+// each pawn with no friendly pawn on an adjacent file, w.BackwardPawn for each pawn whose neighbours have all advanced
+// past it and whose next square an enemy pawn guards, and w.PassedPawn for every rank each passed pawn has advanced.
+func pawnStructure(p *chess.Position, w *Weights) float64 {
+	return pawnStructureFor(p, chess.White, w) - pawnStructureFor(p, chess.Black, w)
+}
+
+func pawnStructureFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	pawn := chess.Piece{Color: c, Type: chess.Pawn}
+	// counts and rearmost hold, for each file indexed from FileA at 1, how many c pawns it has and the relative rank of
+	// the least advanced one. The files either side of the board stay empty.
+	var counts, rearmost [10]int
+	var pawns []chess.Square
+	for _, square := range chess.AllSquares {
+		if p.PieceAt(square) != pawn {
+			continue
+		}
+		pawns = append(pawns, square)
+		rank := relativeRank(square, c)
+		f := int(square.File)
+		counts[f]++
+		if rearmost[f] == 0 || rank < rearmost[f] {
+			rearmost[f] = rank
+		}
+	}
+
+	score := 0.0
+	for f := int(chess.FileA); f <= int(chess.FileH); f++ {
+		if counts[f] > 1 {
+			score -= float64(counts[f]-1) * w.DoubledPawn
+		}
+	}
+	for _, square := range pawns {
+		f, rank := int(square.File), relativeRank(square, c)
+		switch {
+		case counts[f-1] == 0 && counts[f+1] == 0:
+			score -= w.IsolatedPawn
+		case (counts[f-1] == 0 || rearmost[f-1] > rank) && (counts[f+1] == 0 || rearmost[f+1] > rank) &&
+			stopGuarded(p, square, c):
+			score -= w.BackwardPawn
+		}
+		if isPassedPawn(p, square, c) {
+			score += float64(rank-2) * w.PassedPawn
+		}
+	}
+	return score
+}
+
+// stopGuarded reports whether an enemy pawn guards the square in front of the c pawn on square.
+func stopGuarded(p *chess.Position, square chess.Square, c chess.Color) bool {
+	forward := 1
+	enemyPawn := chess.Piece{Color: chess.Black, Type: chess.Pawn}
+	if c == chess.Black {
+		forward = -1
+		enemyPawn = chess.Piece{Color: chess.White, Type: chess.Pawn}
+	}
+	r := int(square.Rank) + 2*forward
+	if r < int(chess.Rank1) || r > int(chess.Rank8) {
+		return false
+	}
+	for _, f := range []int{int(square.File) - 1, int(square.File) + 1} {
+		if f >= int(chess.FileA) && f <= int(chess.FileH) &&
+			p.PieceAt(chess.Square{File: chess.File(f), Rank: chess.Rank(r)}) == enemyPawn {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeRank returns the rank of square counted from c's side of the board, 1 to 8.
+func relativeRank(square chess.Square, c chess.Color) int {
+	if c == chess.Black {
+		square = mirror(square)
+	}
+	return int(square.Rank)
+}
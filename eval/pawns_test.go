@@ -0,0 +1,51 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestPromotionRaceFavoursSideToMove(t *testing.T) {
+	// Both pawns are three moves from queening, so whoever moves first queens first.
+	white := mustParseFen(t, "7k/8/8/1P6/6p1/8/8/K7 w - - 0 1")
+	black := mustParseFen(t, "7k/8/8/1P6/6p1/8/8/K7 b - - 0 1")
+	if got := promotionRace(&white, &DefaultWeights); got <= 0 {
+		t.Errorf("race with white to move scores %v, want it positive", got)
+	}
+	if got := promotionRace(&black, &DefaultWeights); got >= 0 {
+		t.Errorf("race with black to move scores %v, want it negative", got)
+	}
+	// A pawn that is not passed is not racing.
+	blocked := mustParseFen(t, "7k/1p6/8/1P6/8/8/8/K7 w - - 0 1")
+	if got := promotionRace(&blocked, &DefaultWeights); got != 0 {
+		t.Errorf("blocked pawns score %v in the race, want 0", got)
+	}
+}
+
+func TestPawnStructureTerms(t *testing.T) {
+	w := &DefaultWeights
+	for _, tc := range []struct {
+		name string
+		fen  string
+		want float64
+	}{
+		{"doubled", "4k3/2pp4/8/8/8/2P5/2PP4/4K3 w - - 0 1", -w.DoubledPawn},
+		{"isolated", "4k3/p1p5/8/8/8/8/P1P5/4K3 w - - 0 1", -2 * w.IsolatedPawn},
+		{"backward", "4k3/3p4/8/8/1p1P4/8/2P5/4K3 w - - 0 1", -w.BackwardPawn},
+		{"passed", "4k3/8/8/4P3/3P4/8/8/4K3 w - - 0 1", 5 * w.PassedPawn},
+		{"sound", "4k3/2pp4/8/8/8/8/2PP4/4K3 w - - 0 1", 0},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if got := pawnStructureFor(&p, chess.White, w); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s pawns score %v for white, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Black's pawns are white's doubled ones mirrored, so they cost black the same.
+	p := mustParseFen(t, "4k3/2pp4/2p5/8/8/8/2PP4/4K3 w - - 0 1")
+	if got := pawnStructure(&p, w); math.Abs(got-w.DoubledPawn) > 1e-9 {
+		t.Errorf("black's doubled pawns score %v, want %v for white", got, w.DoubledPawn)
+	}
+}
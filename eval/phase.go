@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// Phase labels the stage of a game for display.
+type Phase int
+
+const (
+	Opening Phase = iota
+	Middlegame
+	Endgame
+)
+
+func (ph Phase) String() string {
+	switch ph {
+	case Opening:
+		return "opening"
+	case Middlegame:
+		return "middlegame"
+	case Endgame:
+		return "endgame"
+	}
+	return "unknown"
+}
+
+// MaterialPhase returns 1 while all non-pawn material is on the board, falling to 0 as it is traded off. This is the
+// phase the tapered terms of Evaluate are scaled by.
+func MaterialPhase(p *chess.Position) float64 {
+	return phase(p)
+}
+
+// GamePhase labels p as the opening while nearly all material is on the board and at least half of the minor pieces
+// are still undeveloped, and as the endgame once most non-pawn material is gone. The search uses the continuous phase
+// instead.
+func GamePhase(p *chess.Position) Phase {
+	const openingPhase = 0.9
+	const endgamePhase = 0.3
+	const openingUndevelopedMinors = 4
+
+	ph := phase(p)
+	if ph <= endgamePhase {
+		return Endgame
+	}
+	if ph >= openingPhase && undevelopedMinors(p, chess.White)+undevelopedMinors(p, chess.Black) >= openingUndevelopedMinors {
+		return Opening
+	}
+	return Middlegame
+}
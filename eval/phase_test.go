@@ -0,0 +1,27 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestGamePhase(t *testing.T) {
+	for _, tc := range []struct {
+		fen  string
+		want Phase
+	}{
+		{chess.DefaultFen, Opening},
+		// Every piece is still on the board, but the minor pieces are all developed.
+		{"r2q1rk1/ppp2ppp/2nbbn2/3pp3/3PP3/2NBBN2/PPP2PPP/R2Q1RK1 w - - 0 8", Middlegame},
+		// Queens and rooks with most of the minor pieces traded.
+		{"2rq1rk1/pp3ppp/4p3/8/3P4/8/PP3PPP/2RQ1RK1 w - - 0 20", Middlegame},
+		{"8/pp3kpp/8/8/8/8/PP3KPP/8 w - - 0 40", Endgame},
+		{"8/8/4k3/8/8/3K4/8/8 w - - 0 60", Endgame},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if got := GamePhase(&p); got != tc.want {
+			t.Errorf("GamePhase(%s) = %s, want %s", tc.fen, got, tc.want)
+		}
+	}
+}
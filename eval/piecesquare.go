@@ -0,0 +1,136 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// PieceSquareTable is a bonus in pawns for each square a white piece may stand on, laid out as chess.Position.Board is:
+// index 0 is a8 and 63 is h1, so a table reads like a diagram from white's side. Black pieces use it mirrored.
+type PieceSquareTable [64]float64
+
+// PieceSquareTables holds a table for each piece type. The king's table is for the middlegame, and is blended into
+// KingEndgame as material comes off.
+type PieceSquareTables struct {
+	Pawn, Knight, Bishop, Rook, Queen, King, KingEndgame PieceSquareTable
+}
+
+// DefaultPieceSquareTables are Tomasz Michniewski's tables from his Simplified Evaluation Function.
+var DefaultPieceSquareTables = PieceSquareTables{
+	Pawn: centipawns([64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}),
+	Knight: centipawns([64]int{
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	}),
+	Bishop: centipawns([64]int{
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	}),
+	Rook: centipawns([64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	}),
+	Queen: centipawns([64]int{
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	}),
+	King: centipawns([64]int{
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	}),
+	KingEndgame: centipawns([64]int{
+		-50, -40, -30, -20, -20, -30, -40, -50,
+		-30, -20, -10, 0, 0, -10, -20, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -30, 0, 0, 0, 0, -30, -30,
+		-50, -30, -30, -30, -30, -30, -30, -50,
+	}),
+}
+
+func centipawns(values [64]int) PieceSquareTable {
+	var t PieceSquareTable
+	for i, v := range values {
+		t[i] = float64(v) / 100
+	}
+	return t
+}
+
+// pieceSquare returns the sum of the piece-square bonuses of white's pieces less those of black's, scaled by
+// w.PieceSquare.
+func pieceSquare(p *chess.Position, w *Weights) float64 {
+	if w.PieceSquare == 0 {
+		return 0
+	}
+	ph := phase(p)
+	t := &w.PieceSquareTables
+	total := 0.0
+	for i, piece := range p.Board {
+		square := i
+		if piece.Color == chess.Black {
+			// Flip the rank, keeping the file.
+			square ^= 56
+		}
+		var bonus float64
+		switch piece.Type {
+		case chess.Pawn:
+			bonus = t.Pawn[square]
+		case chess.Knight:
+			bonus = t.Knight[square]
+		case chess.Bishop:
+			bonus = t.Bishop[square]
+		case chess.Rook:
+			bonus = t.Rook[square]
+		case chess.Queen:
+			bonus = t.Queen[square]
+		case chess.King:
+			bonus = ph*t.King[square] + (1-ph)*t.KingEndgame[square]
+		}
+		if piece.Color == chess.White {
+			total += bonus
+		} else if piece.Color == chess.Black {
+			total -= bonus
+		}
+	}
+	return total * w.PieceSquare
+}
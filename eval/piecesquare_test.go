@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPieceSquarePrefersGoodSquares(t *testing.T) {
+	start := mustParseFen(t, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if got := pieceSquare(&start, &DefaultWeights); got != 0 {
+		t.Errorf("the starting position scores %v, want 0 as it is symmetric", got)
+	}
+	for _, tc := range []struct {
+		name          string
+		better, worse string
+	}{
+		{"central knight", "4k3/8/8/8/3N4/8/8/4K3 w - - 0 1", "4k3/8/8/8/8/8/8/N3K3 w - - 0 1"},
+		{"advanced pawn", "4k3/8/4P3/8/8/8/8/4K3 w - - 0 1", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"},
+		{"king on the back rank", "rq2k3/8/8/8/8/8/8/RQ4K1 w - - 0 1", "rq2k3/8/8/8/8/8/6K1/RQ6 w - - 0 1"},
+	} {
+		better, worse := mustParseFen(t, tc.better), mustParseFen(t, tc.worse)
+		if pieceSquare(&better, &DefaultWeights) <= pieceSquare(&worse, &DefaultWeights) {
+			t.Errorf("%s scores %v, want more than the %v of %s", tc.name, pieceSquare(&better, &DefaultWeights),
+				pieceSquare(&worse, &DefaultWeights), tc.worse)
+		}
+	}
+
+	// Black's knight on d5 is white's on d4 mirrored.
+	white := mustParseFen(t, "4k3/8/8/8/3N4/8/8/4K3 w - - 0 1")
+	black := mustParseFen(t, "4k3/8/8/3n4/8/8/8/4K3 w - - 0 1")
+	if got, want := pieceSquare(&black, &DefaultWeights), -pieceSquare(&white, &DefaultWeights); got != want {
+		t.Errorf("black's knight on d5 scores %v, want %v", got, want)
+	}
+}
+
+func TestPieceSquareTablesCanBeOverridden(t *testing.T) {
+	p := mustParseFen(t, "4k3/8/8/8/3N4/8/8/4K3 w - - 0 1")
+	w := DefaultWeights
+	w.PieceSquareTables = PieceSquareTables{}
+	w.PieceSquareTables.Knight[35] = 1 // d4
+	if got := pieceSquare(&p, &w); got != w.PieceSquare {
+		t.Errorf("a knight on the only square of its table scores %v, want %v", got, w.PieceSquare)
+	}
+
+	// The tables add to the material, which is left as it was.
+	noTables := without(func(w *Weights) { w.PieceSquare = 0 })
+	if got := Evaluate(&p, nil) - Evaluate(&p, noTables); math.Abs(got-pieceSquare(&p, &DefaultWeights)) > 1e-9 {
+		t.Errorf("the tables change the score by %v, want their bonus %v", got, pieceSquare(&p, &DefaultWeights))
+	}
+}
@@ -0,0 +1,63 @@
+package eval
+
+import (
+	"github.com/brighamskarda/chess"
+)
+
+// rookCoordination rewards two rooks doubled on a file free of their own pawns, and rooks connected on their back rank.
+// The connected bonus is scaled by phase since it mostly matters before the back rank empties of minor pieces anyway.
+func rookCoordination(p *chess.Position, w *Weights) float64 {
+	return rookCoordinationFor(p, chess.White, w) - rookCoordinationFor(p, chess.Black, w)
+}
+
+func rookCoordinationFor(p *chess.Position, c chess.Color, w *Weights) float64 {
+	rook := chess.Piece{Color: c, Type: chess.Rook}
+	rooks := []chess.Square{}
+	for _, square := range chess.AllSquares {
+		if p.PieceAt(square) == rook {
+			rooks = append(rooks, square)
+		}
+	}
+
+	backRank := chess.Rank1
+	if c == chess.Black {
+		backRank = chess.Rank8
+	}
+
+	total := 0.0
+	for i := 0; i < len(rooks); i++ {
+		for j := i + 1; j < len(rooks); j++ {
+			a, b := rooks[i], rooks[j]
+			if a.File == b.File && !fileHasPawn(p, a.File, chess.Piece{Color: c, Type: chess.Pawn}) {
+				total += w.DoubledRooks
+			}
+			if a.Rank == backRank && b.Rank == backRank && rankClearBetween(p, a, b) {
+				total += w.ConnectedRooks * phase(p)
+			}
+		}
+	}
+	return total
+}
+
+func fileHasPawn(p *chess.Position, f chess.File, pawn chess.Piece) bool {
+	for r := chess.Rank1; r <= chess.Rank8; r++ {
+		if p.PieceAt(chess.Square{File: f, Rank: r}) == pawn {
+			return true
+		}
+	}
+	return false
+}
+
+// rankClearBetween reports whether no pieces stand between a and b, which must share a rank.
+func rankClearBetween(p *chess.Position, a chess.Square, b chess.Square) bool {
+	low, high := a.File, b.File
+	if low > high {
+		low, high = high, low
+	}
+	for f := low + 1; f < high; f++ {
+		if p.PieceAt(chess.Square{File: f, Rank: a.Rank}) != chess.NoPiece {
+			return false
+		}
+	}
+	return true
+}
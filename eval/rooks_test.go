@@ -0,0 +1,44 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDoubledRooksScoreHigher(t *testing.T) {
+	// The same material, with the e-file open for white.
+	doubled := mustParseFen(t, "4k3/pppp1ppp/8/8/8/8/PPPPRPPP/4R1K1 w - - 0 1")
+	apart := mustParseFen(t, "4k3/pppp1ppp/8/8/8/8/PPPPRPPP/R5K1 w - - 0 1")
+	if got := rookCoordination(&doubled, &DefaultWeights); got != DefaultWeights.DoubledRooks {
+		t.Errorf("rooks doubled on an open file score %v, want DoubledRooks %v", got, DefaultWeights.DoubledRooks)
+	}
+	if got := rookCoordination(&apart, &DefaultWeights); got != 0 {
+		t.Errorf("rooks on separate files score %v, want 0", got)
+	}
+	if Evaluate(&doubled, nil) <= Evaluate(&apart, nil) {
+		t.Errorf("doubled rooks evaluate to %v, want more than the %v of rooks on separate files",
+			Evaluate(&doubled, nil), Evaluate(&apart, nil))
+	}
+
+	// Doubling behind a friendly pawn earns nothing, and the bonus is all the weight changes.
+	blocked := mustParseFen(t, "4k3/pppp1ppp/8/8/4P3/8/PPPPRPPP/4R1K1 w - - 0 1")
+	if got := rookCoordination(&blocked, &DefaultWeights); got != 0 {
+		t.Errorf("rooks doubled behind their own pawn score %v, want 0", got)
+	}
+	noBonus := without(func(w *Weights) { w.DoubledRooks = 0 })
+	if got := Evaluate(&doubled, nil) - Evaluate(&doubled, noBonus); math.Abs(got-DefaultWeights.DoubledRooks) > 1e-9 {
+		t.Errorf("DoubledRooks changes the score by %v, want %v", got, DefaultWeights.DoubledRooks)
+	}
+}
+
+func TestConnectedRooksScaledByPhase(t *testing.T) {
+	connected := mustParseFen(t, "r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R4RK1 w - - 0 1")
+	want := DefaultWeights.ConnectedRooks * phase(&connected)
+	if got := rookCoordination(&connected, &DefaultWeights); math.Abs(got-want) > 1e-9 {
+		t.Errorf("rooks connected on the back rank score %v, want %v", got, want)
+	}
+	blocked := mustParseFen(t, "r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R2Q1RK1 w - - 0 1")
+	if got := rookCoordination(&blocked, &DefaultWeights); got != 0 {
+		t.Errorf("rooks with the queen between them score %v, want 0", got)
+	}
+}
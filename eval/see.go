@@ -0,0 +1,128 @@
+package eval
+
+import (
+	"math"
+
+	"github.com/brighamskarda/chess"
+)
+
+// SEE returns the static exchange evaluation of move from p: the material, in pawns by w, that the side playing it wins
+// if both sides then keep recapturing on its target square with their least valuable piece, each stopping once
+// carrying on would lose more. Pieces lined up behind a capturer join in as the capturer leaves. Pins are ignored, and
+// so are promotions after the first capture. A move that captures nothing starts the exchange at 0, so SEE tells
+// whether it leaves the moved piece en prise. A nil w uses DefaultWeights.
+func SEE(p *chess.Position, move chess.Move, w *Weights) float64 {
+	if w == nil {
+		w = &DefaultWeights
+	}
+	board := p.Board
+	from, to := boardIndex(move.FromSquare), boardIndex(move.ToSquare)
+	mover := board[from]
+	if mover.Type == chess.NoPieceType {
+		return 0
+	}
+
+	gains := []float64{seeValue(board[to], w)}
+	if mover.Type == chess.Pawn && move.ToSquare == p.EnPassant && p.EnPassant != chess.NoSquare {
+		gains[0] = w.Pawn
+		board[boardIndex(chess.Square{File: move.ToSquare.File, Rank: move.FromSquare.Rank})] = chess.NoPiece
+	}
+	if move.Promotion != chess.NoPieceType {
+		mover.Type = move.Promotion
+		gains[0] += seeValue(mover, w) - w.Pawn
+	}
+	board[from] = chess.NoPiece
+	board[to] = mover
+
+	side := opponent(mover.Color)
+	for {
+		attacker, ok := leastAttacker(&board, to, side, w)
+		if !ok {
+			break
+		}
+		if board[attacker].Type == chess.King {
+			// The king may only take last, when nothing can take it back.
+			if _, defended := leastAttacker(&board, to, opponent(side), w); defended {
+				break
+			}
+		}
+		gains = append(gains, seeValue(board[to], w)-gains[len(gains)-1])
+		board[to], board[attacker] = board[attacker], chess.NoPiece
+		side = opponent(side)
+	}
+
+	// Each side may decline to recapture, so work back from the end of the exchange.
+	for i := len(gains) - 1; i > 0; i-- {
+		gains[i-1] = -math.Max(-gains[i-1], gains[i])
+	}
+	return gains[0]
+}
+
+// seeValue returns the value of piece for exchanges: its value by w whatever its color, and more than any other
+// piece for a king.
+func seeValue(piece chess.Piece, w *Weights) float64 {
+	if piece.Type == chess.King {
+		return 2 * MateScore
+	}
+	return math.Abs(PieceValue(piece, w))
+}
+
+// leastAttacker returns the board index of the least valuable c piece attacking the square at index target.
+func leastAttacker(board *[64]chess.Piece, target int, c chess.Color, w *Weights) (int, bool) {
+	file, rank := target%8, target/8
+	best, bestValue := -1, math.Inf(1)
+	consider := func(f, r int, types ...chess.PieceType) bool {
+		if f < 0 || f > 7 || r < 0 || r > 7 {
+			return false
+		}
+		i := r*8 + f
+		piece := board[i]
+		for _, t := range types {
+			if piece.Color == c && piece.Type == t {
+				if value := seeValue(piece, w); value < bestValue {
+					best, bestValue = i, value
+				}
+			}
+		}
+		return piece.Type != chess.NoPieceType
+	}
+
+	// Board rows run from rank 8 down, so a white pawn attacks the row above it, which has the lower index.
+	pawnRow := rank + 1
+	if c == chess.Black {
+		pawnRow = rank - 1
+	}
+	consider(file-1, pawnRow, chess.Pawn)
+	consider(file+1, pawnRow, chess.Pawn)
+	for _, d := range [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}} {
+		consider(file+d[0], rank+d[1], chess.Knight)
+	}
+	// ray considers the king next to target in direction df, dr and the first piece of any kind along it.
+	ray := func(df, dr int, types ...chess.PieceType) {
+		consider(file+df, rank+dr, chess.King)
+		for f, r := file+df, rank+dr; f >= 0 && f <= 7 && r >= 0 && r <= 7; f, r = f+df, r+dr {
+			if consider(f, r, types...) {
+				break
+			}
+		}
+	}
+	for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+		ray(d[0], d[1], chess.Rook, chess.Queen)
+	}
+	for _, d := range [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}} {
+		ray(d[0], d[1], chess.Bishop, chess.Queen)
+	}
+	return best, best >= 0
+}
+
+// boardIndex returns the index of square in chess.Position.Board, where 0 is a8 and 63 is h1.
+func boardIndex(square chess.Square) int {
+	return int(square.File-1) + int(chess.Rank8-square.Rank)*8
+}
+
+func opponent(c chess.Color) chess.Color {
+	if c == chess.White {
+		return chess.Black
+	}
+	return chess.White
+}
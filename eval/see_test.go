@@ -0,0 +1,31 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSEEResolvesExchanges(t *testing.T) {
+	w := &DefaultWeights
+	for _, tc := range []struct {
+		name string
+		fen  string
+		move string
+		want float64
+	}{
+		{"knight takes a pawn defended by a pawn", "4k3/8/3p4/4p3/8/5N2/8/4K3 w - - 0 1", "f3e5", w.Pawn - w.Knight},
+		{"knight takes a lone pawn", "4k3/8/8/4p3/8/5N2/8/4K3 w - - 0 1", "f3e5", w.Pawn},
+		{"pawn takes a defended knight", "4k3/2p5/3n4/4P3/8/8/8/4K3 w - - 0 1", "e5d6", w.Knight - w.Pawn},
+		{"rook takes a pawn defended by a rook", "4r1k1/8/8/4p3/8/8/4R3/6K1 w - - 0 1", "e2e5", w.Pawn - w.Rook},
+		{"doubled rooks take a pawn defended by a rook", "4r1k1/8/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", w.Pawn},
+		{"queen steps next to a pawn", "4k3/8/8/2p5/8/8/8/3QK3 w - - 0 1", "d1d4", -w.Queen},
+		{"pawn takes en passant", "4k3/8/8/3Pp3/8/8/8/4K3 w - e6 0 1", "d5e6", w.Pawn},
+		{"rook takes a pawn the king defends", "8/8/8/4k3/3p4/8/3R4/4K3 w - - 0 1", "d2d4", w.Pawn - w.Rook},
+		{"king may not take a defended rook", "8/8/8/4k3/3p4/8/3R4/3RK3 w - - 0 1", "d2d4", w.Pawn},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if got := SEE(&p, mustParseMove(t, tc.move), nil); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: SEE of %s is %v, want %v", tc.name, tc.move, got, tc.want)
+		}
+	}
+}
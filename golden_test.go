@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/golden_moves.txt with the moves the agents play now")
+
+// goldenFile holds the move each agent plays from each golden position, as lines of spec, FEN and UCI move separated
+// by tabs. Regenerate it with go test -run TestGoldenMoves -update after a change that is meant to alter play.
+const goldenFile = "testdata/golden_moves.txt"
+
+// goldenSpecs are agents whose play depends on nothing but the position: no time limits, and seeded randomness.
+var goldenSpecs = []string{"ab:depth=3", "minmax:depth=2", "mcts:sequential=true,iterations=300,seed=1"}
+
+var goldenPositions = []string{
+	chess.DefaultFen,
+	"r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3",
+	"r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/3P1N2/PPP2PPP/RNBQK2R w KQkq - 0 5",
+	"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1",
+	"8/5k2/8/3K4/4P3/8/8/8 w - - 0 1",
+	"4k3/8/3r4/4PK2/8/8/8/1R6 b - - 0 1",
+}
+
+// goldenMoves returns the lines of goldenFile as the agents play now.
+func goldenMoves(t *testing.T) []string {
+	var lines []string
+	for _, spec := range goldenSpecs {
+		player, err := parseAgentSpec(spec, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fen := range goldenPositions {
+			p, err := chess.ParseFen(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, fmt.Sprintf("%s\t%s\t%s", spec, fen, strings.ToLower(player.GetMove(*p).String())))
+		}
+	}
+	return lines
+}
+
+func TestGoldenMoves(t *testing.T) {
+	got := goldenMoves(t)
+	if *update {
+		if err := os.WriteFile(goldenFile, []byte(strings.Join(got, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	file, err := os.Open(goldenFile)
+	if err != nil {
+		t.Fatalf("could not open %s, regenerate it with -update: %v", goldenFile, err)
+	}
+	defer file.Close()
+	var want []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		want = append(want, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d golden moves played, but %s has %d, regenerate it with -update", len(got), goldenFile, len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("agent now plays %q, golden file has %q", got[i], want[i])
+		}
+	}
+}
@@ -2,84 +2,317 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"slices"
 	"strings"
 
+	"github.com/brighamskarda/applechess.git/agent"
 	"github.com/brighamskarda/applechess.git/alphabeta"
-	"github.com/brighamskarda/applechess.git/mcts"
 	"github.com/brighamskarda/applechess.git/minmax"
+	"github.com/brighamskarda/applechess.git/pgn"
 	"github.com/brighamskarda/chess"
 )
 
 func main() {
-	agents := parseArgs()
+	if err := dispatch(os.Args[1:], commands); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// commands maps each subcommand to its entry point, which receives the arguments following the subcommand name.
+var commands = map[string]func(args []string) error{
+	"play":       playCommand,
+	"analyze":    analyzeCommand,
+	"bench":      benchCommand,
+	"perft":      perftCommand,
+	"tournament": tournamentCommand,
+	"uci":        uciCommand,
+}
+
+// dispatch runs the subcommand named by args[0]. When no subcommand is given, or args starts with a flag, the arguments
+// are passed to play so the original flat command line keeps working.
+func dispatch(args []string, commands map[string]func(args []string) error) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commands["play"](args)
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, expected one of [play|analyze|bench|perft|tournament|uci]", args[0])
+	}
+	return command(args[1:])
+}
+
+func playCommand(args []string) error {
+	config, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	var pgnOut *os.File
+	if config.pgnFile != "" {
+		pgnOut, err = os.Create(config.pgnFile)
+		if err != nil {
+			return fmt.Errorf("could not create -pgn file: %w", err)
+		}
+		defer pgnOut.Close()
+	}
+	if config.openings != nil || config.games > 1 {
+		var matchOut io.Writer
+		if pgnOut != nil {
+			matchOut = pgnOut
+		}
+		if config.openings != nil {
+			fmt.Print(selfPlay(config, config.openings, 2*len(config.openings), matchOut))
+		} else {
+			fmt.Print(selfPlay(config, []chess.Position{*chess.NewGame().Position()}, config.games, matchOut))
+		}
+		return nil
+	}
 
+	game, moves, err := play(config, os.Stdout)
+	if err != nil {
+		slog.Error(err.Error())
+	}
+	if pgnOut != nil {
+		record := matchGame{names: config.names, opening: *chess.NewGame().Position(), moves: moves, result: game.GetResult()}
+		record.write(pgnOut, "applechess game", 1)
+		// The deferred Close would not run past os.Exit.
+		if err := pgnOut.Close(); err != nil {
+			slog.Error("could not write -pgn file", "err", err)
+		}
+	}
+
+	switch game.GetResult() {
+	case chess.WhiteWins:
+		fmt.Println("White Wins!")
+		os.Exit(0)
+	case chess.BlackWins:
+		fmt.Println("Black Wins!")
+		os.Exit(0)
+	case chess.Draw:
+		fmt.Println("The Game has been automatically Drawn")
+		os.Exit(1)
+	}
+
+	return errors.New("the program ended without checkmate or draw")
+}
+
+// play runs the single game described by config from the starting position, printing it to out, and returns the
+// finished game and its moves. Unlike playCommand it never exits the process, so it can be driven with scripted agents.
+func play(config playConfig, out io.Writer) (*chess.Game, []pgn.Move, error) {
 	game := chess.NewGame()
+	moves, err := runGame(game, config.agents, out, config.ponder, 0)
+	return game, moves, err
+}
 
-	for !game.IsCheckMate() && !game.CanClaimDraw() {
-		game.PrintPosition()
-		move := chess.Move{}
+// scoringAgent is an agent that also reports the score, from white's perspective, and depth of the search behind its
+// move.
+type scoringAgent interface {
+	GetMoveStats(chess.Position) (chess.Move, alphabeta.Stats)
+}
+
+// runGame plays agents against each other from the current position of game until checkmate or a claimable draw,
+// printing each position and move to out, and returns the moves played. Moves by a scoringAgent carry its evaluation,
+// and moves that did not come from search are printed with their agent.MoveSource. An agent that returns an illegal
+// move forfeits the game, and the returned error describes the move. The result is left in game. If ponder is set, an
+// agent.Ponderer thinks about its next move while its opponent chooses theirs. If maxPlies is positive, the game is
+// drawn once that many half-moves have been played.
+func runGame(game *chess.Game, agents [2]ChessAgent, out io.Writer, ponder bool, maxPlies int) ([]pgn.Move, error) {
+	var moves []pgn.Move
+	var history []chess.Position
+	stopPondering := [2]func(){func() {}, func() {}}
+	defer func() {
+		for _, stop := range stopPondering {
+			stop()
+		}
+	}()
+	for !game.IsCheckMate() && !game.CanClaimDraw() && (maxPlies <= 0 || len(moves) < maxPlies) {
+		fmt.Fprintln(out, game.Position().FormatString(game.Turn() == chess.Black))
+		var side int
 		if game.Turn() == chess.White {
-			fmt.Println("White's move")
-			move = agents[0].GetMove(*game.Position())
+			fmt.Fprintln(out, "White's move")
+			side = 0
 		} else if game.Turn() == chess.Black {
-			fmt.Println("Black's move")
-			move = agents[1].GetMove(*game.Position())
+			fmt.Fprintln(out, "Black's move")
+			side = 1
 		} else {
-			slog.Error("game.Turn() is not black or white")
-			os.Exit(1)
+			return moves, errors.New("game.Turn() is not black or white")
 		}
-		if game.Move(move) != nil {
-			slog.Error("agent provided invalid move", "agent-color", game.Turn())
-			os.Exit(1)
+		stopPondering[side]()
+		stopPondering[side] = func() {}
+		player := withHistory(agents[side], history)
+		var record pgn.Move
+		source := agent.Search
+		if scorer, ok := player.(scoringAgent); ok {
+			var stats alphabeta.Stats
+			record.Move, stats = scorer.GetMoveStats(*game.Position())
+			record.Scored, record.Score, record.Depth = true, stats.Score, stats.Depth
+			source = stats.Source
+		} else {
+			record.Move, source = agent.GetMoveSource(player, *game.Position())
+		}
+		move := record.Move
+		if !slices.Contains(agent.LegalMoves(game.Position()), move) {
+			err := forfeitError{
+				color: game.Turn(),
+				agent: player,
+				move:  move,
+				fen:   chess.GenerateFen(game.Position()),
+			}
+			if game.Turn() == chess.White {
+				game.SetResult(chess.BlackWins)
+			} else {
+				game.SetResult(chess.WhiteWins)
+			}
+			return moves, err
+		}
+		san := pgn.San(move, game.Position())
+		history = append(history, *game.Position())
+		game.Move(move)
+		moves = append(moves, record)
+		if ponder {
+			ponderHistory := append(slices.Clone(history), *game.Position())
+			stopPondering[side] = startPondering(withHistory(agents[side], ponderHistory), *game.Position())
 		}
-		fmt.Println(move)
-		fmt.Println()
+		if source != agent.Search {
+			san += " (" + source.String() + ")"
+		}
+		fmt.Fprintln(out, san)
+		fmt.Fprintln(out)
 	}
 
-	if game.IsCheckMate() {
-		switch game.Turn() {
-		case chess.Black:
-			fmt.Println("White Wins!")
-		case chess.White:
-			fmt.Println("Black Wins!")
-		}
-		os.Exit(0)
+	if !game.IsCheckMate() {
+		game.SetResult(chess.Draw)
 	}
+	return moves, nil
+}
 
-	if game.CanClaimDraw() {
-		fmt.Println("The Game has been automatically Drawn")
-		os.Exit(1)
+// forfeitError describes an agent that lost by returning an illegal move.
+type forfeitError struct {
+	color chess.Color
+	agent ChessAgent
+	move  chess.Move
+	fen   string
+}
+
+func (e forfeitError) Error() string {
+	return fmt.Sprintf("%s forfeits: agent %T returned illegal move %s in position %s", e.color, e.agent, e.move, e.fen)
+}
+
+// startPondering has player, if it is an agent.Ponderer, think in the background about its reply to the move it
+// predicts from p, the position its own move led to. The function returned stops it and waits for it to finish.
+func startPondering(player ChessAgent, p chess.Position) func() {
+	ponderer, ok := player.(agent.Ponderer)
+	if !ok {
+		return func() {}
 	}
+	predicted := ponderer.Predict(p)
+	if predicted == (chess.Move{}) {
+		return func() {}
+	}
+	p.Move(predicted)
+	return ponderInBackground(ponderer, p)
+}
 
-	slog.Error("the program ended without checkmate or draw")
-	os.Exit(1)
+// ponderInBackground starts ponderer searching p on a goroutine of its own. The function returned stops it and waits
+// for it to finish.
+func ponderInBackground(ponderer agent.Ponderer, p chess.Position) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ponderer.Ponder(ctx, p)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// withHistory returns player set up to know the positions played before the current one, oldest first, if it searches
+// for repetitions.
+func withHistory(player ChessAgent, history []chess.Position) ChessAgent {
+	switch agent := player.(type) {
+	case alphabeta.AlphaBeta:
+		agent.History = history
+		return agent
+	case minmax.Minmax:
+		agent.History = history
+		return agent
+	}
+	return player
 }
 
 type ChessAgent interface {
 	GetMove(chess.Position) chess.Move
 }
 
-func parseArgs() [2]ChessAgent {
-	help := flag.Bool("help", false, "prints help")
-	player1 := flag.String("p1", "human", "agent to play white [human|mcts|minmax|ab]")
-	player2 := flag.String("p2", "human", "agent to play black [human|mcts|minmax|ab]")
-	player1Option := flag.Int("o1", 2, "option for player1, for depth based agents this the depth, for time based agents this is the time in seconds")
-	player2Option := flag.Int("o2", 2, "option for player2, for depth based agents this the depth, for time based agents this is the time in seconds")
-	logLevel := flag.String("log", "ERROR", "logging level [ERROR|WARN|INFO|DEBUG]")
+// playConfig holds the parsed arguments of the play command.
+type playConfig struct {
+	agents   [2]ChessAgent
+	names    [2]string // The agent specs, naming the players in PGN output
+	games    int
+	openings []chess.Position // nil unless -openings was given
+	pgnFile  string
+	ponder   bool
+}
+
+func parseArgs(args []string) (playConfig, error) {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	help := flags.Bool("help", false, "prints help")
+	player1 := flags.String("p1", "human", "agent to play white, optionally with options such as ab:depth=4 or mcts:time=3 [human|mcts|minmax|ab]")
+	player2 := flags.String("p2", "human", "agent to play black, optionally with options such as ab:depth=4 or mcts:time=3 [human|mcts|minmax|ab]")
+	player1Option := flags.Int("o1", 2, "default depth or time in seconds for player1, used when -p1 gives neither")
+	player2Option := flags.Int("o2", 2, "default depth or time in seconds for player2, used when -p2 gives neither")
+	logLevel := flags.String("log", "ERROR", "logging level [ERROR|WARN|INFO|DEBUG]")
+	games := flags.Int("games", 1, "number of games to play, alternating colors, printing a scorecard at the end when more than 1")
+	openingsFile := flags.String("openings", "", "file of starting FENs, one per line, each played once with either player as white. Overrides -games.")
+	pgnFile := flags.String("pgn", "", "file to write the game, or the games of a match, to in PGN, with engine evaluations")
+	ponder := flags.Bool("ponder", false, "let agents that keep their search between moves, such as ab:reuse=true, think on the opponent's time")
 
-	flag.Parse()
+	flags.Parse(args)
 
 	if *help {
-		flag.PrintDefaults()
+		flags.PrintDefaults()
 		os.Exit(0)
 	}
 
-	switch strings.ToUpper(*logLevel) {
+	setLogLevel(*logLevel)
+	config := playConfig{names: [2]string{*player1, *player2}, games: *games, pgnFile: *pgnFile, ponder: *ponder}
+
+	var err error
+	config.agents[0], err = parseAgentSpec(*player1, *player1Option)
+	if err != nil {
+		return config, fmt.Errorf("could not parse -p1 argument: %w", err)
+	}
+	config.agents[1], err = parseAgentSpec(*player2, *player2Option)
+	if err != nil {
+		return config, fmt.Errorf("could not parse -p2 argument: %w", err)
+	}
+
+	if *openingsFile != "" {
+		file, err := os.Open(*openingsFile)
+		if err != nil {
+			return config, fmt.Errorf("could not open -openings file: %w", err)
+		}
+		defer file.Close()
+		config.openings, err = readOpenings(file)
+		if err != nil {
+			return config, fmt.Errorf("could not read -openings file: %w", err)
+		}
+	}
+
+	return config, nil
+}
+
+func setLogLevel(logLevel string) {
+	switch strings.ToUpper(logLevel) {
 	case "ERROR":
 		slog.SetLogLoggerLevel(slog.LevelError)
 	case "WARN":
@@ -90,57 +323,82 @@ func parseArgs() [2]ChessAgent {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 	default:
 		slog.SetLogLoggerLevel(slog.LevelError)
-		slog.Error("could not parse log argument", "arg", *logLevel)
-	}
-	agents := [2]ChessAgent{}
-
-	switch strings.ToLower(*player1) {
-	case "human":
-		agents[0] = Human{}
-	case "mcts":
-		agents[0] = mcts.Mcts{Duration: *player1Option}
-	case "minmax":
-		agents[0] = minmax.Minmax{Depth: *player1Option}
-	case "ab":
-		agents[0] = alphabeta.AlphaBeta{Depth: *player1Option}
-	default:
-		slog.Error("could not parse -p1 argument", "arg", *player1)
-		os.Exit(1)
-	}
-
-	switch strings.ToLower(*player2) {
-	case "human":
-		agents[1] = Human{}
-	case "mcts":
-		agents[1] = mcts.Mcts{Duration: *player2Option}
-	case "minmax":
-		agents[1] = minmax.Minmax{Depth: *player2Option}
-	case "ab":
-		agents[1] = alphabeta.AlphaBeta{Depth: *player2Option}
-	default:
-		slog.Error("could not parse -p2 argument", "arg", *player2)
-		os.Exit(1)
+		slog.Error("could not parse log argument", "arg", logLevel)
 	}
+}
 
-	return agents
+// Human reads moves from a person, or from a script of moves, one per line.
+type Human struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+	// hint, if not nil, searches the position while the person thinks, and the move it has found so far is shown when
+	// they enter hint instead of a move.
+	hint agent.Ponderer
 }
 
-type Human struct{}
+// NewHuman returns a Human reading moves from r.
+func NewHuman(r io.Reader) Human {
+	return Human{scanner: bufio.NewScanner(r), out: os.Stdout}
+}
 
+// GetMove reads moves in UCI notation, such as e2e4, or in SAN, such as Nf3 or O-O, until one is legal. It returns the
+// zero move, which forfeits the game, once the input runs out.
 func (h Human) GetMove(p chess.Position) chess.Move {
-	fmt.Println("Enter Move (format - s1s2):")
-	legalMoves := chess.GenerateLegalMoves(&p)
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		input := scanner.Text()
-		move, err := chess.ParseUCIMove(input)
-		if err != nil || !slices.Contains(legalMoves, move) {
-			fmt.Println("Invalid move")
+	if h.hint != nil {
+		stopHint := ponderInBackground(h.hint, p)
+		defer stopHint()
+		fmt.Fprintln(h.out, "Enter Move (format - e2e4 or Nf3), or hint:")
+	} else {
+		fmt.Fprintln(h.out, "Enter Move (format - e2e4 or Nf3):")
+	}
+	legalMoves := agent.LegalMoves(&p)
+	for h.scanner.Scan() {
+		input := strings.TrimSpace(h.scanner.Text())
+		if h.hint != nil && strings.EqualFold(input, "hint") {
+			h.showHint(p)
+			continue
+		}
+		move, ok := parseHumanMove(input, &p, legalMoves)
+		if !ok {
+			fmt.Fprintln(h.out, "Invalid move")
 			continue
 		}
 		return move
 	}
 	slog.Error("could not get valid move from human")
-	os.Exit(1)
 	return chess.Move{}
 }
+
+// showHint prints the best move the hint search of p has found so far.
+func (h Human) showHint(p chess.Position) {
+	move := h.hint.Predict(p)
+	if move == (chess.Move{}) {
+		fmt.Fprintln(h.out, "No hint yet")
+		return
+	}
+	fmt.Fprintln(h.out, "Hint: "+pgn.San(move, &p))
+}
+
+// parseHumanMove returns the move of legalMoves from p that input names, in UCI notation or SAN. Check and mate
+// suffixes, annotations such as !?, the = of a promotion and zeros for castling are all optional.
+func parseHumanMove(input string, p *chess.Position, legalMoves []chess.Move) (chess.Move, bool) {
+	if move, err := chess.ParseUCIMove(input); err == nil && slices.Contains(legalMoves, move) {
+		return move, true
+	}
+	normalize := func(san string) string {
+		san = strings.TrimRight(san, "+#!?")
+		san = strings.ReplaceAll(san, "=", "")
+		return strings.ReplaceAll(san, "0", "O")
+	}
+	want := normalize(input)
+	for _, move := range legalMoves {
+		if normalize(pgn.San(move, p)) == want {
+			return move, true
+		}
+	}
+	// Disambiguation the SAN of the move would leave out, as in Ngf3, is still accepted.
+	if move, err := chess.ParseSANMove(p, input); err == nil && slices.Contains(legalMoves, move) {
+		return move, true
+	}
+	return chess.Move{}, false
+}
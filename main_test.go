@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+	"github.com/brighamskarda/applechess.git/pgn"
+	"github.com/brighamskarda/chess"
+)
+
+func TestDispatchRunsSubcommand(t *testing.T) {
+	var called string
+	var got []string
+	commands := map[string]func(args []string) error{}
+	for _, name := range []string{"play", "perft"} {
+		commands[name] = func(args []string) error {
+			called, got = name, args
+			return nil
+		}
+	}
+	for _, tc := range []struct {
+		args    []string
+		command string
+		rest    []string
+	}{
+		{[]string{"perft", "-depth", "3"}, "perft", []string{"-depth", "3"}},
+		{[]string{"-p1", "ab"}, "play", []string{"-p1", "ab"}},
+		{nil, "play", nil},
+	} {
+		called, got = "", nil
+		if err := dispatch(tc.args, commands); err != nil {
+			t.Errorf("dispatch(%q) returned %v", tc.args, err)
+		}
+		if called != tc.command || !slices.Equal(got, tc.rest) {
+			t.Errorf("dispatch(%q) ran %s with %q, want %s with %q", tc.args, called, got, tc.command, tc.rest)
+		}
+	}
+	if err := dispatch([]string{"fly"}, commands); err == nil {
+		t.Error("unknown subcommand gave no error")
+	}
+}
+
+// scripted is an agent that plays its moves in turn, whether or not they are legal.
+type scripted struct {
+	moves []chess.Move
+	next  *int
+}
+
+func (s scripted) GetMove(chess.Position) chess.Move {
+	move := s.moves[*s.next]
+	*s.next++
+	return move
+}
+
+func newScripted(t *testing.T, line ...string) scripted {
+	t.Helper()
+	s := scripted{next: new(int)}
+	for _, uci := range line {
+		move, err := chess.ParseUCIMove(uci)
+		if err != nil {
+			t.Fatalf("could not parse move %s: %v", uci, err)
+		}
+		s.moves = append(s.moves, move)
+	}
+	return s
+}
+
+func TestIllegalMoveForfeits(t *testing.T) {
+	white, black := newScripted(t, "e2e4", "d1d3"), newScripted(t, "e7e5")
+	game := chess.NewGame()
+	moves, err := runGame(game, [2]ChessAgent{white, black}, io.Discard, false, 0)
+	var forfeit forfeitError
+	if !errors.As(err, &forfeit) {
+		t.Fatalf("runGame returned %v, want a forfeitError", err)
+	}
+	if forfeit.color != chess.White || forfeit.move != white.moves[1] {
+		t.Errorf("%s forfeited with %s, want white with d1d3", forfeit.color, forfeit.move)
+	}
+	if fen := chess.GenerateFen(game.Position()); !strings.Contains(err.Error(), fen) {
+		t.Errorf("error %q does not give the position %s", err, fen)
+	}
+	if game.GetResult() != chess.BlackWins {
+		t.Errorf("result is %s, want black to win", game.GetResult())
+	}
+	if len(moves) != 2 {
+		t.Errorf("%d moves recorded, want the 2 legal ones before the forfeit", len(moves))
+	}
+}
+
+// pondering is an agent.Ponderer that plays and predicts the first legal move, and thinks until it is stopped.
+type pondering struct {
+	thinking *atomic.Bool
+	started  chan struct{}
+}
+
+func (e pondering) GetMove(p chess.Position) chess.Move {
+	return chess.GenerateLegalMoves(&p)[0]
+}
+
+func (e pondering) Predict(p chess.Position) chess.Move {
+	return e.GetMove(p)
+}
+
+func (e pondering) Ponder(ctx context.Context, p chess.Position) {
+	e.thinking.Store(true)
+	e.started <- struct{}{}
+	<-ctx.Done()
+	e.thinking.Store(false)
+}
+
+// waitingHuman is an agent that plays the first legal move once the opponent has started thinking on its turn.
+type waitingHuman struct {
+	t      *testing.T
+	engine pondering
+}
+
+func (h waitingHuman) GetMove(p chess.Position) chess.Move {
+	select {
+	case <-h.engine.started:
+	case <-time.After(time.Second):
+		h.t.Error("the engine did not start thinking on the human's turn")
+	}
+	return chess.GenerateLegalMoves(&p)[0]
+}
+
+// stoppedEngine checks that pondering has stopped by the time the engine is asked for a move.
+type stoppedEngine struct {
+	pondering
+	t *testing.T
+}
+
+func (e stoppedEngine) GetMove(p chess.Position) chess.Move {
+	if e.thinking.Load() {
+		e.t.Error("the engine is still thinking on the human's time after the human moved")
+	}
+	return e.pondering.GetMove(p)
+}
+
+func TestEngineThinksOnHumansTurn(t *testing.T) {
+	engine := pondering{thinking: &atomic.Bool{}, started: make(chan struct{}, 1)}
+	players := [2]ChessAgent{stoppedEngine{engine, t}, waitingHuman{t, engine}}
+	startTime := time.Now()
+	if _, err := runGame(chess.NewGame(), players, io.Discard, true, 5); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("game of 5 instant moves took %s", elapsed)
+	}
+	if engine.thinking.Load() {
+		t.Error("the engine is still thinking after the game")
+	}
+}
+
+func TestHumanHintSearchesUntilMove(t *testing.T) {
+	hint := pondering{thinking: &atomic.Bool{}, started: make(chan struct{}, 1)}
+	input, script := io.Pipe()
+	var out strings.Builder
+	human := Human{scanner: bufio.NewScanner(input), out: &out, hint: hint}
+	go func() {
+		select {
+		case <-hint.started:
+		case <-time.After(time.Second):
+			t.Error("the hint search did not start on the human's turn")
+		}
+		io.WriteString(script, "hint\ne2e4\n")
+	}()
+	p := *chess.NewGame().Position()
+	startTime := time.Now()
+	if move := human.GetMove(p); !strings.EqualFold(move.String(), "e2e4") {
+		t.Errorf("after asking for a hint the human played %s, want e2e4", move)
+	}
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("the human's move took %s to return with the hint search running", elapsed)
+	}
+	if hint.thinking.Load() {
+		t.Error("the hint search is still running after the human moved")
+	}
+	if want := "Hint: " + pgn.San(hint.Predict(p), &p); !strings.Contains(out.String(), want) {
+		t.Errorf("output %q does not show the hint %q", out.String(), want)
+	}
+}
+
+func TestHumanHintFromAlphaBeta(t *testing.T) {
+	hint := alphabeta.AlphaBeta{Table: &alphabeta.Table{}}
+	input, script := io.Pipe()
+	var out strings.Builder
+	human := Human{scanner: bufio.NewScanner(input), out: &out, hint: hint}
+	p := *chess.NewGame().Position()
+	go func() {
+		// Ask for the hint once the search has found a move, while it carries on deeper.
+		deadline := time.Now().Add(time.Second)
+		for hint.Predict(p) == (chess.Move{}) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		io.WriteString(script, "hint\ne2e4\n")
+	}()
+	startTime := time.Now()
+	human.GetMove(p)
+	if elapsed := time.Since(startTime); elapsed > 2*time.Second {
+		t.Errorf("the human's move took %s to return with the hint search running", elapsed)
+	}
+	if !strings.Contains(out.String(), "Hint: ") {
+		t.Errorf("output %q shows no hint", out.String())
+	}
+}
+
+func TestHumanReadsUCIAndSAN(t *testing.T) {
+	for _, tc := range []struct {
+		fen, input, want string // want is "" for input that names no legal move
+	}{
+		{chess.DefaultFen, "e2e4", "e2e4"},
+		{chess.DefaultFen, "Nf3", "g1f3"},
+		{chess.DefaultFen, "e5", ""},
+		{chess.DefaultFen, "Ke2", ""},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0-0", "e1c1"},
+		{"4k3/8/8/8/8/5N2/8/1N2K3 w - - 0 1", "Nbd2", "b1d2"},
+		{"4k3/8/8/8/8/5N2/8/1N2K3 w - - 0 1", "Nfd2", "f3d2"},
+		{"4k3/8/8/8/8/5N2/8/1N2K3 w - - 0 1", "Nd2", ""},
+		{"4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "exd5", "e4d5"},
+		{"k7/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8=Q", "e7e8q"},
+		{"k7/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8N", "e7e8n"},
+	} {
+		p, err := chess.ParseFen(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		move, ok := parseHumanMove(tc.input, p, chess.GenerateLegalMoves(p))
+		switch {
+		case tc.want == "" && ok:
+			t.Errorf("%q from %s gave %s, want it rejected", tc.input, tc.fen, move)
+		case tc.want != "" && (!ok || !strings.EqualFold(move.String(), tc.want)):
+			t.Errorf("%q from %s gave %s, %v, want %s", tc.input, tc.fen, move, ok, tc.want)
+		}
+	}
+
+	// An invalid move is skipped, and the next line read instead.
+	human := NewHuman(strings.NewReader("e5\ne4\n"))
+	if move := human.GetMove(*chess.NewGame().Position()); !strings.EqualFold(move.String(), "e2e4") {
+		t.Errorf("after an invalid move the human played %s, want e2e4", move)
+	}
+}
+
+func TestPlayScriptedGame(t *testing.T) {
+	// Both humans read from one script, so each takes its moves in turn.
+	human := NewHuman(strings.NewReader("f3\ne5\ng2g4\nQh4\n"))
+	game, moves, err := play(playConfig{agents: [2]ChessAgent{human, human}}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var played []string
+	for _, move := range moves {
+		played = append(played, move.Move.String())
+	}
+	if want := []string{"F2F3", "E7E5", "G2G4", "D8H4"}; !slices.Equal(played, want) {
+		t.Errorf("played %v, want fool's mate %v", played, want)
+	}
+	if game.GetResult() != chess.BlackWins {
+		t.Errorf("game ended %v, want black to win", game.GetResult())
+	}
+}
+
+func TestPlayedGameWritesPGN(t *testing.T) {
+	human := NewHuman(strings.NewReader("f3\ne5\ng2g4\nQh4\n"))
+	game, moves, err := play(playConfig{agents: [2]ChessAgent{human, human}}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := matchGame{names: [2]string{"human", "human"}, opening: *chess.NewGame().Position(), moves: moves,
+		result: game.GetResult()}
+	var b strings.Builder
+	record.write(&b, "applechess game", 1)
+	tags, movetext, ok := strings.Cut(b.String(), "\n\n")
+	if !ok {
+		t.Fatalf("no movetext after the tags in %q", b.String())
+	}
+	var names []string
+	for _, line := range strings.Split(tags, "\n") {
+		name, _, _ := strings.Cut(strings.TrimPrefix(line, "["), " ")
+		names = append(names, name)
+	}
+	if want := []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}; !slices.Equal(names, want) {
+		t.Errorf("tags are %v, want the Seven Tag Roster %v", names, want)
+	}
+	if !strings.Contains(tags, `[Result "0-1"]`) {
+		t.Errorf("tags %q do not give black the win", tags)
+	}
+	if want := "1. f3 e5 2. g4 Qh4# 0-1"; strings.TrimSpace(movetext) != want {
+		t.Errorf("movetext is %q, want %q", movetext, want)
+	}
+}
+
+func TestPlayIsDeterministicWithSeededAgents(t *testing.T) {
+	playOnce := func() (chess.Result, []chess.Move) {
+		var agents [2]ChessAgent
+		for i, spec := range []string{"mcts:sequential=true,iterations=50,seed=7", "ab:depth=1"} {
+			agent, err := parseAgentSpec(spec, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			agents[i] = agent
+		}
+		game, moves, err := play(playConfig{agents: agents}, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var played []chess.Move
+		for _, move := range moves {
+			played = append(played, move.Move)
+		}
+		return game.GetResult(), played
+	}
+	result, moves := playOnce()
+	if result == chess.NoResult {
+		t.Fatalf("game of %d moves ended with no result", len(moves))
+	}
+	again, movesAgain := playOnce()
+	if again != result || !slices.Equal(moves, movesAgain) {
+		t.Errorf("replaying the game gave result %v after %d moves, want %v after the same %d moves", again,
+			len(movesAgain), result, len(moves))
+	}
+}
@@ -1,124 +1,472 @@
 package mcts
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"log/slog"
 	"math"
 	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/eval"
 	"github.com/brighamskarda/chess"
 )
 
 const c = math.Sqrt2
 const iterationsBetweenTimeChecks = 100
 const randomRolloutLength = 20
+const minIterationsBeforeConfidenceStop = 1000
+const confidenceCheckInterval = 10 * time.Millisecond
+
+// untimedDuration is a Duration, in seconds, so long that only the context of a search ends it, as for Ponder and
+// MaxTime.
+const untimedDuration = math.MaxInt32
 
 // Mcts (Monte Carlo Tree Search) agent for chess
 type Mcts struct {
-	Duration int   // Seconds to perform search
-	n        int64 // Initialize to 0.
+	Duration       int           // Seconds to perform search
+	MaxTime        time.Duration // If set, search for this long instead of Duration, which is whole seconds
+	ConfidenceStop float64       // Return early once a root move has this share of all visits. 0 disables.
+	Sequential     bool          // Search on the calling goroutine only, useful for profiling
+	StrictMoves    bool          // Panic if the chosen move is not legal, to catch move encoding bugs
+
+	// Workers is how many goroutines search the subtree of each root move together, which keeps more processors busy
+	// when there are few root moves. A virtual loss on the nodes each is visiting steers the others elsewhere. 0 means 1,
+	// and Sequential search ignores it.
+	Workers int
+
+	// MinVisits is how many times every root move is visited before the search may favour any of them. Sequential
+	// search visits them in turn first, and ConfidenceStop waits for it. A warning is logged if time runs out first.
+	MinVisits int64
+
+	// Iterations, if set, stops the search after this many simulations instead of after Duration. Concurrent search
+	// shares them evenly between the root moves.
+	Iterations int64
+	// Seed seeds the random number generators of the search, one per goroutine, so that a Sequential search limited by
+	// Iterations always chooses the same move from the same position. 0 seeds them randomly.
+	Seed uint64
+
+	// RolloutEval scores the position a rollout ends in from white's perspective, in pawns. Rollouts ending 8 or more
+	// pawns ahead count as wins. nil counts material, valued by Weights. It is called concurrently unless Sequential is
+	// set.
+	RolloutEval func(p *chess.Position) float64
+	// PriorEval scores the children of a node as it is expanded, from white's perspective, and they are tried best first
+	// for the side to move, so that a full evaluation can guide the search while rollouts use a cheaper one. nil uses
+	// eval.Evaluate with Weights. It is called concurrently unless Sequential is set.
+	PriorEval func(p *chess.Position) float64
+	// Rollout plays out newly expanded nodes. nil uses RandomRollout with RolloutEval and Weights.
+	Rollout RolloutPolicy
+	Weights *eval.Weights // Weights for the default rollout and PriorEval. nil uses eval.DefaultWeights.
+	// Tree, if not nil, keeps the subtree of each chosen move so the next search can carry on from the opponent's reply
+	// instead of starting over, and holds what Ponder finds. Give each player of a game its own Tree.
+	Tree *Tree
+	// Tablebase, if not nil, is probed before searching, and its move is played without a search when it has the
+	// position.
+	Tablebase agent.TablebaseProber
+
+	n *atomic.Int64 // Simulations of the current search, shared by all of its goroutines as the total N of UCB
 }
 
+// node statistics are updated atomically, so that the Workers sharing a subtree can search it together.
 type node struct {
-	w        float64
-	n        int64
-	mov      chess.Move // The move that resulted in pos
+	w        atomic.Uint64 // Total reward for the side that played mov, as math.Float64bits
+	n        atomic.Int64  // Simulations finished through the node
+	virtual  atomic.Int64  // Simulations still running through the node, each counted as a loss until it finishes
+	mov      chess.Move    // The move that resulted in pos
 	pos      *chess.Position
 	children []*node
+	expanded sync.Once
 }
 
-func makeParentNode(p chess.Position) *node {
-	legalMoves := chess.GenerateLegalMoves(&p)
-	parentNode := &node{
-		w:        0,
-		n:        0,
-		mov:      chess.Move{},
-		pos:      &p,
-		children: make([]*node, 0, len(legalMoves)),
+// wins returns the total reward of the simulations finished through n.
+func (n *node) wins() float64 {
+	return math.Float64frombits(n.w.Load())
+}
+
+// record adds a finished simulation with result to the statistics of n.
+func (n *node) record(result float64) {
+	for {
+		old := n.w.Load()
+		if n.w.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+result)) {
+			break
+		}
 	}
+	n.n.Add(1)
+}
 
-	for _, move := range legalMoves {
-		newPos := p
-		p.Move(move)
-		parentNode.children = append(parentNode.children, &node{
-			w:        0,
-			n:        0,
-			mov:      move,
-			pos:      &newPos,
-			children: make([]*node, 0),
-		})
+// expand gives n a child for each legal move if it has none, ordered by prior, once however many workers reach it.
+func (n *node) expand(prior func(p *chess.Position) float64) {
+	n.expanded.Do(func() {
+		if len(n.children) == 0 {
+			fillInChildren(n, prior)
+		}
+	})
+}
+
+// Tree holds the part of a search tree that can still be reached after a move is chosen. The zero value is empty.
+type Tree struct {
+	chosen     *node // The node of the move last chosen
+	agentColor chess.Color
+}
+
+// root returns the node for p if it is a reply to the move last chosen for agentColor, whose statistics are then
+// reused, or a fresh node otherwise, with any children it is given ordered by prior.
+func (t *Tree) root(p chess.Position, agentColor chess.Color, prior func(p *chess.Position) float64) *node {
+	if reply := t.reply(p, agentColor, prior); reply != nil {
+		slog.Info("mcts reused tree", "visits", reply.n.Load())
+		return reply
+	}
+	return makeParentNode(p, prior)
+}
+
+// reply returns the node for p if it is a reply to the move last chosen for agentColor, expanding it if it has not
+// been with its children ordered by prior, or nil otherwise. Positions without legal moves have no node to search and
+// give nil too.
+func (t *Tree) reply(p chess.Position, agentColor chess.Color, prior func(p *chess.Position) float64) *node {
+	if t == nil || t.chosen == nil || t.agentColor != agentColor {
+		return nil
+	}
+	for _, child := range t.chosen.children {
+		if *child.pos != p {
+			continue
+		}
+		child.expand(prior)
+		if len(child.children) == 0 {
+			return nil
+		}
+		return child
+	}
+	return nil
+}
+
+// keep remembers the child of root that was chosen, dropping the rest of the tree.
+func (t *Tree) keep(root *node, move chess.Move, agentColor chess.Color) {
+	if t == nil {
+		return
+	}
+	t.chosen, t.agentColor = nil, agentColor
+	for _, child := range root.children {
+		if child.mov == move {
+			t.chosen = child
+		}
 	}
+}
+
+// makeParentNode returns a node for p with a child for each legal move, ordered by prior as fillInChildren orders them.
+func makeParentNode(p chess.Position, prior func(p *chess.Position) float64) *node {
+	parentNode := &node{
+		mov: chess.Move{},
+		pos: &p,
+	}
+	fillInChildren(parentNode, prior)
 	return parentNode
 }
 
 func (mcts Mcts) GetMove(p chess.Position) chess.Move {
-	defer mcts.resetN()
-	parentNode := makeParentNode(p)
-
-	returnChannels := make([]chan struct{}, 0, len(parentNode.children))
-	for i, child := range parentNode.children {
-		returnChannels = append(returnChannels, make(chan struct{}))
-		go concurrentIterate(Mcts{Duration: mcts.Duration}, child, p.Turn, returnChannels[i])
+	move, err := mcts.GetMoveContext(context.Background(), p)
+	if err != nil {
+		slog.Error("agent could not move", "err", err)
 	}
+	return move
+}
 
-	for _, ch := range returnChannels {
-		<-ch
+// GetMoveContext is GetMove, but stops searching once ctx is done and returns the best move found so far. It returns an
+// *agent.AgentError if p is invalid, the search fails, or ctx is done before any simulation was run.
+func (mcts Mcts) GetMoveContext(ctx context.Context, p chess.Position) (chess.Move, error) {
+	if err := agent.CheckPosition("mcts", &p); err != nil {
+		return chess.Move{}, err
+	}
+	if move, ok := agent.TablebaseMove(mcts.Tablebase, p); ok {
+		return move, nil
+	}
+	searchCtx := ctx
+	if mcts.MaxTime > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(ctx, mcts.MaxTime)
+		defer cancel()
+		mcts.Duration = untimedDuration
+	}
+	var parentNode *node
+	err := agent.RunSearch("mcts", &p, func() {
+		parentNode = mcts.Tree.root(p, p.Turn, mcts.priorEval())
+		mcts.search(searchCtx, parentNode, p.Turn)
+	})
+	if err != nil {
+		return chess.Move{}, err
 	}
 
 	var totalIterations int64
 	for _, child := range parentNode.children {
-		totalIterations += child.n
+		totalIterations += child.n.Load()
+	}
+	if totalIterations == 0 && ctx.Err() != nil {
+		return chess.Move{}, &agent.AgentError{Kind: agent.Cancelled, Agent: "mcts", Fen: chess.GenerateFen(&p),
+			Err: ctx.Err()}
 	}
 
 	slog.Info("Performed " + fmt.Sprint(totalIterations) + " iterations of mcts")
-	return bestMove(parentNode)
+	if short := underVisited(parentNode, mcts.MinVisits); short > 0 {
+		slog.Warn("mcts ran out of time before reaching MinVisits", "min-visits", mcts.MinVisits, "moves-short", short,
+			"moves", len(parentNode.children))
+	}
+	move := bestMove(parentNode)
+	mcts.Tree.keep(parentNode, move, p.Turn)
+	if mcts.StrictMoves {
+		agent.CheckMove(&p, move)
+	}
+	return move, nil
 }
 
-func concurrentIterate(mcts Mcts, n *node, agentColor chess.Color, signalDone chan struct{}) {
-	startTime := time.Now()
-	for time.Now().Sub(startTime).Milliseconds() < int64(mcts.Duration)*1000 {
-		for i := 0; i < iterationsBetweenTimeChecks; i++ {
-			n.w += mcts.iterate(n, agentColor)
-			n.n++
-			mcts.n++
+// GetMoveSource is GetMove, but also reports whether the move came from Tablebase or the search.
+func (mcts Mcts) GetMoveSource(p chess.Position) (chess.Move, agent.MoveSource) {
+	if agent.CheckPosition("mcts", &p) == nil {
+		if move, ok := agent.TablebaseMove(mcts.Tablebase, p); ok {
+			return move, agent.Tablebase
+		}
+	}
+	return mcts.GetMove(p), agent.Search
+}
+
+// Predict returns the reply to the move last chosen that the search visited most, if p is the position that move led
+// to, or the zero move otherwise.
+func (mcts Mcts) Predict(p chess.Position) chess.Move {
+	t := mcts.Tree
+	if t == nil || t.chosen == nil || *t.chosen.pos != p {
+		return chess.Move{}
+	}
+	var move chess.Move
+	var visits int64
+	for _, child := range t.chosen.children {
+		if child.n.Load() > visits {
+			move, visits = child.mov, child.n.Load()
 		}
 	}
+	return move
+}
 
-	signalDone <- struct{}{}
+// Ponder searches p, if it is a reply to the move last chosen, until ctx is done, growing Tree so that the search of p
+// carries on from it. It does nothing without a Tree or for any other p.
+func (mcts Mcts) Ponder(ctx context.Context, p chess.Position) {
+	root := mcts.Tree.reply(p, p.Turn, mcts.priorEval())
+	if root == nil {
+		return
+	}
+	mcts.Duration, mcts.Iterations, mcts.ConfidenceStop = untimedDuration, 0, 0
+	mcts.search(ctx, root, p.Turn)
+}
+
+// search searches from root until the budget runs out or ctx is done, on the calling goroutine if Sequential is set.
+// The visits root has from a reused Tree start off the total N.
+func (mcts Mcts) search(ctx context.Context, root *node, agentColor chess.Color) {
+	mcts.n = &atomic.Int64{}
+	for _, child := range root.children {
+		mcts.n.Add(child.n.Load())
+	}
+	if mcts.Sequential {
+		sequentialIterate(ctx, mcts, root, agentColor)
+	} else {
+		mcts.concurrentSearch(ctx, root, agentColor)
+	}
 }
 
-// iterate is recursive, and returns 1 for a win, 0.5 for stalemate and 0 for a loss. Used for back propagation
-func (mcts Mcts) iterate(n *node, agentColor chess.Color) float64 {
-	if chess.IsCheckMate(n.pos) && n.pos.Turn != agentColor {
-		n.n++
-		n.w++
-		return 1
+// concurrentSearch gives each root child Workers goroutines of its own for the whole search, stopping them all early if
+// ctx is done.
+func (mcts Mcts) concurrentSearch(ctx context.Context, parentNode *node, agentColor chess.Color) {
+	stop := make(chan struct{})
+	closeStop := sync.OnceFunc(func() { close(stop) })
+	if ctx.Err() != nil {
+		closeStop() // So that a search cancelled before it starts runs no simulations at all
+	}
+	// The first worker to panic stops the others, and its panic is raised again here once they have all returned.
+	var failed sync.Once
+	var failure any
+	fail := func(r any) {
+		failed.Do(func() { failure = r })
+		closeStop()
 	}
-	if chess.IsStaleMate(n.pos) || chess.IsCheckMate(n.pos) {
-		n.n++
-		return 0
+	workers := max(1, mcts.Workers)
+	visits := make([]atomic.Int64, len(parentNode.children))
+	returnChannels := make([]chan struct{}, 0, len(parentNode.children)*workers)
+	share := mcts.Iterations
+	if share > 0 {
+		share = max(1, share/int64(len(parentNode.children)*workers))
+	}
+	for i, child := range parentNode.children {
+		for worker := range workers {
+			done := make(chan struct{})
+			returnChannels = append(returnChannels, done)
+			childMcts := Mcts{Duration: mcts.Duration, Iterations: share, RolloutEval: mcts.RolloutEval,
+				PriorEval: mcts.PriorEval, Rollout: mcts.Rollout, Weights: mcts.Weights, n: mcts.n}
+			rng := mcts.newRand(uint64(i*workers + worker))
+			go concurrentIterate(childMcts, child, agentColor, rng, stop, fail, &visits[i], done)
+		}
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		for _, ch := range returnChannels {
+			<-ch
+		}
+		close(finished)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeStop()
+		case <-finished:
+		}
+	}()
+
+	if mcts.ConfidenceStop > 0 {
+		stopWhenConfident(mcts.ConfidenceStop, mcts.MinVisits, visits, closeStop, finished)
 	}
-	if len(n.children) == 0 {
-		fillInChildren(n)
+	<-finished
+	if failure != nil {
+		panic(failure)
 	}
+}
 
-	selectedNode := mcts.selectNode(n)
+// sequentialIterate runs the whole search on the calling goroutine, choosing between the root's children with UCB rather
+// than searching each one separately, once each has MinVisits. It stops early if ctx is done. ConfidenceStop is ignored.
+func sequentialIterate(ctx context.Context, mcts Mcts, root *node, agentColor chess.Color) {
+	rng := mcts.newRand(0)
+	startTime := time.Now()
+	var iterations int64
+	for round := int64(0); round < mcts.MinVisits && mcts.budgetLeft(startTime, iterations) && ctx.Err() == nil; round++ {
+		for _, child := range root.children {
+			if child.n.Load() > round || !mcts.budgetLeft(startTime, iterations) {
+				continue
+			}
+			iterations++
+			result := mcts.iterate(child, agentColor, rng)
+			child.record(reward(child, result, agentColor))
+			root.record(reward(root, result, agentColor))
+			mcts.n.Add(1)
+		}
+	}
+	for mcts.budgetLeft(startTime, iterations) && ctx.Err() == nil {
+		for i := 0; i < iterationsBetweenTimeChecks && mcts.iterationsLeft(iterations) && ctx.Err() == nil; i++ {
+			root.record(reward(root, mcts.iterate(root, agentColor, rng), agentColor))
+			mcts.n.Add(1)
+			iterations++
+		}
+	}
+}
+
+func concurrentIterate(mcts Mcts, n *node, agentColor chess.Color, rng *rand.Rand, stop <-chan struct{},
+	fail func(any), visits *atomic.Int64, signalDone chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			fail(r)
+		}
+		signalDone <- struct{}{}
+	}()
+	startTime := time.Now()
+	var iterations int64
+	stopped := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+	for mcts.budgetLeft(startTime, iterations) && !stopped() {
+		i := 0
+		for ; i < iterationsBetweenTimeChecks && mcts.iterationsLeft(iterations) && !stopped(); i++ {
+			n.record(reward(n, mcts.iterate(n, agentColor, rng), agentColor))
+			mcts.n.Add(1)
+			iterations++
+		}
+		visits.Add(int64(i))
+	}
+}
+
+// stopWhenConfident calls stop once a single root child holds more than threshold of the visits and every child has at
+// least minVisits, or returns when the search finishes on its own.
+func stopWhenConfident(threshold float64, minVisits int64, visits []atomic.Int64, stop func(), finished <-chan struct{}) {
+	ticker := time.NewTicker(confidenceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			var total, most int64
+			least := int64(math.MaxInt64)
+			for i := range visits {
+				v := visits[i].Load()
+				total += v
+				most = max(most, v)
+				least = min(least, v)
+			}
+			if total >= minIterationsBeforeConfidenceStop && least >= minVisits && float64(most)/float64(total) > threshold {
+				slog.Info("mcts stopped early", "visit-share", float64(most)/float64(total))
+				stop()
+				return
+			}
+		}
+	}
+}
+
+// iterate selects a path down from n to a node not yet visited or a finished game, rolls it out, and backs the result up
+// the path. Every node below n on the path gets exactly one visit, and n itself is left for the caller to update with
+// the result returned: 1 for a win for agentColor, 0.5 for stalemate and 0 for a loss. Each node records the result for
+// the side that moved into it, so that selectNode picks the best move for whichever side is to move. Until then, each
+// node on the path carries a virtual loss. The path is kept on an explicit stack rather than by recursion, so deep trees cannot overflow the
+// goroutine stack.
+func (mcts Mcts) iterate(n *node, agentColor chess.Color, rng *rand.Rand) float64 {
+	path := []*node{}
+	current := n
 	var result float64
-	if selectedNode.n == 0 {
-		result = randomRollout(*n.pos, agentColor)
-	} else {
-		result = mcts.iterate(selectedNode, agentColor)
+	for {
+		if chess.IsCheckMate(current.pos) && current.pos.Turn != agentColor {
+			result = 1
+			break
+		}
+		if chess.IsCheckMate(current.pos) {
+			result = 0
+			break
+		}
+		if chess.IsStaleMate(current.pos) {
+			result = 0.5
+			break
+		}
+		current.expand(mcts.priorEval())
+
+		selectedNode := mcts.selectNode(current)
+		selectedNode.virtual.Add(1)
+		path = append(path, selectedNode)
+		if selectedNode.n.Load() == 0 {
+			result = mcts.rolloutPolicy().Rollout(*selectedNode.pos, agentColor, rng)
+			break
+		}
+		current = selectedNode
 	}
 
-	selectedNode.n++
-	selectedNode.w += result
+	for _, visited := range path {
+		visited.record(reward(visited, result, agentColor))
+		visited.virtual.Add(-1)
+	}
+	return result
+}
+
+// reward converts result, from agentColor's point of view, to the point of view of the side that moved into n.
+func reward(n *node, result float64, agentColor chess.Color) float64 {
+	if n.pos.Turn == agentColor {
+		return 1 - result
+	}
 	return result
 }
 
 func (mcts Mcts) selectNode(n *node) *node {
 	for _, child := range n.children {
-		if child.n == 0 {
+		if child.n.Load()+child.virtual.Load() == 0 {
 			return child
 		}
 	}
@@ -135,8 +483,60 @@ func (mcts Mcts) selectNode(n *node) *node {
 	return bestChild
 }
 
-// randomRollout returns 1 if the agent wins, 0.5 for draw, 0 otherwise
-func randomRollout(p chess.Position, agentColor chess.Color) float64 {
+// RolloutPolicy estimates the result of the game from p, returning 1 if agentColor wins, 0.5 for a draw and 0 for a
+// loss. Policies are called concurrently unless Sequential is set, each goroutine with its own rng.
+type RolloutPolicy interface {
+	Rollout(p chess.Position, agentColor chess.Color, rng *rand.Rand) float64
+}
+
+// RandomRollout plays random legal moves for a fixed number of plies, then scores the position with Eval. A nil Eval
+// counts material, valued by Weights, or by eval.DefaultWeights if that is nil too.
+type RandomRollout struct {
+	Eval    func(p *chess.Position) float64
+	Weights *eval.Weights
+}
+
+func (r RandomRollout) Rollout(p chess.Position, agentColor chess.Color, rng *rand.Rand) float64 {
+	return rollout(p, agentColor, r.Eval, r.Weights, func(p *chess.Position, moves []chess.Move) chess.Move {
+		return moves[rng.IntN(len(moves))]
+	})
+}
+
+// SoftmaxRollout is RandomRollout, but biased toward moves that win material. Each move is chosen with probability
+// proportional to exp(gain/Temperature), where gain is the value in pawns of the piece it captures plus any promotion.
+// A high Temperature gives nearly uniform moves, and 0 always plays the greediest move. Pieces are valued by Weights,
+// or by eval.DefaultWeights if nil.
+type SoftmaxRollout struct {
+	Temperature float64
+	Eval        func(p *chess.Position) float64
+	Weights     *eval.Weights
+}
+
+func (r SoftmaxRollout) Rollout(p chess.Position, agentColor chess.Color, rng *rand.Rand) float64 {
+	w := r.Weights
+	if w == nil {
+		w = &eval.DefaultWeights
+	}
+	return rollout(p, agentColor, r.Eval, w, func(p *chess.Position, moves []chess.Move) chess.Move {
+		gains := make([]float64, len(moves))
+		for i, move := range moves {
+			gains[i] = materialGain(p, move, w)
+		}
+		margin, temperature := math.Inf(1), r.Temperature
+		if temperature <= 0 {
+			// Greedy, so pick uniformly among the moves tied for the largest gain.
+			margin, temperature = 0, 1
+		}
+		move, _ := agent.SampleMove(moves, gains, margin, temperature, rng)
+		return move
+	})
+}
+
+// rollout plays moves picked by choose for a fixed number of plies. It returns 1 if agentColor mates, 0 if it is mated
+// and 0.5 for stalemate, and otherwise rewards the final position as scored by positionEval, or by material valued by w
+// if nil.
+func rollout(p chess.Position, agentColor chess.Color, positionEval func(p *chess.Position) float64, w *eval.Weights,
+	choose func(p *chess.Position, moves []chess.Move) chess.Move) float64 {
 	for i := 0; i < randomRolloutLength; i++ {
 		if chess.IsCheckMate(&p) && p.Turn != agentColor {
 			return 1
@@ -144,101 +544,153 @@ func randomRollout(p chess.Position, agentColor chess.Color) float64 {
 		if chess.IsCheckMate(&p) && p.Turn == agentColor {
 			return 0
 		}
-		legalMoves := chess.GenerateLegalMoves(&p)
+		legalMoves := agent.LegalMoves(&p)
 		if len(legalMoves) == 0 {
 			return 0.5
 		}
-		move := legalMoves[rand.IntN(len(legalMoves))]
-		p.Move(move)
+		p.Move(choose(&p, legalMoves))
+	}
+	if positionEval != nil {
+		return determineReward(positionEval(&p), agentColor)
+	}
+	return determineReward(eval.Material(&p, w), agentColor)
+}
+
+// materialGain returns the value in pawns of what move captures from p, plus the gain from promoting.
+func materialGain(p *chess.Position, move chess.Move, w *eval.Weights) float64 {
+	gain := math.Abs(eval.PieceValue(p.PieceAt(move.ToSquare), w))
+	if move.Promotion != chess.NoPieceType {
+		gain += math.Abs(eval.PieceValue(chess.Piece{Color: chess.White, Type: move.Promotion}, w)) - w.Pawn
+	}
+	return gain
+}
+
+// priorEval returns PriorEval, or eval.Evaluate with Weights if it is nil.
+func (mcts Mcts) priorEval() func(p *chess.Position) float64 {
+	if mcts.PriorEval != nil {
+		return mcts.PriorEval
+	}
+	return func(p *chess.Position) float64 { return eval.Evaluate(p, mcts.Weights) }
+}
+
+func (mcts Mcts) rolloutPolicy() RolloutPolicy {
+	if mcts.Rollout != nil {
+		return mcts.Rollout
+	}
+	return RandomRollout{Eval: mcts.RolloutEval, Weights: mcts.Weights}
+}
+
+// budgetLeft reports whether a search that started at startTime and has run iterations simulations may run more: until
+// Iterations are done if set, and otherwise until Duration has passed.
+func (mcts Mcts) budgetLeft(startTime time.Time, iterations int64) bool {
+	if mcts.Iterations > 0 {
+		return iterations < mcts.Iterations
+	}
+	return time.Since(startTime).Milliseconds() < int64(mcts.Duration)*1000
+}
+
+// iterationsLeft reports whether Iterations, if set, leaves room for another simulation after iterations.
+func (mcts Mcts) iterationsLeft(iterations int64) bool {
+	return mcts.Iterations == 0 || iterations < mcts.Iterations
+}
+
+// newRand returns the generator for search goroutine stream, seeded from Seed, or randomly if Seed is 0.
+func (mcts Mcts) newRand(stream uint64) *rand.Rand {
+	if mcts.Seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
 	}
-	return determineReward(&p, agentColor)
+	return agent.NewRand(mcts.Seed + stream)
 }
 
-func determineReward(p *chess.Position, agentColor chess.Color) float64 {
+// determineReward scores a rollout that ended without mate: 1 if the agent is at least a queen ahead, 0 if it is at
+// least a queen behind, and 0.5 otherwise, bare kings included.
+func determineReward(positionValue float64, agentColor chess.Color) float64 {
 	const limitForWin = 8
-	positionValue := getPositionValue(p)
 	switch agentColor {
 	case chess.White:
-		if positionValue > limitForWin {
+		if positionValue >= limitForWin {
 			return 1
 		}
-		if positionValue < -limitForWin {
+		if positionValue <= -limitForWin {
 			return 0
 		}
 	case chess.Black:
-		if positionValue > limitForWin {
+		if positionValue >= limitForWin {
 			return 0
 		}
-		if positionValue < -limitForWin {
+		if positionValue <= -limitForWin {
 			return 1
 		}
 	}
 	return 0.5
 }
 
-func getPositionValue(p *chess.Position) float64 {
-	const pawn = 1
-	const rook = 5
-	const knight = 2.9
-	const bishop = 3
-	const queen = 8
-	const king = 10000
-
-	totalValue := 0.0
-	for _, piece := range p.Board {
-		var val float64
-		switch piece.Type {
-		case chess.Pawn:
-			val = pawn
-		case chess.Rook:
-			val = rook
-		case chess.Knight:
-			val = knight
-		case chess.Bishop:
-			val = bishop
-		case chess.Queen:
-			val = queen
-		case chess.King:
-			val = king
-		default:
-			val = 0
-		}
-		if piece.Color == chess.White {
-			totalValue += val
-		} else if piece.Color == chess.Black {
-			totalValue -= val
-		}
+// fillInChildren gives n a child for each legal move, ordered from best to worst for the side to move in n as scored by
+// prior, so that selectNode tries the most promising first. Ties keep the order moves are generated in.
+func fillInChildren(n *node, prior func(p *chess.Position) float64) {
+	type scoredChild struct {
+		child *node
+		score float64 // For the side to move in n
 	}
-	return totalValue
-}
-
-func fillInChildren(n *node) {
-	legalMoves := chess.GenerateLegalMoves(n.pos)
+	legalMoves := agent.LegalMoves(n.pos)
+	scored := make([]scoredChild, 0, len(legalMoves))
 	for _, move := range legalMoves {
 		newPos := *n.pos
 		newPos.Move(move)
 		newChild := &node{
-			w:        0,
-			n:        0,
 			mov:      move,
 			pos:      &newPos,
 			children: make([]*node, 0),
 		}
-		n.children = append(n.children, newChild)
+		score := prior(&newPos)
+		if n.pos.Turn == chess.Black {
+			score = -score
+		}
+		scored = append(scored, scoredChild{newChild, score})
+	}
+	slices.SortStableFunc(scored, func(a, b scoredChild) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	n.children = make([]*node, 0, len(scored))
+	for _, sc := range scored {
+		n.children = append(n.children, sc.child)
 	}
 }
 
 // calcUCB uses this formula https://en.wikipedia.org/wiki/Monte_Carlo_tree_search#Exploration_and_exploitation
+// Simulations still running through n count as visits that were lost. N is the total of the whole search, across all of
+// its goroutines.
 func (mcts Mcts) calcUCB(n *node) float64 {
-	return float64(n.w)/float64(n.n) + c*math.Sqrt(math.Log(float64(mcts.n))/float64(n.n))
+	visits := float64(n.n.Load() + n.virtual.Load())
+	return n.wins()/visits + c*math.Sqrt(math.Log(float64(mcts.n.Load()))/visits)
 }
 
-// bestMove is for selecting the best move only after all the iterations are complete.
+// underVisited returns how many of the children of n have fewer than minVisits visits.
+func underVisited(n *node, minVisits int64) int {
+	short := 0
+	for _, child := range n.children {
+		if child.n.Load() < minVisits {
+			short++
+		}
+	}
+	return short
+}
+
+// bestMove is for selecting the best move only after all the iterations are complete. Children that were never visited
+// have no win rate and are skipped, so the first move is returned only if none were visited.
 func bestMove(n *node) chess.Move {
 	bestMove := n.children[0].mov
 	var bestMoveScore float64 = -math.MaxFloat64
 	for _, child := range n.children {
-		score := float64(child.w) / float64(child.n)
+		visits := child.n.Load()
+		if visits == 0 {
+			continue
+		}
+		score := child.wins() / float64(visits)
+		if math.IsNaN(score) || math.IsInf(score, 0) {
+			slog.Warn("mcts win rate is not finite", "move", child.mov, "w", child.wins(), "n", visits)
+			continue
+		}
 		if score > bestMoveScore {
 			bestMoveScore = score
 			bestMove = child.mov
@@ -246,7 +698,3 @@ func bestMove(n *node) chess.Move {
 	}
 	return bestMove
 }
-
-func (mcts Mcts) resetN() {
-	mcts.n = 0
-}
@@ -0,0 +1,594 @@
+package mcts
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+func mustParseMove(t *testing.T, uci string) chess.Move {
+	t.Helper()
+	move, err := chess.ParseUCIMove(uci)
+	if err != nil {
+		t.Fatalf("could not parse move %s: %v", uci, err)
+	}
+	return move
+}
+
+// timeSlack scales how long a search may overrun the time it was given.
+var timeSlack time.Duration = 1
+
+func TestSequentialVisitsSumToIterations(t *testing.T) {
+	const iterations = 500
+	m := Mcts{Sequential: true, Iterations: iterations, Seed: 1}
+	root := makeParentNode(*chess.NewGame().Position(), m.priorEval())
+	m.search(context.Background(), root, chess.White)
+
+	var visits int64
+	for _, child := range root.children {
+		visits += child.n.Load()
+	}
+	if visits != iterations {
+		t.Errorf("root children have %d visits, want %d", visits, iterations)
+	}
+	if root.n.Load() != iterations {
+		t.Errorf("root has %d visits, want %d", root.n.Load(), iterations)
+	}
+}
+
+func TestSequentialMatchesSingleWorkerCounts(t *testing.T) {
+	// 20 root moves, each given an even share of the simulations by the concurrent search.
+	const iterations, share = 400, 20
+	p := *chess.NewGame().Position()
+	counts := func(m Mcts) []int64 {
+		root := makeParentNode(p, m.priorEval())
+		m.search(context.Background(), root, chess.White)
+		var visits []int64
+		for _, child := range root.children {
+			visits = append(visits, child.n.Load())
+		}
+		return visits
+	}
+	sum := func(visits []int64) (total int64) {
+		for _, v := range visits {
+			total += v
+		}
+		return total
+	}
+
+	sequential := counts(Mcts{Sequential: true, Iterations: iterations, MinVisits: share, Seed: 1})
+	concurrent := counts(Mcts{Workers: 1, Iterations: iterations, Seed: 1})
+	if sum(sequential) != iterations || sum(concurrent) != iterations {
+		t.Errorf("root children have %d visits sequentially and %d with one worker each, want %d for both",
+			sum(sequential), sum(concurrent), iterations)
+	}
+	for i := range concurrent {
+		if sequential[i] < share || concurrent[i] != share {
+			t.Errorf("root move %d has %d visits sequentially and %d with one worker, want at least %d and exactly %d",
+				i, sequential[i], concurrent[i], share, share)
+		}
+	}
+	again := counts(Mcts{Sequential: true, Iterations: iterations, MinVisits: share, Seed: 1})
+	if !slices.Equal(again, sequential) {
+		t.Errorf("sequential search with the same seed gave visits %v, then %v", sequential, again)
+	}
+}
+
+func TestRootChildrenHoldPositionAfterTheirMove(t *testing.T) {
+	start := mustParseFen(t, "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	root := makeParentNode(start, Mcts{}.priorEval())
+	if len(root.children) != len(chess.GenerateLegalMoves(&start)) {
+		t.Fatalf("root has %d children, want one for each of the %d legal moves", len(root.children),
+			len(chess.GenerateLegalMoves(&start)))
+	}
+	for _, child := range root.children {
+		want := start
+		want.Move(child.mov)
+		if got := chess.GenerateFen(child.pos); got != chess.GenerateFen(&want) {
+			t.Errorf("child for %s holds %s, want %s", child.mov, got, chess.GenerateFen(&want))
+		}
+	}
+	if got := chess.GenerateFen(root.pos); got != chess.GenerateFen(&start) {
+		t.Errorf("root holds %s after its children were made, want the unchanged %s", got, chess.GenerateFen(&start))
+	}
+}
+
+func TestMinVisitsCoversEveryRootMove(t *testing.T) {
+	// The 20 root moves need 100 iterations to get 5 visits each.
+	const minVisits = 5
+	p := *chess.NewGame().Position()
+	for _, tc := range []struct {
+		iterations int64
+		least      int64 // Visits every root move gets
+		short      int
+	}{{150, minVisits, 0}, {100, minVisits, 0}, {50, 2, 20}} {
+		m := Mcts{Sequential: true, Iterations: tc.iterations, MinVisits: minVisits, Seed: 1}
+		root := makeParentNode(p, m.priorEval())
+		m.search(context.Background(), root, chess.White)
+		for _, child := range root.children {
+			if child.n.Load() < tc.least {
+				t.Errorf("with %d iterations %s has %d visits, want at least %d", tc.iterations, child.mov,
+					child.n.Load(), tc.least)
+			}
+		}
+		// Running out before MinVisits is reported rather than spending the budget on a few moves.
+		if short := underVisited(root, minVisits); short != tc.short {
+			t.Errorf("with %d iterations %d root moves have fewer than %d visits, want %d", tc.iterations, short,
+				minVisits, tc.short)
+		}
+	}
+}
+
+func TestTreeReusedAfterOpponentReply(t *testing.T) {
+	const iterations = 400
+	tree := &Tree{}
+	m := Mcts{Sequential: true, Iterations: iterations, Seed: 1, Tree: tree}
+	p := *chess.NewGame().Position()
+	chosen := m.GetMove(p)
+	p.Move(chosen)
+	reply := m.Predict(p)
+	if reply == (chess.Move{}) {
+		t.Fatal("no reply was predicted after the first search")
+	}
+	p.Move(reply)
+
+	sum := func(n *node) (visits int64) {
+		for _, child := range n.children {
+			visits += child.n.Load()
+		}
+		return visits
+	}
+	reused := tree.reply(p, chess.White, m.priorEval())
+	if reused == nil || sum(reused) == 0 {
+		t.Fatalf("the position after the predicted reply %s is not in the tree with visits", reply)
+	}
+
+	// A position after a move other than the one chosen is not in the tree, and starts afresh.
+	other := *chess.NewGame().Position()
+	for _, move := range chess.GenerateLegalMoves(&other) {
+		if move != chosen {
+			other.Move(move)
+			break
+		}
+	}
+	other.Move(chess.GenerateLegalMoves(&other)[0])
+	if tree.reply(other, chess.White, m.priorEval()) != nil {
+		t.Errorf("a position outside the tree was found in it")
+	}
+	if root := tree.root(other, chess.White, m.priorEval()); root.n.Load() != 0 || sum(root) != 0 {
+		t.Errorf("a position outside the tree got a root with %d visits, want a fresh one", sum(root))
+	}
+
+	carried := sum(reused)
+	m.GetMove(p)
+	if got := sum(reused); got != carried+iterations {
+		t.Errorf("the reused root's children have %d visits, want the %d carried over and %d more", got, carried,
+			iterations)
+	}
+}
+
+func TestPonderGrowsTreeForPredictedReply(t *testing.T) {
+	tree := &Tree{}
+	m := Mcts{Sequential: true, Iterations: 200, Seed: 1, Tree: tree}
+	p := *chess.NewGame().Position()
+	p.Move(m.GetMove(p))
+	p.Move(m.Predict(p))
+	root := tree.reply(p, chess.White, m.priorEval())
+	if root == nil {
+		t.Fatal("the position after the predicted reply is not in the tree")
+	}
+	visits := func() (total int64) {
+		for _, child := range root.children {
+			total += child.n.Load()
+		}
+		return total
+	}
+	before := visits()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m.Ponder(ctx, p)
+	if after := visits(); after <= before {
+		t.Errorf("pondering left the predicted position with %d visits, want more than %d", after, before)
+	}
+}
+
+func TestOpponentChoosesItsBestReply(t *testing.T) {
+	// Black to move mates with Ra1#, and white is the agent searching.
+	p := mustParseFen(t, "r5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1")
+	m := Mcts{Sequential: true, Iterations: 2000, Seed: 1}
+	root := makeParentNode(p, m.priorEval())
+	m.search(context.Background(), root, chess.White)
+
+	mate := mustParseMove(t, "a8a1")
+	var mostVisited *node
+	for _, child := range root.children {
+		if mostVisited == nil || child.n.Load() > mostVisited.n.Load() {
+			mostVisited = child
+		}
+	}
+	if mostVisited.mov != mate {
+		t.Errorf("black's most visited reply is %s with %d visits, want the mate %s", mostVisited.mov,
+			mostVisited.n.Load(), mate)
+	}
+}
+
+func TestMaxTimeEndsSearch(t *testing.T) {
+	for _, sequential := range []bool{false, true} {
+		m := Mcts{Duration: 10, MaxTime: 200 * time.Millisecond, Sequential: sequential}
+		startTime := time.Now()
+		move := m.GetMove(*chess.NewGame().Position())
+		if elapsed := time.Since(startTime); elapsed < m.MaxTime || elapsed > m.MaxTime+timeSlack*500*time.Millisecond {
+			t.Errorf("search with MaxTime %s and Sequential %v took %s", m.MaxTime, sequential, elapsed)
+		}
+		if move == (chess.Move{}) {
+			t.Errorf("no move found with Sequential %v", sequential)
+		}
+	}
+}
+
+func TestCancelledSearchJoinsWorkers(t *testing.T) {
+	for _, sequential := range []bool{false, true} {
+		m := Mcts{Duration: untimedDuration, Workers: 2, Sequential: sequential, Seed: 1}
+		p := *chess.NewGame().Position()
+		root := makeParentNode(p, m.priorEval())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		m.search(ctx, root, chess.White)
+		cancel()
+
+		// Any worker still running would leave a simulation counted as virtual, or add visits after search returned.
+		visits := make([]int64, len(root.children))
+		for i, child := range root.children {
+			visits[i] = child.n.Load()
+			if running := child.virtual.Load(); running != 0 {
+				t.Errorf("with Sequential %v, %s has %d simulations still running after search returned", sequential,
+					child.mov, running)
+			}
+		}
+		bestMove(root)
+		time.Sleep(20 * time.Millisecond)
+		for i, child := range root.children {
+			if child.n.Load() != visits[i] {
+				t.Errorf("with Sequential %v, %s went from %d to %d visits after search returned", sequential,
+					child.mov, visits[i], child.n.Load())
+			}
+		}
+	}
+}
+
+func TestVirtualLossSpreadsWorkers(t *testing.T) {
+	m := Mcts{n: &atomic.Int64{}}
+	root := makeParentNode(*chess.NewGame().Position(), m.priorEval())
+	root.expand(m.priorEval())
+	root.children[0].virtual.Add(1)
+	if selected := m.selectNode(root); selected == root.children[0] {
+		t.Errorf("selected the unvisited %s another worker is already rolling out", selected.mov)
+	}
+
+	child := root.children[1]
+	child.record(1)
+	child.record(1)
+	m.n.Store(2)
+	free := m.calcUCB(child)
+	child.virtual.Add(1)
+	if lost := m.calcUCB(child); lost >= free {
+		t.Errorf("UCB is %v with a simulation running through the node and %v without, want it lower", lost, free)
+	}
+}
+
+func TestWorkersShareSubtrees(t *testing.T) {
+	// Each of the 20 root moves gets 3 workers with 10 simulations each.
+	const iterations = 600
+	m := Mcts{Workers: 3, Iterations: iterations, Seed: 1}
+	root := makeParentNode(*chess.NewGame().Position(), m.priorEval())
+	m.search(context.Background(), root, chess.White)
+
+	var visits int64
+	running := []*node{}
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n.virtual.Load() != 0 {
+			running = append(running, n)
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	for _, child := range root.children {
+		visits += child.n.Load()
+		walk(child)
+	}
+	if visits != iterations {
+		t.Errorf("root children have %d visits, want %d", visits, iterations)
+	}
+	if len(running) != 0 {
+		t.Errorf("%d nodes still hold a virtual loss after the search", len(running))
+	}
+}
+
+func TestUCBExplorationGrowsWithTotal(t *testing.T) {
+	child := &node{}
+	child.record(1)
+	child.record(0)
+	m := Mcts{n: &atomic.Int64{}}
+	previous := math.Inf(-1)
+	for _, total := range []int64{2, 10, 100, 10000} {
+		m.n.Store(total)
+		if ucb := m.calcUCB(child); ucb <= previous {
+			t.Errorf("UCB is %v with %d simulations in total, want more than the %v of fewer", ucb, total, previous)
+		} else {
+			previous = ucb
+		}
+	}
+}
+
+func TestConcurrentSearchCountsEverySimulation(t *testing.T) {
+	// Each of the 20 root moves gets 2 workers with 10 simulations each.
+	const iterations = 400
+	m := Mcts{Workers: 2, Iterations: iterations, Seed: 1, n: &atomic.Int64{}}
+	root := makeParentNode(*chess.NewGame().Position(), m.priorEval())
+	m.concurrentSearch(context.Background(), root, chess.White)
+	if total := m.n.Load(); total != iterations {
+		t.Errorf("the shared total is %d after the search, want all %d simulations", total, iterations)
+	}
+}
+
+func TestBestMoveSkipsNonFiniteWinRates(t *testing.T) {
+	root := makeParentNode(*chess.NewGame().Position(), Mcts{}.priorEval())
+	children := root.children[:5]
+	root.children = children
+	// Never visited, a reward that went NaN, an infinite reward, then two real win rates of 0.3 and 0.6.
+	for i, reward := range []float64{0, math.NaN(), math.Inf(1), 3, 6} {
+		if i > 0 {
+			children[i].n.Store(10)
+			children[i].w.Store(math.Float64bits(reward))
+		}
+	}
+	if move := bestMove(root); move != children[4].mov {
+		t.Errorf("bestMove chose %s, want %s, the best finite win rate", move, children[4].mov)
+	}
+
+	unvisited := makeParentNode(*chess.NewGame().Position(), Mcts{}.priorEval())
+	if move := bestMove(unvisited); move != unvisited.children[0].mov {
+		t.Errorf("with no visits bestMove chose %s, want the first move %s", move, unvisited.children[0].mov)
+	}
+}
+
+func TestRolloutAndPriorEvalsAreBothUsed(t *testing.T) {
+	var rollouts, priors atomic.Int64
+	m := Mcts{Sequential: true, Iterations: 300, Seed: 1,
+		RolloutEval: func(p *chess.Position) float64 {
+			rollouts.Add(1)
+			return eval.Material(p, nil)
+		},
+		PriorEval: func(p *chess.Position) float64 {
+			priors.Add(1)
+			return eval.Evaluate(p, nil)
+		},
+	}
+	p := *chess.NewGame().Position()
+	m.GetMove(p)
+	if rollouts.Load() == 0 {
+		t.Error("RolloutEval was never called")
+	}
+	// Every root move is scored, and so is each reply of the root moves expanded later.
+	if priors.Load() <= int64(len(chess.GenerateLegalMoves(&p))) {
+		t.Errorf("PriorEval was called %d times, want it for the root moves and the nodes expanded below them",
+			priors.Load())
+	}
+}
+
+// alwaysWins is a RolloutPolicy that scores every rollout as a win for the agent.
+type alwaysWins struct{ calls *atomic.Int64 }
+
+func (a alwaysWins) Rollout(chess.Position, chess.Color, *rand.Rand) float64 {
+	a.calls.Add(1)
+	return 1
+}
+
+func TestCustomRolloutPolicyIsUsed(t *testing.T) {
+	policy := alwaysWins{&atomic.Int64{}}
+	m := Mcts{Sequential: true, Iterations: 100, Seed: 1, Rollout: policy}
+	p := *chess.NewGame().Position()
+	move := m.GetMove(p)
+	if policy.calls.Load() == 0 {
+		t.Fatal("the custom rollout policy was never called")
+	}
+	// Every move wins all of its rollouts, and the tie goes to the first move explored.
+	first := makeParentNode(p, m.priorEval()).children[0].mov
+	if move != first {
+		t.Errorf("played %s, want the first explored move %s since every move scores the same", move, first)
+	}
+}
+
+// panickingRollout is a RolloutPolicy with a bug.
+type panickingRollout struct{}
+
+func (panickingRollout) Rollout(chess.Position, chess.Color, *rand.Rand) float64 {
+	panic("rollout bug")
+}
+
+func TestGetMoveContextCategorisesFailures(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	noTurn := *chess.NewGame().Position()
+	noTurn.Turn = chess.NoColor
+	for _, sequential := range []bool{false, true} {
+		for _, tc := range []struct {
+			name    string
+			ctx     context.Context
+			p       chess.Position
+			rollout RolloutPolicy
+			kind    agent.ErrorKind
+		}{
+			{"cancelled", cancelled, *chess.NewGame().Position(), nil, agent.Cancelled},
+			{"checkmated", context.Background(), mustParseFen(t, "R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1"), nil,
+				agent.NoLegalMoves},
+			{"invalid turn", context.Background(), noTurn, nil, agent.InvalidPosition},
+			{"rollout panics", context.Background(), *chess.NewGame().Position(), panickingRollout{}, agent.Internal},
+		} {
+			m := Mcts{Iterations: 100, Sequential: sequential, Seed: 1, Rollout: tc.rollout}
+			_, err := m.GetMoveContext(tc.ctx, tc.p)
+			var agentErr *agent.AgentError
+			if !errors.As(err, &agentErr) || agentErr.Kind != tc.kind || agentErr.Agent != "mcts" {
+				t.Errorf("%s with Sequential %v: GetMoveContext returned %v, want a %s error from mcts", tc.name,
+					sequential, err, tc.kind)
+			}
+		}
+	}
+}
+
+func TestDeepTreeBacksUpWholePath(t *testing.T) {
+	// A chain of visited nodes, each with a single child, ending in one not yet visited. Every position is the same,
+	// since only the shape of the tree matters.
+	const depth = 50000
+	p := *chess.NewGame().Position()
+	root := &node{pos: &p}
+	chain := []*node{}
+	for current := root; len(chain) < depth; current = chain[len(chain)-1] {
+		child := &node{pos: &p}
+		current.children = []*node{child}
+		chain = append(chain, child)
+	}
+	for _, n := range chain[:depth-1] {
+		n.record(0)
+	}
+
+	m := Mcts{Rollout: alwaysWins{&atomic.Int64{}}}
+	m.n = &atomic.Int64{}
+	if result := m.iterate(root, chess.Black, agent.NewRand(1)); result != 1 {
+		t.Errorf("iterate returned %v, want the rollout's 1", result)
+	}
+	for i, n := range chain {
+		wantVisits := int64(2)
+		if i == depth-1 {
+			wantVisits = 1
+		}
+		if n.n.Load() != wantVisits || n.virtual.Load() != 0 || n.wins() != 1 {
+			t.Fatalf("node %d of the path has %d visits, %d running and reward %v, want %d, 0 and 1", i, n.n.Load(),
+				n.virtual.Load(), n.wins(), wantVisits)
+		}
+	}
+	if root.n.Load() != 0 {
+		t.Errorf("root has %d visits, want them left to the caller", root.n.Load())
+	}
+}
+
+func TestChildrenOrderedByPrior(t *testing.T) {
+	favourite := mustParseMove(t, "g1f3")
+	prior := func(p *chess.Position) float64 {
+		if p.PieceAt(favourite.ToSquare).Type == chess.Knight {
+			return 1
+		}
+		return 0
+	}
+	root := makeParentNode(*chess.NewGame().Position(), prior)
+	if root.children[0].mov != favourite {
+		t.Errorf("first child is %s, want %s, the only move PriorEval favours", root.children[0].mov, favourite)
+	}
+	m := Mcts{Sequential: true, Iterations: 1, Seed: 1}
+	m.search(context.Background(), root, chess.White)
+	if root.children[0].n.Load() != 1 {
+		t.Errorf("first simulation did not try the move PriorEval favours")
+	}
+}
+
+func TestConfidenceStopEndsClearSearchEarly(t *testing.T) {
+	// Ra8 mates, and its simulations end at once, so it soon holds most of the visits.
+	mate := mustParseFen(t, "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1")
+	m := Mcts{MaxTime: 5 * time.Second, ConfidenceStop: 0.5}
+	startTime := time.Now()
+	if move := m.GetMove(mate); move != mustParseMove(t, "a1a8") {
+		t.Errorf("played %s, want the mate a1a8", move)
+	}
+	if elapsed := time.Since(startTime); elapsed > timeSlack*time.Second {
+		t.Errorf("search with one mating move took %s of its %s", elapsed, m.MaxTime)
+	}
+
+	m.MaxTime = 300 * time.Millisecond
+	startTime = time.Now()
+	m.GetMove(*chess.NewGame().Position())
+	if elapsed := time.Since(startTime); elapsed < m.MaxTime-50*time.Millisecond {
+		t.Errorf("search of the balanced starting position stopped after %s of its %s", elapsed, m.MaxTime)
+	}
+}
+
+func TestBareBoardsRewardADraw(t *testing.T) {
+	kings := mustParseFen(t, "8/8/4k3/8/8/3K4/8/8 w - - 0 1")
+	for _, p := range []chess.Position{{}, kings} {
+		if value := eval.Material(&p, nil); value != 0 {
+			t.Errorf("%s has material %v, want 0", chess.GenerateFen(&p), value)
+		}
+		for _, color := range []chess.Color{chess.White, chess.Black} {
+			if reward := determineReward(eval.Material(&p, nil), color); reward != 0.5 {
+				t.Errorf("%s rewards %s %v, want the draw 0.5", chess.GenerateFen(&p), color, reward)
+			}
+		}
+	}
+	rng := agent.NewRand(1)
+	if reward := (RandomRollout{}).Rollout(kings, chess.White, rng); reward != 0.5 {
+		t.Errorf("rollout with only kings rewards %v, want 0.5", reward)
+	}
+}
+
+func TestRewardLimitIsInclusive(t *testing.T) {
+	for _, tc := range []struct {
+		value        float64
+		white, black float64
+	}{
+		{8, 1, 0},
+		{-8, 0, 1},
+		{7.99, 0.5, 0.5},
+		{-7.99, 0.5, 0.5},
+	} {
+		if got := determineReward(tc.value, chess.White); got != tc.white {
+			t.Errorf("value %v rewards white %v, want %v", tc.value, got, tc.white)
+		}
+		if got := determineReward(tc.value, chess.Black); got != tc.black {
+			t.Errorf("value %v rewards black %v, want %v", tc.value, got, tc.black)
+		}
+	}
+}
+
+func TestSoftmaxRolloutTemperature(t *testing.T) {
+	// Rxe8# takes a free queen and mates, ending the rollout as a win. It is the only capture white has.
+	p := mustParseFen(t, "4q2k/6pp/8/8/8/8/6PP/4R1K1 w - - 0 1")
+	wins := func(temperature float64) int {
+		rng := agent.NewRand(1)
+		won := 0
+		for range 200 {
+			if (SoftmaxRollout{Temperature: temperature}).Rollout(p, chess.White, rng) == 1 {
+				won++
+			}
+		}
+		return won
+	}
+	if won := wins(0.01); won != 200 {
+		t.Errorf("at temperature 0.01 %d of 200 rollouts won, want the capture played every time", won)
+	}
+	if won := wins(0); won != 200 {
+		t.Errorf("at temperature 0 %d of 200 rollouts won, want the greedy capture played every time", won)
+	}
+	// Nearly uniform, so the capture is just one of white's moves.
+	if won := wins(1000); won > 50 {
+		t.Errorf("at temperature 1000 %d of 200 rollouts won, want the capture played far less often", won)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build race
+
+package mcts
+
+// The race detector slows searches down several times, so the time they take to stop is allowed to grow with it.
+func init() {
+	timeSlack = 4
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"expvar"
+	"sync"
+)
+
+const (
+	Nodes     = "search_nodes_total" // Counter of positions visited
+	Depth     = "search_depth"       // Gauge of the depth reached by the last search
+	NPS       = "search_nps"         // Gauge of nodes per second for the last search
+	TTHitRate = "search_tt_hit_rate" // Gauge of the share of transposition table lookups that hit in the last search
+)
+
+// Sink receives search statistics from the agents. Callers adapt it to whatever metrics system they use.
+type Sink interface {
+	Add(name string, value float64) // Increments a counter
+	Set(name string, value float64) // Sets a gauge
+}
+
+var expvarMu sync.Mutex
+
+// Expvar is a Sink that publishes every metric as an [expvar.Float] of the same name.
+type Expvar struct{}
+
+func (Expvar) Add(name string, value float64) {
+	getExpvar(name).Add(value)
+}
+
+func (Expvar) Set(name string, value float64) {
+	getExpvar(name).Set(value)
+}
+
+func getExpvar(name string) *expvar.Float {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if f, ok := expvar.Get(name).(*expvar.Float); ok {
+		return f
+	}
+	return expvar.NewFloat(name)
+}
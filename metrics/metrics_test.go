@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestExpvarPublishesMetrics(t *testing.T) {
+	var sink Expvar
+	sink.Add("test_counter_total", 2)
+	sink.Add("test_counter_total", 3)
+	sink.Set("test_gauge", 7)
+	sink.Set("test_gauge", 4)
+	if got := expvar.Get("test_counter_total").String(); got != "5" {
+		t.Errorf("counter is %s, want 5", got)
+	}
+	if got := expvar.Get("test_gauge").String(); got != "4" {
+		t.Errorf("gauge is %s, want 4", got)
+	}
+}
@@ -1,38 +1,210 @@
 package minmax
 
 import (
+	"context"
+	"log/slog"
 	"math"
+	"time"
 
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/applechess.git/metrics"
+	"github.com/brighamskarda/applechess.git/zobrist"
 	"github.com/brighamskarda/chess"
 )
 
 type Minmax struct {
-	Depth int
+	Depth   int
+	Weights *eval.Weights // nil uses eval.DefaultWeights
+	Metrics metrics.Sink  // Optional, receives statistics after each search
+
+	Temperature     float64 // Softmax temperature for sampling among root moves. 0 always plays the best move.
+	SelectionMargin float64 // When sampling, only moves within this many pawns of the best are considered
+	Seed            uint64  // Seeds the random choices of sampling and dithering, which are random if 0
+	Dither          bool    // Choose among root moves tied for best at random rather than always the first
+
+	StrictMoves bool // Panic if the chosen move is not legal, to catch move encoding bugs
+
+	// History holds the positions of the game before the one searched, oldest first. A position repeating one of them,
+	// or one earlier in the line searched, scores as a draw, as do positions drawn under the fifty-move rule.
+	History []chess.Position
+
+	// Tablebase, if not nil, chooses the move instead of the search in any position it has.
+	Tablebase agent.TablebaseProber
 }
 
+// fiftyMoveLimit is the number of half-moves without a capture or pawn move after which a position scores as a draw.
+const fiftyMoveLimit = 100
+
 func (mm Minmax) GetMove(p chess.Position) chess.Move {
-	move, _ := search(p, mm.Depth)
+	move, err := mm.GetMoveContext(context.Background(), p)
+	if err != nil {
+		slog.Error("agent could not move", "err", err)
+	}
 	return move
 }
 
-func search(p chess.Position, depth int) (chess.Move, float64) {
+// GetMoveContext is GetMove, but stops searching once ctx is done and returns the best of the root moves searched in
+// full. It returns an *agent.AgentError if p is invalid, the search fails, or it was cancelled before any move was
+// searched in full.
+func (mm Minmax) GetMoveContext(ctx context.Context, p chess.Position) (chess.Move, error) {
+	if err := agent.CheckPosition("minmax", &p); err != nil {
+		return chess.Move{}, err
+	}
+	if move, ok := agent.TablebaseMove(mm.Tablebase, p); ok {
+		return move, nil
+	}
+	s := newSearcher(ctx, mm, &p)
+	startTime := time.Now()
+	var move chess.Move
+	err := agent.RunSearch("minmax", &p, func() {
+		if mm.Temperature > 0 || mm.Dither {
+			move = s.sampleRootMove(p)
+		} else {
+			move, _ = s.search(p, mm.Depth, 0)
+		}
+	})
+	if err != nil {
+		return chess.Move{}, err
+	}
+	s.report(time.Since(startTime))
+	if move == (chess.Move{}) && ctx.Err() != nil {
+		return move, &agent.AgentError{Kind: agent.Cancelled, Agent: "minmax", Fen: chess.GenerateFen(&p), Err: ctx.Err()}
+	}
+	if mm.StrictMoves {
+		agent.CheckMove(&p, move)
+	}
+	return move, nil
+}
+
+// GetMoveSource is GetMove, but also reports whether the move came from Tablebase or the search.
+func (mm Minmax) GetMoveSource(p chess.Position) (chess.Move, agent.MoveSource) {
+	if agent.CheckPosition("minmax", &p) == nil {
+		if move, ok := agent.TablebaseMove(mm.Tablebase, p); ok {
+			return move, agent.Tablebase
+		}
+	}
+	return mm.GetMove(p), agent.Search
+}
+
+type searcher struct {
+	Minmax
+	nodes   uint64
+	aborted bool // Set once ctx is done, after which search results are incomplete
+	ctx     context.Context
+	path    []uint64 // Hashes of History and of the positions from the root to the one being searched
+}
+
+// newSearcher prepares a search of root with mm that stops once ctx is done.
+func newSearcher(ctx context.Context, mm Minmax, root *chess.Position) searcher {
+	path := make([]uint64, 0, len(mm.History)+1)
+	for i := range mm.History {
+		path = append(path, zobrist.Hash(&mm.History[i]))
+	}
+	path = append(path, zobrist.Hash(root))
+	return searcher{Minmax: mm, ctx: ctx, path: path}
+}
+
+// stopped marks the search aborted once its context is done.
+func (s *searcher) stopped() bool {
+	if s.ctx.Err() != nil {
+		s.aborted = true
+	}
+	return s.aborted
+}
+
+func (s *searcher) report(elapsed time.Duration) {
+	if s.Metrics == nil {
+		return
+	}
+	s.Metrics.Add(metrics.Nodes, float64(s.nodes))
+	s.Metrics.Set(metrics.Depth, float64(s.Depth))
+	if elapsed > 0 {
+		s.Metrics.Set(metrics.NPS, float64(s.nodes)/elapsed.Seconds())
+	}
+}
+
+// sampleRootMove scores every root move and samples one according to Temperature and SelectionMargin, or among the
+// tied best moves when only Dither is set.
+func (s *searcher) sampleRootMove(p chess.Position) chess.Move {
+	moves := agent.LegalMoves(&p)
+	scores := make([]float64, len(moves))
+	for i, move := range moves {
+		scores[i] = s.scoreMove(p, move, s.Depth, 0)
+		if s.aborted {
+			// Cancelled, so sample among the moves scored in full.
+			moves, scores = moves[:i], scores[:i]
+			break
+		}
+		if p.Turn == chess.Black {
+			scores[i] = -scores[i]
+		}
+	}
+	margin, temperature := s.SelectionMargin, s.Temperature
+	if temperature == 0 {
+		// Dither alone, so pick uniformly among the moves tied for best.
+		margin, temperature = 0, 1
+	}
+	move, _ := agent.SampleMove(moves, scores, margin, temperature, agent.MoveRand(s.Seed, &p))
+	return move
+}
+
+// scoreMove returns the score of the position reached by playing move from p, when p is searched to depth.
+func (s *searcher) scoreMove(p chess.Position, move chess.Move, depth int, ply int) float64 {
+	p.Move(move)
+	s.nodes++
+	if chess.IsCheckMate(&p) {
+		return eval.MatedScore(&p, ply+1)
+	}
+	if chess.IsStaleMate(&p) {
+		return 0
+	}
+	if depth == 0 {
+		return s.evaluateLeaf(&p)
+	}
+	_, score := s.search(p, depth-1, ply+1)
+	return score
+}
+
+func (s *searcher) search(p chess.Position, depth int, ply int) (chess.Move, float64) {
+	if ply > 0 {
+		key := zobrist.Hash(&p)
+		if s.drawn(&p, key) {
+			return chess.Move{}, 0
+		}
+		s.path = append(s.path, key)
+		defer func() { s.path = s.path[:len(s.path)-1] }()
+	}
 	if p.Turn == chess.White {
-		return max(&p, depth)
+		return s.max(&p, depth, ply)
 	}
 	if p.Turn == chess.Black {
-		return min(&p, depth)
+		return s.min(&p, depth, ply)
 	}
 	return chess.Move{}, 0
 }
 
-func min(p *chess.Position, depth int) (chess.Move, float64) {
+func (s *searcher) min(p *chess.Position, depth int, ply int) (chess.Move, float64) {
 	if depth == 0 {
 		lowestScore := math.MaxFloat64
 		bestMove := chess.Move{}
-		for _, move := range chess.GenerateLegalMoves(p) {
+		mateFound := false // Once a move mates, only other mates need looking at
+		for _, move := range agent.LegalMoves(p) {
 			newPos := *p
 			newPos.Move(move)
-			score := evaluate(&newPos)
+			s.nodes++
+			if s.stopped() {
+				break
+			}
+			var score float64
+			if chess.IsCheckMate(&newPos) {
+				score = eval.MatedScore(&newPos, ply+1)
+				mateFound = true
+			} else if mateFound {
+				continue
+			} else {
+				score = s.evaluateLeaf(&newPos)
+			}
 			if score < lowestScore {
 				lowestScore = score
 				bestMove = move
@@ -42,33 +214,55 @@ func min(p *chess.Position, depth int) (chess.Move, float64) {
 	}
 	lowestScore := math.MaxFloat64
 	bestMove := chess.Move{}
-	for _, move := range chess.GenerateLegalMoves(p) {
+	mateFound := false
+	for _, move := range agent.LegalMoves(p) {
 		newPos := *p
 		newPos.Move(move)
+		s.nodes++
+		if s.stopped() {
+			break
+		}
+		score := 0.0
 		if chess.IsCheckMate(&newPos) {
-			return move, -math.MaxFloat64
-		} else if chess.IsStaleMate(&newPos) && lowestScore > 0 {
-			lowestScore = 0
+			score = eval.MatedScore(&newPos, ply+1)
+			mateFound = true
+		} else if mateFound {
+			continue
+		} else if !chess.IsStaleMate(&newPos) {
+			_, score = s.search(newPos, depth-1, ply+1)
+		}
+		if s.aborted {
+			break
+		}
+		if score < lowestScore {
+			lowestScore = score
 			bestMove = move
-		} else {
-			_, score := search(newPos, depth-1)
-			if score < lowestScore {
-				lowestScore = score
-				bestMove = move
-			}
 		}
 	}
 	return bestMove, lowestScore
 }
 
-func max(p *chess.Position, depth int) (chess.Move, float64) {
+func (s *searcher) max(p *chess.Position, depth int, ply int) (chess.Move, float64) {
 	if depth == 0 {
 		highestScore := -math.MaxFloat64
 		bestMove := chess.Move{}
-		for _, move := range chess.GenerateLegalMoves(p) {
+		mateFound := false
+		for _, move := range agent.LegalMoves(p) {
 			newPos := *p
 			newPos.Move(move)
-			score := evaluate(&newPos)
+			s.nodes++
+			if s.stopped() {
+				break
+			}
+			var score float64
+			if chess.IsCheckMate(&newPos) {
+				score = eval.MatedScore(&newPos, ply+1)
+				mateFound = true
+			} else if mateFound {
+				continue
+			} else {
+				score = s.evaluateLeaf(&newPos)
+			}
 			if score > highestScore {
 				highestScore = score
 				bestMove = move
@@ -78,103 +272,48 @@ func max(p *chess.Position, depth int) (chess.Move, float64) {
 	}
 	highestScore := -math.MaxFloat64
 	bestMove := chess.Move{}
-	for _, move := range chess.GenerateLegalMoves(p) {
+	mateFound := false
+	for _, move := range agent.LegalMoves(p) {
 		newPos := *p
 		newPos.Move(move)
+		s.nodes++
+		if s.stopped() {
+			break
+		}
+		score := 0.0
 		if chess.IsCheckMate(&newPos) {
-			return move, math.MaxFloat64
-		} else if chess.IsStaleMate(&newPos) && highestScore < 0 {
-			highestScore = 0
+			score = eval.MatedScore(&newPos, ply+1)
+			mateFound = true
+		} else if mateFound {
+			continue
+		} else if !chess.IsStaleMate(&newPos) {
+			_, score = s.search(newPos, depth-1, ply+1)
+		}
+		if s.aborted {
+			break
+		}
+		if score > highestScore {
+			highestScore = score
 			bestMove = move
-		} else {
-			_, score := search(newPos, depth-1)
-			if score > highestScore {
-				highestScore = score
-				bestMove = move
-			}
 		}
 	}
 	return bestMove, highestScore
 }
 
-func evaluate(p *chess.Position) float64 {
-	total := sumMaterial(p)
-	total += float64(numPseudoLegalChecks(p)) * 0.2
-	return total
-}
-
-func sumMaterial(p *chess.Position) float64 {
-	totalValue := 0.0
-	for _, piece := range p.Board {
-		totalValue += getPieceValue(piece)
-	}
-	return totalValue
-}
-
-func getPieceValue(p chess.Piece) float64 {
-	const pawn = 1
-	const rook = 5
-	const knight = 2.9
-	const bishop = 3
-	const queen = 8
-	const king = 10000
-
-	var val float64
-	switch p.Type {
-	case chess.Pawn:
-		val = pawn
-	case chess.Rook:
-		val = rook
-	case chess.Knight:
-		val = knight
-	case chess.Bishop:
-		val = bishop
-	case chess.Queen:
-		val = queen
-	case chess.King:
-		val = king
-	default:
-		val = 0
-	}
-	if p.Color == chess.White {
-		return val
-	} else {
-		return -val
+// evaluateLeaf statically scores a position at the search horizon. Stalemate is only looked for when the side to move
+// has few pieces left, since it is rare otherwise and finding it means generating the leaf's legal moves. Positions
+// drawn by repetition or the fifty-move rule score 0.
+func (s *searcher) evaluateLeaf(p *chess.Position) float64 {
+	if eval.PieceCount(p, p.Turn) <= eval.StaleMatePieces && chess.IsStaleMate(p) {
+		return 0
 	}
-}
-
-func numPseudoLegalChecks(p *chess.Position) int {
-	origTurn := p.Turn
-
-	total := 0
-	p.Turn = chess.White
-	blackKing := findKing(p, chess.Black)
-	pLegalMoves := chess.GeneratePseudoLegalMoves(p)
-	for _, move := range pLegalMoves {
-		if move.ToSquare == blackKing {
-			total++
-		}
-	}
-
-	p.Turn = chess.Black
-	whiteKing := findKing(p, chess.White)
-	pLegalMoves = chess.GeneratePseudoLegalMoves(p)
-	for _, move := range pLegalMoves {
-		if move.ToSquare == whiteKing {
-			total--
-		}
+	if s.drawn(p, zobrist.Hash(p)) {
+		return 0
 	}
-
-	p.Turn = origTurn
-	return total
+	return eval.Evaluate(p, s.Weights)
 }
 
-func findKing(p *chess.Position, c chess.Color) chess.Square {
-	for _, square := range chess.AllSquares {
-		piece := p.PieceAt(square)
-		if piece.Type == chess.King && piece.Color == c {
-			return square
-		}
-	}
-	return chess.NoSquare
+// drawn reports whether p, hashing to key, is a draw by the fifty-move rule or repeats a position in s.path.
+func (s *searcher) drawn(p *chess.Position, key uint64) bool {
+	return p.HalfMove >= fiftyMoveLimit || zobrist.Repeated(s.path, key, p.HalfMove)
 }
@@ -0,0 +1,234 @@
+package minmax
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/applechess.git/tablebase"
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+func TestDitherVariesAcrossSeeds(t *testing.T) {
+	// With only kings, several king moves tie for best.
+	p := mustParseFen(t, "4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	distinct := func(mm Minmax) int {
+		moves := map[chess.Move]bool{}
+		for seed := uint64(1); seed <= 20; seed++ {
+			mm.Seed = seed
+			moves[mm.GetMove(p)] = true
+		}
+		return len(moves)
+	}
+	if n := distinct(Minmax{Depth: 1, Dither: true}); n < 2 {
+		t.Errorf("dither played %d distinct moves across 20 seeds, want several", n)
+	}
+	if n := distinct(Minmax{Depth: 1}); n != 1 {
+		t.Errorf("without dither %d distinct moves were played across 20 seeds, want 1", n)
+	}
+}
+
+func TestLosingSideFindsStalemate(t *testing.T) {
+	// Black's king has no moves, so Rh1+ Kxh1 is stalemate.
+	p := mustParseFen(t, "k7/2Q5/8/8/8/8/5PPr/6K1 b - - 0 1")
+	stalemate, err := chess.ParseUCIMove("h2h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if move := (Minmax{Depth: 2}).GetMove(p); move != stalemate {
+		t.Errorf("played %s, want the stalemating %s", move, stalemate)
+	}
+}
+
+func TestZeroWeightsScoreMaterialOnly(t *testing.T) {
+	materialOnly := eval.Weights{
+		Pawn:   eval.DefaultWeights.Pawn,
+		Knight: eval.DefaultWeights.Knight,
+		Bishop: eval.DefaultWeights.Bishop,
+		Rook:   eval.DefaultWeights.Rook,
+		Queen:  eval.DefaultWeights.Queen,
+	}
+	for _, fen := range []string{
+		chess.DefaultFen,
+		// Checks are available to both sides.
+		"r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+		"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1",
+	} {
+		p := mustParseFen(t, fen)
+		s := newSearcher(context.Background(), Minmax{Weights: &materialOnly}, &p)
+		if got, want := s.evaluateLeaf(&p), eval.Material(&p, &materialOnly); got != want {
+			t.Errorf("%s scores %v with only piece values weighted, want its material %v", fen, got, want)
+		}
+		s = newSearcher(context.Background(), Minmax{}, &p)
+		if got, want := s.evaluateLeaf(&p), eval.Evaluate(&p, nil); got != want {
+			t.Errorf("%s scores %v with the default weights, want %v", fen, got, want)
+		}
+	}
+}
+
+func TestShorterMateScoresHigher(t *testing.T) {
+	// Rb8 mates at once, and Rb7 mates next move instead.
+	p := mustParseFen(t, "7k/R7/8/8/8/8/8/1R4K1 w - - 0 1")
+	mateIn1, err := chess.ParseUCIMove("b1b8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mateIn2, err := chess.ParseUCIMove("b1b7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSearcher(context.Background(), Minmax{}, &p)
+	quick, slow := s.scoreMove(p, mateIn1, 2, 0), s.scoreMove(p, mateIn2, 2, 0)
+	if eval.MateIn(quick) != 1 || eval.MateIn(slow) != 2 || quick <= slow {
+		t.Errorf("mate in 1 scores %v and mate in 2 scores %v, want finite mate scores with the first higher", quick,
+			slow)
+	}
+	if move := (Minmax{Depth: 3}).GetMove(p); move != mateIn1 {
+		t.Errorf("played %s, want the mate in 1 %s", move, mateIn1)
+	}
+}
+
+func TestWeightsChangePlay(t *testing.T) {
+	// The rook can take the bishop or the knight, and by default the bishop is worth slightly more.
+	p := mustParseFen(t, "7k/3n4/8/8/3R2b1/8/8/4K3 w - - 0 1")
+	if move := (Minmax{Depth: 2}).GetMove(p); move.ToSquare != chess.G4 {
+		t.Errorf("with the default weights played %s, want the bishop taken", move)
+	}
+	weights := eval.DefaultWeights
+	weights.Knight = 10
+	if move := (Minmax{Depth: 2, Weights: &weights}).GetMove(p); move.ToSquare != chess.D7 {
+		t.Errorf("with knights worth 10 played %s, want the knight taken", move)
+	}
+}
+
+func TestGetMoveContextCategorisesFailures(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	noTurn := mustParseFen(t, chess.DefaultFen)
+	noTurn.Turn = chess.NoColor
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		p    chess.Position
+		kind agent.ErrorKind
+	}{
+		{"cancelled", cancelled, mustParseFen(t, chess.DefaultFen), agent.Cancelled},
+		{"stalemated", context.Background(), mustParseFen(t, "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1"), agent.NoLegalMoves},
+		{"adjacent kings", context.Background(), mustParseFen(t, "8/8/8/8/8/8/3k4/4K3 w - - 0 1"),
+			agent.InvalidPosition},
+		{"invalid turn", context.Background(), noTurn, agent.InvalidPosition},
+	} {
+		_, err := Minmax{Depth: 2}.GetMoveContext(tc.ctx, tc.p)
+		var agentErr *agent.AgentError
+		if !errors.As(err, &agentErr) || agentErr.Kind != tc.kind || agentErr.Agent != "minmax" {
+			t.Errorf("%s: GetMoveContext returned %v, want a %s error from minmax", tc.name, err, tc.kind)
+		}
+	}
+}
+
+func TestGetMoveContextStopsAtDeadline(t *testing.T) {
+	p := mustParseFen(t, chess.DefaultFen)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	move, err := Minmax{Depth: 12}.GetMoveContext(ctx, p)
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("search cancelled after 100ms took %s", elapsed)
+	}
+	// Unless a root move was searched in full before the deadline, there is no move to return.
+	var agentErr *agent.AgentError
+	if err != nil && (!errors.As(err, &agentErr) || agentErr.Kind != agent.Cancelled) {
+		t.Errorf("cancelled search returned %v, want a move or a cancelled error", err)
+	}
+	if err == nil && !slices.Contains(chess.GenerateLegalMoves(&p), move) {
+		t.Errorf("cancelled search played %s, want a legal move", move)
+	}
+}
+
+func TestPrefersMateKeepingMoreMaterial(t *testing.T) {
+	// Qg8+ Rxg8 Nf7# gives up the queen, while Re8+ Rxe8 Rxe8# trades rooks. Both mate in 2.
+	p := mustParseFen(t, "r6k/6pp/7N/8/2Q5/8/4R1PP/4R1K1 w - - 0 1")
+	sacrifice, err := chess.ParseUCIMove("c4g8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trade, err := chess.ParseUCIMove("e2e8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSearcher(context.Background(), Minmax{}, &p)
+	sacrificeScore, tradeScore := s.scoreMove(p, sacrifice, 2, 0), s.scoreMove(p, trade, 2, 0)
+	if eval.MateIn(sacrificeScore) != 2 || eval.MateIn(tradeScore) != 2 || tradeScore <= sacrificeScore {
+		t.Errorf("queen sacrifice scores %v and rook trade scores %v, want both mate in 2 with the trade higher",
+			sacrificeScore, tradeScore)
+	}
+}
+
+func TestImmediateMatePlayed(t *testing.T) {
+	// Rb8# and Rxa8# both mate at once, and Rxa8# also takes the knight.
+	p := mustParseFen(t, "n6k/6pp/8/8/8/8/6PP/RR4K1 w - - 0 1")
+	capture, err := chess.ParseUCIMove("a1a8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, depth := range []int{1, 2} {
+		if move := (Minmax{Depth: depth}).GetMove(p); move != capture {
+			t.Errorf("at depth %d played %s, want the capturing mate %s", depth, move, capture)
+		}
+	}
+}
+
+func TestGetMoveSourceReportsTablebase(t *testing.T) {
+	p := mustParseFen(t, "8/8/8/4k3/8/8/8/4KQ2 w - - 0 1")
+	if _, source := (Minmax{Depth: 1, Tablebase: tablebase.Mates{}}).GetMoveSource(p); source != agent.Tablebase {
+		t.Errorf("KQvK with a tablebase gave a move from %s, want the tablebase", source)
+	}
+	if _, source := (Minmax{Depth: 1}).GetMoveSource(p); source != agent.Search {
+		t.Errorf("KQvK without a tablebase gave a move from %s, want search", source)
+	}
+}
+
+func TestRepetitionAndFiftyMoveDraws(t *testing.T) {
+	// White is a bishop down and faces Qxg2#. After a round of checks, Qf7+ repeats a position.
+	p := mustParseFen(t, "5Q2/1b5k/6pp/5p2/8/8/4q1PP/7K w - - 0 1")
+	var history []chess.Position
+	for _, uci := range []string{"f8f7", "h7h8", "f7f8", "h8h7"} {
+		move, err := chess.ParseUCIMove(uci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, p)
+		p.Move(move)
+	}
+	check, err := chess.ParseUCIMove("f8f7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSearcher(context.Background(), Minmax{History: history}, &p)
+	if score := s.scoreMove(p, check, 1, 0); score != 0 {
+		t.Errorf("repeating with %s scores %v, want the draw 0", check, score)
+	}
+	s = newSearcher(context.Background(), Minmax{}, &p)
+	if score := s.scoreMove(p, check, 1, 0); score == 0 {
+		t.Errorf("without history %s scores 0, want the position evaluated rather than drawn", check)
+	}
+
+	// A queen up, every move but the pawn's lets the fifty-move rule draw the game.
+	p = mustParseFen(t, "4k3/8/8/8/8/8/P7/4K2Q w - - 99 80")
+	if move := (Minmax{Depth: 2}).GetMove(p); p.PieceAt(move.FromSquare).Type != chess.Pawn {
+		t.Errorf("played %s with the fifty-move rule due, want the pawn to move", move)
+	}
+}
@@ -0,0 +1,24 @@
+package perft
+
+import (
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/chess"
+)
+
+// Perft counts the leaf nodes of the legal move tree of p to depth. It is used to verify move generation.
+func Perft(p chess.Position, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	moves := agent.LegalMoves(&p)
+	if depth == 1 {
+		return uint64(len(moves))
+	}
+	var total uint64
+	for _, move := range moves {
+		newPos := p
+		newPos.Move(move)
+		total += Perft(newPos, depth-1)
+	}
+	return total
+}
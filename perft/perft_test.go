@@ -0,0 +1,45 @@
+package perft
+
+import (
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+// maxDepth is the deepest count checked, lowered under the race detector.
+var maxDepth = 5
+
+const kiwipete = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+func TestPerftMatchesReferenceCounts(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		fen   string
+		depth int
+		want  uint64
+	}{
+		{"start", chess.DefaultFen, 1, 20},
+		{"start", chess.DefaultFen, 2, 400},
+		{"start", chess.DefaultFen, 3, 8902},
+		{"start", chess.DefaultFen, 4, 197281},
+		{"start", chess.DefaultFen, 5, 4865609},
+		// Kiwipete has castling through attacked squares, which the chess library's move generator allows and
+		// agent.LegalMoves drops.
+		{"kiwipete", kiwipete, 1, 48},
+		{"kiwipete", kiwipete, 2, 2039},
+		{"kiwipete", kiwipete, 3, 97862},
+		{"kiwipete", kiwipete, 4, 4085603},
+		{"kiwipete", kiwipete, 5, 193690690},
+	} {
+		if tc.depth > maxDepth || tc.depth > 3 && testing.Short() {
+			continue
+		}
+		p, err := chess.ParseFen(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Perft(*p, tc.depth); got != tc.want {
+			t.Errorf("%s perft(%d) = %d, want %d", tc.name, tc.depth, got, tc.want)
+		}
+	}
+}
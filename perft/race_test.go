@@ -0,0 +1,8 @@
+//go:build race
+
+package perft
+
+// The race detector slows move generation down several times, which puts the deepest counts past the test timeout.
+func init() {
+	maxDepth = 4
+}
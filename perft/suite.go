@@ -0,0 +1,81 @@
+package perft
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/brighamskarda/chess"
+)
+
+// PerftFailure is a suite entry whose perft count did not match.
+type PerftFailure struct {
+	Fen      string
+	Depth    int
+	Expected uint64
+	Got      uint64
+}
+
+func (f PerftFailure) String() string {
+	return fmt.Sprintf("%s depth %d: expected %d, got %d", f.Fen, f.Depth, f.Expected, f.Got)
+}
+
+// RunPerftSuite checks every position of the EPD perft suite at path, such as perftsuite.epd, at each annotated depth
+// up to maxDepth. Lines look like "<fen> ;D1 20 ;D2 400". The FEN may leave off the move counters.
+func RunPerftSuite(path string, maxDepth int) (failures []PerftFailure, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ";")
+		fen := strings.TrimSpace(fields[0])
+		if len(strings.Fields(fen)) == 4 {
+			fen += " 0 1"
+		}
+		p, err := chess.ParseFen(fen)
+		if err != nil {
+			return failures, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		for _, field := range fields[1:] {
+			depth, expected, err := parseDepthCount(field)
+			if err != nil {
+				return failures, fmt.Errorf("line %d: %w", line, err)
+			}
+			if depth > maxDepth {
+				continue
+			}
+			if got := Perft(*p, depth); got != expected {
+				failures = append(failures, PerftFailure{Fen: fen, Depth: depth, Expected: expected, Got: got})
+			}
+		}
+	}
+	return failures, scanner.Err()
+}
+
+// parseDepthCount parses an annotation such as "D3 8902".
+func parseDepthCount(field string) (int, uint64, error) {
+	parts := strings.Fields(field)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "D") {
+		return 0, 0, fmt.Errorf("annotation %q is not of the form Dn count", field)
+	}
+	depth, err := strconv.Atoi(parts[0][1:])
+	if err != nil {
+		return 0, 0, fmt.Errorf("annotation %q: %w", field, err)
+	}
+	count, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("annotation %q: %w", field, err)
+	}
+	return depth, count, nil
+}
@@ -0,0 +1,42 @@
+package perft
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunPerftSuite(t *testing.T) {
+	failures, err := RunPerftSuite("testdata/mini.epd", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, failure := range failures {
+		t.Error(failure)
+	}
+}
+
+func TestRunPerftSuiteReportsWrongCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wrong.epd")
+	suite := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ;D1 20 ;D2 401 ;D5 1\n"
+	if err := os.WriteFile(path, []byte(suite), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	failures, err := RunPerftSuite(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PerftFailure{Fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", Depth: 2, Expected: 401, Got: 400}
+	if len(failures) != 1 || failures[0] != want {
+		t.Errorf("failures = %v, want only %v, with depth 5 skipped", failures, want)
+	}
+
+	if err := os.WriteFile(path, []byte(chessStart+" ;D1 twenty\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RunPerftSuite(path, 2); err == nil {
+		t.Error("malformed annotation gave no error")
+	}
+}
+
+const chessStart = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -"
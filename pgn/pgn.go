@@ -0,0 +1,151 @@
+package pgn
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/brighamskarda/applechess.git/analysis"
+	"github.com/brighamskarda/chess"
+)
+
+// sevenTags is the Seven Tag Roster, which every PGN game starts with in this order.
+var sevenTags = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// lineLength is the longest movetext line written, as the PGN export format recommends.
+const lineLength = 80
+
+// Move is a move of a game along with the engine's evaluation of it, if any.
+type Move struct {
+	Move   chess.Move
+	Scored bool    // Whether Score and Depth are set
+	Score  float64 // From white's perspective
+	Depth  int
+}
+
+// Game is a game to write as PGN.
+type Game struct {
+	Tags   map[string]string // Missing roster tags are written as unknown. Result, SetUp and FEN are filled in by Write.
+	Start  chess.Position
+	Moves  []Move
+	Result chess.Result
+}
+
+// Write writes g to w in PGN. Each scored move is followed by a { [%eval ...] } comment in the form lichess imports.
+func Write(w io.Writer, g Game) error {
+	var b strings.Builder
+	for _, tag := range sevenTags {
+		fmt.Fprintf(&b, "[%s %q]\n", tag, tagValue(g, tag))
+	}
+	fen := chess.GenerateFen(&g.Start)
+	if fen != chess.DefaultFen {
+		fmt.Fprintf(&b, "[SetUp \"1\"]\n[FEN %q]\n", fen)
+	}
+	var extra []string
+	for tag := range g.Tags {
+		if !slices.Contains(sevenTags, tag) && tag != "SetUp" && tag != "FEN" {
+			extra = append(extra, tag)
+		}
+	}
+	slices.Sort(extra)
+	for _, tag := range extra {
+		fmt.Fprintf(&b, "[%s %q]\n", tag, g.Tags[tag])
+	}
+	b.WriteString("\n")
+
+	p := g.Start
+	var tokens []string
+	numberBlack := true // A black move needs its number at the start and after a comment
+	for _, move := range g.Moves {
+		if p.Turn == chess.White {
+			tokens = append(tokens, fmt.Sprintf("%d.", p.FullMove))
+		} else if numberBlack {
+			tokens = append(tokens, fmt.Sprintf("%d...", p.FullMove))
+		}
+		tokens = append(tokens, San(move.Move, &p))
+		numberBlack = move.Scored
+		if move.Scored {
+			tokens = append(tokens, "{ "+EvalComment(move.Score, move.Depth)+" }")
+		}
+		p.Move(move.Move)
+	}
+	tokens = append(tokens, g.Result.String())
+	writeWrapped(&b, tokens)
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("unable to write pgn: %w", err)
+	}
+	return nil
+}
+
+// Line formats moves, played from p, as numbered SAN movetext such as "1. Nf3 Nc6 2. Bb5", or "1... Nc6 2. Bb5" if
+// black is to move.
+func Line(p chess.Position, moves []chess.Move) string {
+	var tokens []string
+	for i, move := range moves {
+		if p.Turn == chess.White {
+			tokens = append(tokens, fmt.Sprintf("%d.", p.FullMove))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d...", p.FullMove))
+		}
+		tokens = append(tokens, San(move, &p))
+		p.Move(move)
+	}
+	return strings.Join(tokens, " ")
+}
+
+// tagValue returns the value of a Seven Tag Roster tag, using the PGN placeholders for unknown values.
+func tagValue(g Game, tag string) string {
+	value, ok := g.Tags[tag]
+	switch {
+	case tag == "Result":
+		return g.Result.String()
+	case ok:
+		return value
+	case tag == "Date":
+		return "????.??.??"
+	}
+	return "?"
+}
+
+// writeWrapped joins tokens with spaces, breaking lines before they would exceed lineLength.
+func writeWrapped(b *strings.Builder, tokens []string) {
+	length := 0
+	for _, token := range tokens {
+		if length > 0 && length+1+len(token) > lineLength {
+			b.WriteString("\n")
+			length = 0
+		} else if length > 0 {
+			b.WriteString(" ")
+			length++
+		}
+		b.WriteString(token)
+		length += len(token)
+	}
+	b.WriteString("\n")
+}
+
+// EvalComment formats a score from white's perspective, searched to depth, as a %eval command such as [%eval +0.35,4]
+// or [%eval #-2,5].
+func EvalComment(score float64, depth int) string {
+	return fmt.Sprintf("[%%eval %s,%d]", analysis.FormatScore(score), depth)
+}
+
+// San formats m, played from p, in standard algebraic notation with a check or mate suffix.
+// chess.Move.SanString leaves the suffix off castling moves.
+func San(m chess.Move, p *chess.Position) string {
+	san := m.SanString(p)
+	if strings.HasSuffix(san, "+") || strings.HasSuffix(san, "#") {
+		return san
+	}
+	newPos := *p
+	newPos.Move(m)
+	if chess.IsCheckMate(&newPos) {
+		return san + "#"
+	}
+	if chess.IsCheck(&newPos) {
+		return san + "+"
+	}
+	return san
+}
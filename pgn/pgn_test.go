@@ -0,0 +1,140 @@
+package pgn
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/applechess.git/eval"
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+func mustParseMove(t *testing.T, uci string) chess.Move {
+	t.Helper()
+	move, err := chess.ParseUCIMove(uci)
+	if err != nil {
+		t.Fatalf("could not parse move %s: %v", uci, err)
+	}
+	return move
+}
+
+func TestSanMarksCheckAndMate(t *testing.T) {
+	for _, tc := range []struct {
+		fen, move, want string
+	}{
+		{chess.DefaultFen, "e2e4", "e4"},
+		// Scholar's mate.
+		{"r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4", "h5f7", "Qxf7#"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "f1b5", "Bb5+"},
+		// Castling gives check with the rook.
+		{"5k2/8/8/8/8/8/8/4K2R w K - 0 1", "e1g1", "O-O+"},
+		{"r3k3/8/8/8/8/8/8/4K3 b q - 0 1", "e8c8", "O-O-O"},
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", "b8=Q+"},
+		{"2r1k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7c8n", "bxc8=N"},
+	} {
+		p := mustParseFen(t, tc.fen)
+		if got := San(mustParseMove(t, tc.move), &p); got != tc.want {
+			t.Errorf("San(%s) from %s = %q, want %q", tc.move, tc.fen, got, tc.want)
+		}
+	}
+}
+
+// evalOrToken matches a { [%eval score,depth] } comment, or otherwise a single movetext token.
+var evalOrToken = regexp.MustCompile(`\{ \[%eval ([^,\]]+),(\d+)\] \}|\S+`)
+
+// readMovetext parses the movetext written by Write from start back into moves, taking each score from its %eval
+// comment.
+func readMovetext(t *testing.T, start chess.Position, movetext string) []Move {
+	t.Helper()
+	p := start
+	var moves []Move
+	for _, match := range evalOrToken.FindAllStringSubmatch(movetext, -1) {
+		token := match[0]
+		switch {
+		case match[1] != "":
+			if len(moves) == 0 {
+				t.Fatalf("comment %q before any move", token)
+			}
+			last := &moves[len(moves)-1]
+			last.Scored = true
+			last.Depth, _ = strconv.Atoi(match[2])
+			if mate, ok := strings.CutPrefix(match[1], "#"); ok {
+				n, err := strconv.Atoi(mate)
+				if err != nil {
+					t.Fatalf("could not parse mate in %q: %v", token, err)
+				}
+				last.Score = eval.MateScore - float64(2*n-1)
+				if n < 0 {
+					last.Score = -eval.MateScore + float64(-2*n-1)
+				}
+				continue
+			}
+			score, err := strconv.ParseFloat(match[1], 64)
+			if err != nil {
+				t.Fatalf("could not parse score in %q: %v", token, err)
+			}
+			last.Score = score
+		case strings.HasSuffix(token, "."), token == "1-0", token == "0-1", token == "1/2-1/2", token == "*":
+		default:
+			var found bool
+			for _, move := range chess.GenerateLegalMoves(&p) {
+				if San(move, &p) == token {
+					moves = append(moves, Move{Move: move})
+					p.Move(move)
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("%q is not a legal move in %s", token, chess.GenerateFen(&p))
+			}
+		}
+	}
+	return moves
+}
+
+func TestWriteRoundTripsEvalComments(t *testing.T) {
+	start := *chess.NewGame().Position()
+	moves := []Move{
+		{Move: mustParseMove(t, "e2e4"), Scored: true, Score: 0.35, Depth: 4},
+		{Move: mustParseMove(t, "e7e5")},
+		{Move: mustParseMove(t, "d1h5"), Scored: true, Score: -0.1, Depth: 3},
+		{Move: mustParseMove(t, "b8c6"), Scored: true, Score: 0, Depth: 3},
+		{Move: mustParseMove(t, "f1c4")},
+		{Move: mustParseMove(t, "g8f6"), Scored: true, Score: eval.MateScore - 1, Depth: 2},
+		{Move: mustParseMove(t, "h5f7"), Scored: true, Score: eval.MateScore - 1, Depth: 1},
+	}
+	var b strings.Builder
+	if err := Write(&b, Game{Start: start, Moves: moves, Result: chess.WhiteWins}); err != nil {
+		t.Fatal(err)
+	}
+	_, movetext, ok := strings.Cut(b.String(), "\n\n")
+	if !ok {
+		t.Fatalf("no movetext after the tags in %q", b.String())
+	}
+	for _, want := range []string{"1. e4 { [%eval +0.35,4] } 1... e5", "{ [%eval #1,1] } 1-0"} {
+		if !strings.Contains(movetext, want) {
+			t.Errorf("movetext %q does not contain %q", movetext, want)
+		}
+	}
+
+	got := readMovetext(t, start, movetext)
+	if len(got) != len(moves) {
+		t.Fatalf("read back %d moves, want %d", len(got), len(moves))
+	}
+	for i := range moves {
+		if got[i] != moves[i] {
+			t.Errorf("move %d read back as %+v, want %+v", i+1, got[i], moves[i])
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brighamskarda/applechess.git/pgn"
+	"github.com/brighamskarda/chess"
+)
+
+// scorecard tallies a match from player 1's point of view.
+type scorecard struct {
+	wins   int
+	draws  int
+	losses int
+	plies  int // Total length of all games in half-moves
+}
+
+func (sc scorecard) games() int {
+	return sc.wins + sc.draws + sc.losses
+}
+
+// score returns player 1's share of the points, counting a draw as half a win. Without games it is an even 0.5.
+func (sc scorecard) score() float64 {
+	if sc.games() == 0 {
+		return 0.5
+	}
+	return (float64(sc.wins) + float64(sc.draws)/2) / float64(sc.games())
+}
+
+// elo estimates player 1's rating advantage from the score with the logistic formula, along with the margin of a 95%
+// confidence interval. Both are infinite when either player scored every point. Without games there is no estimate,
+// and ok is false.
+func (sc scorecard) elo() (elo float64, margin float64, ok bool) {
+	if sc.games() == 0 {
+		return 0, 0, false
+	}
+	s := sc.score()
+	elo = 400 * math.Log10(s/(1-s))
+	if s == 0 || s == 1 {
+		return elo, math.Inf(1), true
+	}
+
+	n := float64(sc.games())
+	variance := (float64(sc.wins)*(1-s)*(1-s) + float64(sc.draws)*(0.5-s)*(0.5-s) + float64(sc.losses)*s*s) / n
+	scoreError := math.Sqrt(variance / n)
+	// The derivative of the Elo formula converts an error in score into one in Elo.
+	margin = 1.96 * scoreError * 400 / (math.Ln10 * s * (1 - s))
+	return elo, margin, true
+}
+
+func (sc scorecard) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "games: %d\n", sc.games())
+	fmt.Fprintf(&b, "player 1: %d wins, %d draws, %d losses\n", sc.wins, sc.draws, sc.losses)
+	fmt.Fprintf(&b, "player 2: %d wins, %d draws, %d losses\n", sc.losses, sc.draws, sc.wins)
+	elo, margin, ok := sc.elo()
+	if !ok {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "score: %.1f%%, elo difference: %+.0f ± %.0f\n", sc.score()*100, elo, margin)
+	fmt.Fprintf(&b, "average length: %.1f moves\n", float64(sc.plies)/float64(sc.games())/2)
+	return b.String()
+}
+
+// add records the result of a game in which player 1 had color.
+func (sc *scorecard) add(result chess.Result, color chess.Color, plies int) {
+	sc.plies += plies
+	switch {
+	case result == chess.Draw:
+		sc.draws++
+	case (result == chess.WhiteWins) == (color == chess.White):
+		sc.wins++
+	default:
+		sc.losses++
+	}
+}
+
+// selfPlay plays games between the agents of config, cycling through openings with each one played once with the first
+// agent as white and then once with it as black. Each game is also written to pgnOut in PGN, unless it is nil.
+func selfPlay(config playConfig, openings []chess.Position, games int, pgnOut io.Writer) scorecard {
+	var sc scorecard
+	for i := 0; i < games; i++ {
+		color := chess.White
+		if i%2 == 1 {
+			color = chess.Black
+		}
+		opening := openings[(i/2)%len(openings)]
+		game, err := playMatchGame(config.agents, color, opening, 0)
+		if err != nil {
+			slog.Error("could not set opening", "fen", chess.GenerateFen(&opening), "err", err)
+			continue
+		}
+		sc.add(game.result, color, len(game.moves))
+		slog.Info("self-play game finished", "game", i+1, "result", game.result)
+
+		if pgnOut != nil {
+			game.names = config.names
+			if color == chess.Black {
+				game.names = [2]string{config.names[1], config.names[0]}
+			}
+			game.write(pgnOut, "applechess self-play", i+1)
+		}
+	}
+	return sc
+}
+
+// matchGame is the record of one game of a match.
+type matchGame struct {
+	names   [2]string // The specs of the agents playing white and black, if known
+	opening chess.Position
+	moves   []pgn.Move
+	result  chess.Result
+	ending  string // How the game ended: checkmate, draw, max plies or forfeit
+}
+
+// playMatchGame plays agents[0] as color against agents[1] from opening, drawing the game once maxPlies half-moves have
+// been played if maxPlies is positive. A forfeit is logged, and the error is only for an opening that can't be set up.
+func playMatchGame(agents [2]ChessAgent, color chess.Color, opening chess.Position, maxPlies int) (matchGame, error) {
+	if color == chess.Black {
+		agents = [2]ChessAgent{agents[1], agents[0]}
+	}
+	game := chess.NewGame()
+	if err := game.SetPosition(&opening); err != nil {
+		return matchGame{}, err
+	}
+	moves, err := runGame(game, agents, io.Discard, false, maxPlies)
+	record := matchGame{opening: opening, moves: moves, result: game.GetResult()}
+	switch {
+	case err != nil:
+		slog.Error(err.Error())
+		record.ending = "forfeit"
+	case game.IsCheckMate():
+		record.ending = "checkmate"
+	case game.CanClaimDraw():
+		record.ending = "draw"
+	default:
+		record.ending = "max plies"
+	}
+	return record, nil
+}
+
+// write writes the game to w in PGN as round of event, followed by a blank line.
+func (g matchGame) write(w io.Writer, event string, round int) {
+	record := pgn.Game{
+		Tags: map[string]string{
+			"Event": event,
+			"Date":  time.Now().Format("2006.01.02"),
+			"Round": strconv.Itoa(round),
+			"White": g.names[0],
+			"Black": g.names[1],
+		},
+		Start:  g.opening,
+		Moves:  g.moves,
+		Result: g.result,
+	}
+	if err := pgn.Write(w, record); err != nil {
+		slog.Error(err.Error())
+	}
+	fmt.Fprintln(w)
+}
+
+// readOpenings reads one FEN per line from r. Blank lines and lines starting with # are skipped.
+func readOpenings(r io.Reader) ([]chess.Position, error) {
+	var openings []chess.Position
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fen := strings.TrimSpace(scanner.Text())
+		if fen == "" || strings.HasPrefix(fen, "#") {
+			continue
+		}
+		p, err := chess.ParseFen(fen)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !chess.IsValidPosition(p) {
+			return nil, fmt.Errorf("line %d: invalid position %s", line, fen)
+		}
+		openings = append(openings, *p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(openings) == 0 {
+		return nil, errors.New("no openings found")
+	}
+	return openings, nil
+}
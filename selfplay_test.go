@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/brighamskarda/applechess.git/alphabeta"
+)
+
+func TestScorecardScoreAndElo(t *testing.T) {
+	sc := scorecard{wins: 6, draws: 2, losses: 2}
+	if got := sc.score(); got != 0.7 {
+		t.Errorf("score = %v, want 0.7", got)
+	}
+	elo, margin, ok := sc.elo()
+	if !ok {
+		t.Fatal("no Elo estimate for 10 games")
+	}
+	// 400 * log10(0.7 / 0.3), and 1.96 standard errors of the score converted to Elo.
+	if math.Abs(elo-147.19) > 0.01 {
+		t.Errorf("elo = %.2f, want 147.19", elo)
+	}
+	if math.Abs(margin-205.09) > 0.01 {
+		t.Errorf("margin = %.2f, want 205.09", margin)
+	}
+}
+
+func TestScorecardOneSided(t *testing.T) {
+	elo, margin, ok := scorecard{wins: 3}.elo()
+	if !ok || !math.IsInf(elo, 1) || !math.IsInf(margin, 1) {
+		t.Errorf("elo() = %v, %v, %v for a clean sweep, want +Inf, +Inf, true", elo, margin, ok)
+	}
+}
+
+func TestEmptyScorecard(t *testing.T) {
+	var sc scorecard
+	if got := sc.score(); got != 0.5 {
+		t.Errorf("score = %v without games, want 0.5", got)
+	}
+	if _, _, ok := sc.elo(); ok {
+		t.Error("elo() gave an estimate without games")
+	}
+	if summary := sc.String(); strings.Contains(summary, "NaN") {
+		t.Errorf("summary without games mentions NaN:\n%s", summary)
+	}
+}
+
+func TestSelfPlayPlaysEachOpeningWithBothColors(t *testing.T) {
+	// In each opening the side to move mates at once, so whichever agent has it wins.
+	openings, err := readOpenings(strings.NewReader(`# Back rank mates
+6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1
+
+r5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := playConfig{
+		agents: [2]ChessAgent{alphabeta.AlphaBeta{Depth: 1}, alphabeta.AlphaBeta{Depth: 2}},
+		names:  [2]string{"ab:depth=1", "ab:depth=2"},
+	}
+	var out bytes.Buffer
+	sc := selfPlay(config, openings, 2*len(openings), &out)
+	if sc.games() != 4 || sc.wins != 2 || sc.losses != 2 || sc.draws != 0 {
+		t.Errorf("scorecard is %d wins, %d draws and %d losses, want 2 wins and 2 losses over 4 games", sc.wins,
+			sc.draws, sc.losses)
+	}
+	if sc.plies != 4 {
+		t.Errorf("games took %d plies in total, want 4 mates in one", sc.plies)
+	}
+	if games := strings.Count(out.String(), "[Event "); games != 4 {
+		t.Errorf("%d games written, want 4", games)
+	}
+	if firstWhite := strings.Count(out.String(), `[White "ab:depth=1"]`); firstWhite != 2 {
+		t.Errorf("first agent is white in %d games, want 2", firstWhite)
+	}
+}
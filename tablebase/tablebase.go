@@ -0,0 +1,220 @@
+// Package tablebase solves the simplest endgames outright, so that agents can play them perfectly whatever their search
+// depth.
+package tablebase
+
+import (
+	"sync"
+
+	"github.com/brighamskarda/chess"
+)
+
+// Mates is a tablebase of the king and queen, and king and rook, against lone king endgames, along with the bare kings
+// they can be drawn into. Its tables are built by retrograde analysis the first time each is probed, and shared by
+// every Mates after that. Positions with castling rights are left out, since the tables have no castling.
+type Mates struct{}
+
+// Tables of the half-moves until mate, indexed by tableIndex with the mating side as white, and -1 where nobody mates.
+var (
+	queenMates = sync.OnceValue(func() []int8 { return solve(chess.Queen) })
+	rookMates  = sync.OnceValue(func() []int8 { return solve(chess.Rook) })
+)
+
+// Probe returns the outcome of p for its side to move as agent.TablebaseProber describes. Since nothing is captured or
+// promoted on the way to mate, dtz is also the number of half-moves until mate.
+func (Mates) Probe(p chess.Position) (wdl int, dtz int, ok bool) {
+	if p.WhiteKingSideCastle || p.WhiteQueenSideCastle || p.BlackKingSideCastle || p.BlackQueenSideCastle {
+		return 0, 0, false
+	}
+	kings := [3]int{-1, -1, -1} // Indexed by color
+	strong, strongType, strongColor := -1, chess.NoPieceType, chess.NoColor
+	for i, piece := range p.Board {
+		switch {
+		case piece.Type == chess.NoPieceType:
+		case piece.Type == chess.King:
+			kings[piece.Color] = i
+		case (piece.Type == chess.Queen || piece.Type == chess.Rook) && strong < 0:
+			strong, strongType, strongColor = i, piece.Type, piece.Color
+		default:
+			return 0, 0, false
+		}
+	}
+	if kings[chess.White] < 0 || kings[chess.Black] < 0 {
+		return 0, 0, false
+	}
+	if strong < 0 {
+		return 0, 0, true
+	}
+
+	// Mirror the board so that the mating side plays white.
+	mating, defending := kings[chess.White], kings[chess.Black]
+	if strongColor == chess.Black {
+		mating, defending, strong = kings[chess.Black]^56, kings[chess.White]^56, strong^56
+	}
+	table := rookMates()
+	if strongType == chess.Queen {
+		table = queenMates()
+	}
+	matingToMove := p.Turn == strongColor
+	plies := int(table[tableIndex(matingToMove, mating, strong, defending)])
+	switch {
+	case plies < 0:
+		return 0, 0, true
+	case matingToMove:
+		return 2, plies, true
+	default:
+		return -2, -plies, true
+	}
+}
+
+// tableIndex returns the index in a table of Mates of the position with white's king on wk, its other piece on wp and
+// black's king on bk, each a chess.Position board index, with white to move if whiteToMove is set and black otherwise.
+func tableIndex(whiteToMove bool, wk int, wp int, bk int) int {
+	index := wk<<12 | wp<<6 | bk
+	if !whiteToMove {
+		index |= 1 << 18
+	}
+	return index
+}
+
+// tableLength is the number of indexes tableIndex can return.
+const tableLength = 1 << 19
+
+var (
+	kingSteps  = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookSteps  = [][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	queenSteps = kingSteps
+)
+
+// solve builds the table of Mates for a white king and piece of type t against a black king. Starting from the
+// positions with black mated, it works backwards: a position with white to move is won if some move reaches a position
+// already lost for black, and a position with black to move is lost once every move reaches one already won for white.
+// Each pass over the positions found by the one before adds two half-moves to the mates, so every mate is found at its
+// shortest.
+func solve(t chess.PieceType) []int8 {
+	steps := rookSteps
+	if t == chess.Queen {
+		steps = queenSteps
+	}
+	plies := make([]int8, tableLength)
+	for i := range plies {
+		plies[i] = -1
+	}
+
+	// escapes counts the moves from each position with black to move that are not yet known to lose.
+	escapes := make([]uint8, tableLength)
+	var lost []int
+	for wk := range 64 {
+		for wp := range 64 {
+			for bk := range 64 {
+				if wk == wp || wp == bk || wk == bk || adjacent(wk, bk) {
+					continue
+				}
+				index := tableIndex(false, wk, wp, bk)
+				for _, to := range kingMoves[bk] {
+					if adjacent(to, wk) || (to == wp && adjacent(wp, wk)) || (to != wp && attacks(steps, wp, to, wk)) {
+						continue
+					}
+					escapes[index]++
+				}
+				if escapes[index] == 0 && attacks(steps, wp, bk, wk) {
+					plies[index] = 0
+					lost = append(lost, index)
+				}
+			}
+		}
+	}
+
+	for ply := int8(1); len(lost) > 0; ply += 2 {
+		var won []int
+		for _, index := range lost {
+			wk, wp, bk := index>>12&63, index>>6&63, index&63
+			mark := func(wk, wp int) {
+				if attacks(steps, wp, bk, wk) {
+					return // Black would have been in check with white to move.
+				}
+				if winning := tableIndex(true, wk, wp, bk); plies[winning] < 0 {
+					plies[winning] = ply
+					won = append(won, winning)
+				}
+			}
+			for _, from := range kingMoves[wk] {
+				if from != wp && !adjacent(from, bk) {
+					mark(from, wp)
+				}
+			}
+			for _, step := range steps {
+				for from := wp; ; {
+					next, ok := offset(from, step)
+					if !ok || next == wk || next == bk {
+						break
+					}
+					from = next
+					mark(wk, from)
+				}
+			}
+		}
+
+		lost = nil
+		for _, index := range won {
+			wk, wp, bk := index>>12&63, index>>6&63, index&63
+			for _, from := range kingMoves[bk] {
+				if from == wp || adjacent(from, wk) {
+					continue
+				}
+				if before := tableIndex(false, wk, wp, from); plies[before] < 0 {
+					if escapes[before]--; escapes[before] == 0 {
+						plies[before] = ply + 1
+						lost = append(lost, before)
+					}
+				}
+			}
+		}
+	}
+	return plies
+}
+
+// attacks reports whether a piece moving by steps, sliding until blocked, attacks target from from with only the
+// square blocker in its way.
+func attacks(steps [][2]int, from int, target int, blocker int) bool {
+	for _, step := range steps {
+		for square := from; ; {
+			next, ok := offset(square, step)
+			if !ok || next == blocker {
+				break
+			}
+			if next == target {
+				return true
+			}
+			square = next
+		}
+	}
+	return false
+}
+
+// kingMoves holds the squares next to each square.
+var kingMoves = func() (moves [64][]int) {
+	for square := range moves {
+		for _, step := range kingSteps {
+			if next, ok := offset(square, step); ok {
+				moves[square] = append(moves[square], next)
+			}
+		}
+	}
+	return moves
+}()
+
+// adjacent reports whether squares a and b touch, so that kings on them would attack each other. A square is not
+// adjacent to itself.
+func adjacent(a int, b int) bool {
+	df, dr := a%8-b%8, a/8-b/8
+	return a != b && df >= -1 && df <= 1 && dr >= -1 && dr <= 1
+}
+
+// offset returns the square step away from square, with false if that is off the board.
+func offset(square int, step [2]int) (int, bool) {
+	file, row := square%8+step[0], square/8+step[1]
+	if file < 0 || file > 7 || row < 0 || row > 7 {
+		return 0, false
+	}
+	return row*8 + file, true
+}
@@ -0,0 +1,82 @@
+package tablebase
+
+import (
+	"testing"
+
+	"github.com/brighamskarda/applechess.git/agent"
+	"github.com/brighamskarda/chess"
+)
+
+func mustParseFen(t *testing.T, fen string) chess.Position {
+	t.Helper()
+	p, err := chess.ParseFen(fen)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", fen, err)
+	}
+	return *p
+}
+
+func TestProbeKnownPositions(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		fen      string
+		wdl, dtz int
+		ok       bool
+	}{
+		{"mated by the queen", "k7/1Q6/1K6/8/8/8/8/8 b - - 0 1", -2, 0, true},
+		{"queen mates in 1", "k7/7Q/1K6/8/8/8/8/8 w - - 0 1", 2, 1, true},
+		{"rook mates in 1", "k7/8/1K6/8/8/8/8/7R w - - 0 1", 2, 1, true},
+		{"black rook mates in 1", "7r/8/8/8/8/1k6/8/K7 b - - 0 1", 2, 1, true},
+		{"stalemated", "k7/8/1Q6/8/8/8/8/2K5 b - - 0 1", 0, 0, true},
+		{"rook left hanging", "7K/8/8/8/8/8/2k5/1R6 b - - 0 1", 0, 0, true},
+		{"bare kings", "8/8/8/4k3/8/8/8/4K3 w - - 0 1", 0, 0, true},
+		{"with a pawn", "8/8/8/4k3/8/8/4P3/4K2R w - - 0 1", 0, 0, false},
+		{"with castling rights", "8/8/8/4k3/8/8/8/4K2R w K - 0 1", 0, 0, false},
+	} {
+		wdl, dtz, ok := Mates{}.Probe(mustParseFen(t, tc.fen))
+		if wdl != tc.wdl || dtz != tc.dtz || ok != tc.ok {
+			t.Errorf("%s: Probe gave %d, %d, %v, want %d, %d, %v", tc.name, wdl, dtz, ok, tc.wdl, tc.dtz, tc.ok)
+		}
+	}
+}
+
+func TestLongestMates(t *testing.T) {
+	// The longest KQvK mate takes 10 moves and the longest KRvK mate 16.
+	for _, tc := range []struct {
+		name  string
+		table []int8
+		want  int8
+	}{{"KQvK", queenMates(), 19}, {"KRvK", rookMates(), 31}} {
+		var longest [2]int8 // Indexed by whether white is to move
+		for i := range 64 * 64 * 64 {
+			wk, wp, bk := i/4096, i/64%64, i%64
+			longest[0] = max(longest[0], tc.table[tableIndex(false, wk, wp, bk)])
+			longest[1] = max(longest[1], tc.table[tableIndex(true, wk, wp, bk)])
+		}
+		if longest[1] != tc.want || longest[0] != tc.want+1 {
+			t.Errorf("the longest %s mate takes %d half-moves with white to move and %d with black, want %d and %d",
+				tc.name, longest[1], longest[0], tc.want, tc.want+1)
+		}
+	}
+}
+
+func TestTablebaseMovesMateInDtz(t *testing.T) {
+	p := mustParseFen(t, "8/8/8/4k3/8/8/8/R3K3 w - - 0 1")
+	wdl, dtz, ok := Mates{}.Probe(p)
+	if !ok || wdl != 2 {
+		t.Fatalf("Probe gave %d, %d, %v, want a win", wdl, dtz, ok)
+	}
+	plies := 0
+	for !chess.IsCheckMate(&p) && plies <= dtz {
+		move, ok := agent.TablebaseMove(Mates{}, p)
+		if !ok {
+			t.Fatalf("no tablebase move after %d half-moves", plies)
+		}
+		p.Move(move)
+		plies++
+	}
+	if !chess.IsCheckMate(&p) || plies != dtz {
+		t.Errorf("best play by both sides reached %s after %d half-moves, want mate after %d",
+			chess.GenerateFen(&p), plies, dtz)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+
+	"github.com/brighamskarda/chess"
+)
+
+// tournamentCommand plays a match between two agents with several games running at once, and prints its scorecard.
+// The result can also be written as JSON, along with the outcome of every game.
+func tournamentCommand(args []string) error {
+	flags := flag.NewFlagSet("tournament", flag.ExitOnError)
+	player1 := flags.String("p1", "ab:depth=3", "first agent, as for -p1 of play")
+	player2 := flags.String("p2", "ab:depth=2", "second agent, as for -p2 of play")
+	games := flags.Int("games", 10, "number of games to play, alternating colors")
+	openingsFile := flags.String("openings", "", "file of starting FENs, one per line, cycled through with each played once with either agent as white")
+	workers := flags.Int("workers", runtime.NumCPU(), "games to play at once")
+	maxPlies := flags.Int("maxplies", 400, "half-moves after which a game is drawn, or 0 for no limit")
+	jsonFile := flags.String("json", "", "file to write the result to as JSON, or - to print it instead of the scorecard")
+	pgnFile := flags.String("pgn", "", "file to write the games to in PGN, with engine evaluations")
+	logLevel := flags.String("log", "ERROR", "logging level [ERROR|WARN|INFO|DEBUG]")
+	flags.Parse(args)
+	setLogLevel(*logLevel)
+
+	if *games < 1 {
+		return fmt.Errorf("-games must be at least 1, got %d", *games)
+	}
+	specs := [2]string{*player1, *player2}
+	for i, spec := range specs {
+		player, err := parseAgentSpec(spec, 2)
+		if err != nil {
+			return fmt.Errorf("could not parse -p%d argument: %w", i+1, err)
+		}
+		if _, ok := player.(Human); ok {
+			return fmt.Errorf("-p%d must be an engine, not %s", i+1, spec)
+		}
+	}
+	openings := []chess.Position{*chess.NewGame().Position()}
+	if *openingsFile != "" {
+		file, err := os.Open(*openingsFile)
+		if err != nil {
+			return fmt.Errorf("could not open -openings file: %w", err)
+		}
+		openings, err = readOpenings(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("could not read -openings file: %w", err)
+		}
+	}
+
+	result := tournament(specs, openings, *games, *workers, *maxPlies)
+
+	if *pgnFile != "" {
+		file, err := os.Create(*pgnFile)
+		if err != nil {
+			return fmt.Errorf("could not create -pgn file: %w", err)
+		}
+		defer file.Close()
+		for i, game := range result.games {
+			if game.ending != "" {
+				game.write(file, "applechess tournament", i+1)
+			}
+		}
+	}
+	switch *jsonFile {
+	case "":
+		fmt.Print(result.scorecard)
+	case "-":
+		return result.writeJSON(os.Stdout)
+	default:
+		fmt.Print(result.scorecard)
+		file, err := os.Create(*jsonFile)
+		if err != nil {
+			return fmt.Errorf("could not create -json file: %w", err)
+		}
+		defer file.Close()
+		return result.writeJSON(file)
+	}
+	return nil
+}
+
+// tournamentResult is the outcome of a tournament.
+type tournamentResult struct {
+	specs     [2]string
+	scorecard scorecard
+	games     []matchGame // In the order they were started. Games whose opening couldn't be set up have no ending.
+}
+
+// tournament plays games between the agents described by specs, cycling through openings as selfPlay does, with up to
+// workers games at once. Each game gets agents of its own, so that those keeping a table or tree between moves don't
+// share it with another game. Games are drawn after maxPlies half-moves if it is positive.
+func tournament(specs [2]string, openings []chess.Position, games int, workers int, maxPlies int) tournamentResult {
+	result := tournamentResult{specs: specs, games: make([]matchGame, games)}
+	forEach(games, workers, func(i int) {
+		var players [2]ChessAgent
+		for j, spec := range specs {
+			players[j], _ = parseAgentSpec(spec, 2) // Already checked by the caller
+		}
+		color := chess.White
+		if i%2 == 1 {
+			color = chess.Black
+		}
+		opening := openings[(i/2)%len(openings)]
+		game, err := playMatchGame(players, color, opening, maxPlies)
+		if err != nil {
+			slog.Error("could not set opening", "fen", chess.GenerateFen(&opening), "err", err)
+			return
+		}
+		game.names = specs
+		if color == chess.Black {
+			game.names = [2]string{specs[1], specs[0]}
+		}
+		result.games[i] = game
+		slog.Info("tournament game finished", "game", i+1, "result", game.result, "ending", game.ending)
+	})
+
+	for i, game := range result.games {
+		if game.ending == "" {
+			continue
+		}
+		color := chess.White
+		if i%2 == 1 {
+			color = chess.Black
+		}
+		result.scorecard.add(game.result, color, len(game.moves))
+	}
+	return result
+}
+
+// writeJSON writes the result to w as JSON, scored from the first agent's point of view. Elo fields are null where
+// they are infinite, as they are when either agent scored every point, and when no game finished.
+func (r tournamentResult) writeJSON(w io.Writer) error {
+	type jsonGame struct {
+		Round   int    `json:"round"`
+		White   string `json:"white"`
+		Black   string `json:"black"`
+		Opening string `json:"opening"`
+		Result  string `json:"result"`
+		Ending  string `json:"ending"`
+		Plies   int    `json:"plies"`
+	}
+	finite := func(x float64) *float64 {
+		if math.IsInf(x, 0) {
+			return nil
+		}
+		return &x
+	}
+	sc := r.scorecard
+	elo, margin, ok := sc.elo()
+	out := struct {
+		Player1   string     `json:"player1"`
+		Player2   string     `json:"player2"`
+		Games     int        `json:"games"`
+		Wins      int        `json:"wins"`
+		Draws     int        `json:"draws"`
+		Losses    int        `json:"losses"`
+		Score     float64    `json:"score"`
+		Elo       *float64   `json:"elo"`
+		EloMargin *float64   `json:"elo_margin"`
+		Plies     int        `json:"plies"`
+		Rounds    []jsonGame `json:"rounds"`
+	}{
+		Player1: r.specs[0],
+		Player2: r.specs[1],
+		Games:   sc.games(),
+		Wins:    sc.wins,
+		Draws:   sc.draws,
+		Losses:  sc.losses,
+		Score:   sc.score(),
+		Plies:   sc.plies,
+		Rounds:  []jsonGame{},
+	}
+	if ok {
+		out.Elo, out.EloMargin = finite(elo), finite(margin)
+	}
+	for i, game := range r.games {
+		if game.ending == "" {
+			continue
+		}
+		out.Rounds = append(out.Rounds, jsonGame{
+			Round:   i + 1,
+			White:   game.names[0],
+			Black:   game.names[1],
+			Opening: chess.GenerateFen(&game.opening),
+			Result:  game.result.String(),
+			Ending:  game.ending,
+			Plies:   len(game.moves),
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestTournamentJSONWithoutGames(t *testing.T) {
+	var out bytes.Buffer
+	result := tournamentResult{specs: [2]string{"ab:depth=1", "ab:depth=1"}, games: make([]matchGame, 2)}
+	if err := result.writeJSON(&out); err != nil {
+		t.Fatalf("writeJSON failed without finished games: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["elo"] != nil || decoded["score"] != 0.5 {
+		t.Errorf("elo = %v, score = %v, want null and 0.5", decoded["elo"], decoded["score"])
+	}
+}
+
+func TestTournamentPlaysEveryGame(t *testing.T) {
+	openings := []chess.Position{*chess.NewGame().Position()}
+	result := tournament([2]string{"ab:depth=1", "minmax:depth=1"}, openings, 4, 2, 20)
+	if got := result.scorecard.games(); got != 4 {
+		t.Fatalf("scorecard has %d games, want 4", got)
+	}
+	for i, game := range result.games {
+		if len(game.moves) > 20 {
+			t.Errorf("game %d has %d plies, more than the limit of 20", i+1, len(game.moves))
+		}
+		if white := game.names[0]; (i%2 == 0) != (white == "ab:depth=1") {
+			t.Errorf("game %d has %s as white, but colors should alternate", i+1, white)
+		}
+	}
+	var out bytes.Buffer
+	if err := result.writeJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,333 @@
+package uci
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brighamskarda/chess"
+)
+
+// movesToGo is how many more moves a clock is assumed to need to last for when the GUI does not say.
+const movesToGo = 30
+
+// Agent chooses moves, as every applechess agent does.
+type Agent interface {
+	GetMove(p chess.Position) chess.Move
+}
+
+// ContextAgent is an Agent whose search stop can end early.
+type ContextAgent interface {
+	GetMoveContext(ctx context.Context, p chess.Position) (chess.Move, error)
+}
+
+// Info describes a finished search, for the info command sent before its bestmove. Zero fields are left out.
+type Info struct {
+	Depth    int
+	Nodes    uint64
+	HashFull int    // Thousandths of the transposition table in use
+	Text     string // Sent last as info string, since it takes up the rest of the line
+}
+
+// String formats i as the arguments of an info command, such as "depth 4 nodes 1200 hashfull 3 string note", or as ""
+// if it is empty.
+func (i Info) String() string {
+	var fields []string
+	if i.Depth > 0 {
+		fields = append(fields, "depth "+strconv.Itoa(i.Depth))
+	}
+	if i.Nodes > 0 {
+		fields = append(fields, "nodes "+strconv.FormatUint(i.Nodes, 10))
+	}
+	if i.HashFull > 0 {
+		fields = append(fields, "hashfull "+strconv.Itoa(i.HashFull))
+	}
+	if i.Text != "" {
+		fields = append(fields, "string "+i.Text)
+	}
+	return strings.Join(fields, " ")
+}
+
+// InfoAgent is a ContextAgent that also describes the search behind its move.
+type InfoAgent interface {
+	GetMoveInfo(ctx context.Context, p chess.Position) (chess.Move, Info, error)
+}
+
+// Ponderer is an Agent that can think on its opponent's time.
+type Ponderer interface {
+	// Predict returns the move its last search expects to be played from p, or the zero move if it has none.
+	Predict(p chess.Position) chess.Move
+	// Ponder searches p until ctx is done, keeping what it finds for a later search of p.
+	Ponder(ctx context.Context, p chess.Position)
+}
+
+// Limits are the search limits sent with a go command. Limits the GUI did not send are zero.
+type Limits struct {
+	WTime, BTime time.Duration
+	WInc, BInc   time.Duration
+	MovesToGo    int
+	MoveTime     time.Duration
+	Depth        int
+	Infinite     bool
+	Ponder       bool // The position is the one after the move the engine predicted, searched until ponderhit or stop
+}
+
+// Budget returns how long the side to move, turn, should think: MoveTime if given, otherwise an even share of its
+// remaining clock plus its increment. It returns 0 when the GUI gave no time limit.
+func (l Limits) Budget(turn chess.Color) time.Duration {
+	if l.MoveTime > 0 {
+		return l.MoveTime
+	}
+	remaining, increment := l.WTime, l.WInc
+	if turn == chess.Black {
+		remaining, increment = l.BTime, l.BInc
+	}
+	if remaining <= 0 {
+		return 0
+	}
+	moves := l.MovesToGo
+	if moves <= 0 {
+		moves = movesToGo
+	}
+	return min(remaining/time.Duration(moves)+increment, remaining/2)
+}
+
+// Engine speaks UCI for the agents NewAgent builds.
+type Engine struct {
+	Name   string
+	Author string
+	// NewAgent returns the agent to search p with, set up for limits as well as it can be. It is called once per go
+	// command.
+	NewAgent func(p chess.Position, limits Limits) Agent
+}
+
+// Run reads UCI commands from r and writes the engine's replies to w until quit is received or r runs out. It handles
+// uci, isready, ucinewgame, position, go, ponderhit, stop and quit, and ignores anything else. stop cancels the search
+// of a ContextAgent and waits for its bestmove, while other agents are left to finish their search. The bestmove of go
+// infinite is held back until stop, and an InfoAgent's is preceded by an info command describing its search. go ponder
+// has a Ponderer think about the position until ponderhit, when the search proper starts with the limits of the go
+// command, and bestmove names the reply a Ponderer predicts to ponder on next.
+func (e Engine) Run(r io.Reader, w io.Writer) error {
+	var mu sync.Mutex
+	send := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, format+"\n", args...)
+	}
+
+	var search sync.WaitGroup
+	cancel := func() {}
+	defer func() { cancel() }()
+	ponderHit := func() {}
+	position := *chess.NewGame().Position()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			send("id name %s", e.Name)
+			send("id author %s", e.Author)
+			send("option name Ponder type check default false")
+			send("uciok")
+		case "isready":
+			send("readyok")
+		case "ucinewgame":
+			search.Wait()
+			position = *chess.NewGame().Position()
+		case "position":
+			search.Wait()
+			p, err := ParsePosition(fields[1:])
+			if err != nil {
+				slog.Error("could not parse uci position", "err", err)
+				send("info string %s", err)
+				continue
+			}
+			position = p
+		case "go":
+			search.Wait()
+			limits := parseGo(fields[1:])
+			agent := e.NewAgent(position, limits)
+			ctx, cancelSearch := context.WithCancel(context.Background())
+			cancel = cancelSearch
+			hit := make(chan struct{})
+			ponderHit = sync.OnceFunc(func() { close(hit) })
+			search.Add(1)
+			go func(p chess.Position) {
+				defer search.Done()
+				defer cancelSearch()
+				if limits.Ponder {
+					ponder(ctx, agent, p, hit)
+				}
+				move, info := getMove(ctx, agent, p)
+				if line := info.String(); line != "" {
+					send("info %s", line)
+				}
+				if limits.Infinite {
+					// No bestmove may be sent before stop, however soon the search finishes.
+					<-ctx.Done()
+				}
+				send("%s", bestMove(agent, p, move))
+			}(position)
+		case "ponderhit":
+			ponderHit()
+		case "stop":
+			cancel()
+			search.Wait()
+		case "quit":
+			return nil
+		}
+	}
+	search.Wait()
+	return scanner.Err()
+}
+
+// getMove searches p with agent, until ctx is done if agent is a ContextAgent, and returns the Info of an InfoAgent's
+// search. If the search is stopped before the agent has a move, the first legal move is played rather than none.
+func getMove(ctx context.Context, agent Agent, p chess.Position) (chess.Move, Info) {
+	var move chess.Move
+	var info Info
+	var err error
+	switch agent := agent.(type) {
+	case InfoAgent:
+		move, info, err = agent.GetMoveInfo(ctx, p)
+	case ContextAgent:
+		move, err = agent.GetMoveContext(ctx, p)
+	default:
+		return agent.GetMove(p), info
+	}
+	if err != nil {
+		slog.Error("agent could not move", "err", err)
+	}
+	if moves := chess.GenerateLegalMoves(&p); move == (chess.Move{}) && ctx.Err() != nil && len(moves) > 0 {
+		move = moves[0]
+	}
+	return move, info
+}
+
+// ponder has agent, if it is a Ponderer, search p until hit is closed or ctx is done. Other agents just wait for
+// either, since no bestmove may be sent before.
+func ponder(ctx context.Context, agent Agent, p chess.Position, hit <-chan struct{}) {
+	ponderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-hit:
+			cancel()
+		case <-ponderCtx.Done():
+		}
+	}()
+	if ponderer, ok := agent.(Ponderer); ok {
+		ponderer.Ponder(ponderCtx, p)
+	}
+	<-ponderCtx.Done()
+}
+
+// bestMove formats the reply to a go command for move, chosen from p. If agent is a Ponderer that predicts the reply to
+// move, it is named as the move to ponder on.
+func bestMove(agent Agent, p chess.Position, move chess.Move) string {
+	reply := "bestmove " + FormatMove(move)
+	ponderer, ok := agent.(Ponderer)
+	if !ok || move == (chess.Move{}) {
+		return reply
+	}
+	p.Move(move)
+	if predicted := ponderer.Predict(p); predicted != (chess.Move{}) {
+		reply += " ponder " + FormatMove(predicted)
+	}
+	return reply
+}
+
+// ParsePosition parses the arguments of a position command, "startpos" or "fen" followed by the six FEN fields,
+// optionally followed by "moves" and the moves played since in long algebraic notation.
+func ParsePosition(args []string) (chess.Position, error) {
+	var p *chess.Position
+	moves := slices.Index(args, "moves")
+	if moves < 0 {
+		moves = len(args)
+	}
+	switch {
+	case len(args) > 0 && args[0] == "startpos":
+		p = chess.NewGame().Position()
+	case len(args) > 0 && args[0] == "fen":
+		var err error
+		p, err = chess.ParseFen(strings.Join(args[1:moves], " "))
+		if err != nil {
+			return chess.Position{}, err
+		}
+	default:
+		return chess.Position{}, fmt.Errorf("position must start with startpos or fen: %s", strings.Join(args, " "))
+	}
+
+	for i := moves + 1; i < len(args); i++ {
+		move, err := chess.ParseUCIMove(args[i])
+		if err != nil {
+			return chess.Position{}, err
+		}
+		if !slices.Contains(chess.GenerateLegalMoves(p), move) {
+			return chess.Position{}, fmt.Errorf("illegal move %s in %s", args[i], chess.GenerateFen(p))
+		}
+		p.Move(move)
+	}
+	return *p, nil
+}
+
+// parseGo parses the arguments of a go command. Unknown and malformed arguments are ignored.
+func parseGo(args []string) Limits {
+	var l Limits
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			l.Infinite = true
+			continue
+		}
+		if args[i] == "ponder" {
+			l.Ponder = true
+			continue
+		}
+		if i+1 == len(args) {
+			break
+		}
+		value, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			continue
+		}
+		ms := time.Duration(value) * time.Millisecond
+		switch args[i] {
+		case "wtime":
+			l.WTime = ms
+		case "btime":
+			l.BTime = ms
+		case "winc":
+			l.WInc = ms
+		case "binc":
+			l.BInc = ms
+		case "movestogo":
+			l.MovesToGo = value
+		case "movetime":
+			l.MoveTime = ms
+		case "depth":
+			l.Depth = value
+		default:
+			continue
+		}
+		i++
+	}
+	return l
+}
+
+// FormatMove formats m in lowercase long algebraic notation, such as e7e8q, or as 0000 for the zero move.
+func FormatMove(m chess.Move) string {
+	if m == (chess.Move{}) {
+		return "0000"
+	}
+	return strings.ToLower(m.String())
+}
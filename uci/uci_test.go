@@ -0,0 +1,175 @@
+package uci
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brighamskarda/chess"
+)
+
+// firstMove is an Agent that plays the first legal move at once.
+type firstMove struct{}
+
+func (firstMove) GetMove(p chess.Position) chess.Move {
+	return chess.GenerateLegalMoves(&p)[0]
+}
+
+// syncBuffer is a bytes.Buffer safe to write from the engine while a test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestGoInfiniteWaitsForStop(t *testing.T) {
+	in, commands := io.Pipe()
+	var out syncBuffer
+	engine := Engine{NewAgent: func(chess.Position, Limits) Agent { return firstMove{} }}
+	done := make(chan error)
+	go func() { done <- engine.Run(in, &out) }()
+
+	io.WriteString(commands, "position startpos\ngo infinite\n")
+	time.Sleep(100 * time.Millisecond)
+	if strings.Contains(out.String(), "bestmove") {
+		t.Fatalf("bestmove sent before stop: %q", out.String())
+	}
+
+	io.WriteString(commands, "stop\n")
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "bestmove") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "bestmove") {
+		t.Errorf("no bestmove after stop: %q", out.String())
+	}
+	io.WriteString(commands, "quit\n")
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+// reporting is an InfoAgent that plays the first legal move and describes a made up search.
+type reporting struct{ firstMove }
+
+func (r reporting) GetMoveInfo(ctx context.Context, p chess.Position) (chess.Move, Info, error) {
+	return r.GetMove(p), Info{Depth: 3, Nodes: 1200, HashFull: 17}, nil
+}
+
+func TestInfoSentBeforeBestmove(t *testing.T) {
+	engine := Engine{NewAgent: func(chess.Position, Limits) Agent { return reporting{} }}
+	var out bytes.Buffer
+	if err := engine.Run(strings.NewReader("position startpos\ngo depth 3\nstop\nquit\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	info := strings.Index(out.String(), "info depth 3 nodes 1200 hashfull 17\n")
+	bestmove := strings.Index(out.String(), "bestmove")
+	if info < 0 || bestmove < 0 || info > bestmove {
+		t.Errorf("want the search's info line before bestmove, got %q", out.String())
+	}
+}
+
+func TestInfoStringLeavesOutZeroFields(t *testing.T) {
+	if got := (Info{Nodes: 5}).String(); got != "nodes 5" {
+		t.Errorf(`Info{Nodes: 5} is %q, want "nodes 5"`, got)
+	}
+	if got := (Info{Depth: 2, Text: "tt hit rate 0.5"}).String(); got != "depth 2 string tt hit rate 0.5" {
+		t.Errorf("Info with Text is %q, want the string last", got)
+	}
+	if got := (Info{}).String(); got != "" {
+		t.Errorf(`empty Info is %q, want ""`, got)
+	}
+}
+
+// predicting is a Ponderer that plays and predicts the first legal move, and reports each position it ponders.
+type predicting struct {
+	firstMove
+	pondered chan chess.Position
+}
+
+func (e predicting) Predict(p chess.Position) chess.Move {
+	return e.GetMove(p)
+}
+
+func (e predicting) Ponder(ctx context.Context, p chess.Position) {
+	e.pondered <- p
+	<-ctx.Done()
+}
+
+func TestGoPonderWaitsForPonderhit(t *testing.T) {
+	in, commands := io.Pipe()
+	var out syncBuffer
+	agent := predicting{pondered: make(chan chess.Position, 1)}
+	engine := Engine{NewAgent: func(chess.Position, Limits) Agent { return agent }}
+	done := make(chan error)
+	go func() { done <- engine.Run(in, &out) }()
+
+	io.WriteString(commands, "position startpos moves a2a3\ngo ponder\n")
+	select {
+	case p := <-agent.pondered:
+		if fen := chess.GenerateFen(&p); fen != "rnbqkbnr/pppppppp/8/8/8/P7/1PPPPPPP/RNBQKBNR b KQkq - 0 1" {
+			t.Errorf("pondered %s, want the position after a2a3", fen)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the engine did not ponder after go ponder")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if strings.Contains(out.String(), "bestmove") {
+		t.Fatalf("bestmove sent before ponderhit: %q", out.String())
+	}
+
+	io.WriteString(commands, "ponderhit\n")
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "bestmove") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	p, err := ParsePosition([]string{"startpos", "moves", "a2a3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	move := agent.GetMove(p)
+	p.Move(move)
+	want := "bestmove " + FormatMove(move) + " ponder " + FormatMove(agent.Predict(p))
+	if !strings.Contains(out.String(), want+"\n") {
+		t.Errorf("want %q after ponderhit, got %q", want, out.String())
+	}
+	io.WriteString(commands, "quit\n")
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBudgetSharesOutTheClock(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limits Limits
+		turn   chess.Color
+		want   time.Duration
+	}{
+		{"movetime", Limits{MoveTime: 5 * time.Second, WTime: time.Minute}, chess.White, 5 * time.Second},
+		{"assumed moves to go", Limits{WTime: 60 * time.Second, BTime: time.Second}, chess.White, 2 * time.Second},
+		{"increment", Limits{BTime: 30 * time.Second, BInc: time.Second}, chess.Black, 2 * time.Second},
+		{"given moves to go", Limits{WTime: 10 * time.Second, MovesToGo: 5}, chess.White, 2 * time.Second},
+		{"half the clock at most", Limits{WTime: 2 * time.Second, WInc: 5 * time.Second}, chess.White, time.Second},
+		{"no clock", Limits{Depth: 4}, chess.White, 0},
+	} {
+		if got := tc.limits.Budget(tc.turn); got != tc.want {
+			t.Errorf("%s: budget is %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package zobrist
+
+import (
+	"math/rand/v2"
+
+	"github.com/brighamskarda/chess"
+)
+
+// Keys combined into a hash. They are generated from a fixed seed, so hashes are the same from run to run.
+var (
+	pieceKeys     [3][7][64]uint64 // Indexed by color, piece type and board index
+	blackToMove   uint64
+	castleKeys    [4]uint64 // White king side, white queen side, black king side, black queen side
+	enPassantKeys [9]uint64 // Indexed by file
+)
+
+func init() {
+	rng := rand.New(rand.NewPCG(0x6170706c65, 0x6368657373))
+	for c := range pieceKeys {
+		for t := range pieceKeys[c] {
+			for i := range pieceKeys[c][t] {
+				pieceKeys[c][t][i] = rng.Uint64()
+			}
+		}
+	}
+	blackToMove = rng.Uint64()
+	for i := range castleKeys {
+		castleKeys[i] = rng.Uint64()
+	}
+	for i := range enPassantKeys {
+		enPassantKeys[i] = rng.Uint64()
+	}
+}
+
+// Hash returns the Zobrist hash of p, covering the pieces, side to move, castling rights and en passant square but not
+// the move counters. Equal positions always hash the same, and different ones almost never do.
+func Hash(p *chess.Position) uint64 {
+	var hash uint64
+	for i, piece := range p.Board {
+		if piece.Type != chess.NoPieceType {
+			hash ^= pieceKeys[piece.Color][piece.Type][i]
+		}
+	}
+	if p.Turn == chess.Black {
+		hash ^= blackToMove
+	}
+	for i, canCastle := range []bool{p.WhiteKingSideCastle, p.WhiteQueenSideCastle, p.BlackKingSideCastle, p.BlackQueenSideCastle} {
+		if canCastle {
+			hash ^= castleKeys[i]
+		}
+	}
+	if p.EnPassant != chess.NoSquare {
+		hash ^= enPassantKeys[p.EnPassant.File]
+	}
+	return hash
+}
+
+// Repeated reports whether the position hashing to key, with halfMove half-moves since the last capture or pawn move,
+// repeats one of the positions hashed in path, which holds the positions before it oldest first.
+func Repeated(path []uint64, key uint64, halfMove uint16) bool {
+	// Only the positions since the last capture or pawn move can be the same, and only every other one has the same side
+	// to move.
+	for i := len(path) - 2; i >= 0 && i >= len(path)-int(halfMove); i -= 2 {
+		if path[i] == key {
+			return true
+		}
+	}
+	return false
+}
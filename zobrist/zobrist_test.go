@@ -0,0 +1,34 @@
+package zobrist
+
+import (
+	"testing"
+
+	"github.com/brighamskarda/chess"
+)
+
+func TestRepeatedAfterKnightsReturn(t *testing.T) {
+	p := chess.NewGame().Position()
+	var path []uint64
+	for _, uci := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+		move, err := chess.ParseUCIMove(uci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path = append(path, Hash(p))
+		p.Move(move)
+	}
+	key := Hash(p)
+	if key != path[0] {
+		t.Fatalf("the start position hashes to %x after the knights return, want %x as before", key, path[0])
+	}
+	if !Repeated(path, key, p.HalfMove) {
+		t.Errorf("the start position reached again is not reported as repeated")
+	}
+	if Repeated(path, key, 3) {
+		t.Errorf("a position repeated from before the last capture or pawn move is reported as repeated")
+	}
+	// The position just before has the other side to move, so it is never compared.
+	if Repeated([]uint64{key}, key, 10) {
+		t.Errorf("the previous position, with the other side to move, is reported as repeated")
+	}
+}